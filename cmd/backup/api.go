@@ -0,0 +1,285 @@
+// Copyright 2026 - offen.software <hioffen@posteo.de>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/offen/docker-volume-backup/internal/errwrap"
+	"github.com/robfig/cron/v3"
+)
+
+// schedule is a cron entry that has been registered for a configuration.
+type schedule struct {
+	id         cron.EntryID
+	source     string
+	kind       string
+	expression string
+}
+
+// job is a single backup run, either triggered by its schedule or using
+// the API.
+type job struct {
+	sync.Mutex
+	info jobInfo
+	log  bytes.Buffer
+}
+
+type jobInfo struct {
+	ID        int       `json:"id"`
+	Source    string    `json:"source"`
+	Trigger   string    `json:"trigger"`
+	Status    string    `json:"status"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime,omitzero"`
+	Error     string    `json:"error,omitempty"`
+	Stats     *Stats    `json:"stats,omitempty"`
+}
+
+// Write collects the log output of the job while it is running.
+func (j *job) Write(p []byte) (int, error) {
+	j.Lock()
+	defer j.Unlock()
+	return j.log.Write(p)
+}
+
+// newJob registers a new job for the given configuration that is reported
+// as the latest job until another one is started.
+func (c *command) newJob(config *Config, trigger string) *job {
+	c.Lock()
+	defer c.Unlock()
+	c.jobs++
+	j := &job{info: jobInfo{
+		ID:        c.jobs,
+		Source:    metricsSource(config),
+		Trigger:   trigger,
+		Status:    "running",
+		StartTime: time.Now(),
+	}}
+	c.latestJob = j
+	return j
+}
+
+// runJob runs a backup for the given configuration and records the result
+// in the given job.
+func (c *command) runJob(j *job, config *Config) {
+	stats, err := runScript(config, j)
+	if c.metrics != nil {
+		c.metrics.observe(metricsSource(config), stats, err)
+	}
+
+	j.Lock()
+	j.info.EndTime = time.Now()
+	j.info.Stats = stats
+	j.info.Status = "succeeded"
+	if err != nil {
+		j.info.Status = "failed"
+		j.info.Error = errwrap.Unwrap(err).Error()
+	}
+	j.Unlock()
+
+	if err != nil {
+		c.logger.Error(
+			fmt.Sprintf(
+				"Unexpected error running backup %s: %v",
+				metricsSource(config),
+				errwrap.Unwrap(err),
+			),
+			"error",
+			err,
+		)
+	}
+}
+
+// apiToken returns the token API requests need to be authenticated with,
+// read from API_TOKEN or the file referenced in API_TOKEN_FILE.
+func apiToken() (string, error) {
+	if token, ok := os.LookupEnv("API_TOKEN"); ok {
+		return token, nil
+	}
+	location, ok := os.LookupEnv("API_TOKEN_FILE")
+	if !ok {
+		return "", errwrap.Wrap(nil, "API_TOKEN or API_TOKEN_FILE is required when serving the API")
+	}
+	b, err := os.ReadFile(location)
+	if err != nil {
+		return "", errwrap.Wrap(err, fmt.Sprintf("error reading %s", location))
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// serveAPI serves the HTTP API for controlling backups on the given address,
+// which is either a TCP address or the path of a unix socket prefixed with
+// `unix:`. The returned function stops the server.
+func (c *command) serveAPI(address string) (func(), error) {
+	token, err := apiToken()
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error reading token")
+	}
+	if token == "" {
+		return nil, errwrap.Wrap(nil, "the API token must not be empty")
+	}
+
+	network := "tcp"
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		network, address = "unix", path
+		if err := os.Remove(address); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, errwrap.Wrap(err, fmt.Sprintf("error removing stale socket %s", address))
+		}
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, errwrap.Wrap(err, fmt.Sprintf("error listening on %s", address))
+	}
+	if network == "unix" {
+		if err := os.Chmod(address, 0600); err != nil {
+			return nil, errors.Join(errwrap.Wrap(err, "error setting socket permissions"), listener.Close())
+		}
+	}
+
+	server := &http.Server{Handler: c.apiHandler(token), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			c.logger.Error(
+				fmt.Sprintf("Unexpected error serving API: %v", err),
+				"error",
+				err,
+			)
+		}
+	}()
+	c.logger.Info(fmt.Sprintf("Serving API on %s", listener.Addr()))
+	return func() {
+		_ = server.Close()
+	}, nil
+}
+
+// apiHandler returns the handler for all API endpoints. All requests are
+// required to pass the given token as a bearer token.
+func (c *command) apiHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /schedules", c.handleListSchedules)
+	mux.HandleFunc("POST /backups/{source}", c.handleTriggerBackup)
+	mux.HandleFunc("GET /jobs/latest", c.handleLatestJob)
+	mux.HandleFunc("GET /jobs/latest/log", c.handleLatestJobLog)
+	mux.HandleFunc("POST /reload", c.handleReload)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provided, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAPIError(w, http.StatusUnauthorized, "invalid or missing token")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (c *command) handleListSchedules(w http.ResponseWriter, r *http.Request) {
+	type scheduleInfo struct {
+		Source     string    `json:"source"`
+		Kind       string    `json:"kind"`
+		Expression string    `json:"expression"`
+		Next       time.Time `json:"next,omitzero"`
+		Prev       time.Time `json:"prev,omitzero"`
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	result := []scheduleInfo{}
+	for _, s := range c.schedules {
+		entry := c.cr.Entry(s.id)
+		result = append(result, scheduleInfo{
+			Source:     s.source,
+			Kind:       s.kind,
+			Expression: s.expression,
+			Next:       entry.Next,
+			Prev:       entry.Prev,
+		})
+	}
+	writeAPIResponse(w, http.StatusOK, result)
+}
+
+func (c *command) handleTriggerBackup(w http.ResponseWriter, r *http.Request) {
+	source := r.PathValue("source")
+	c.Lock()
+	config, ok := c.configs[source]
+	c.Unlock()
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, fmt.Sprintf("no configuration named %s", source))
+		return
+	}
+
+	c.logger.Info(fmt.Sprintf("Now running script for %s as requested using the API", source))
+	j := c.newJob(config, "api")
+	go c.runJob(j, config)
+
+	j.Lock()
+	defer j.Unlock()
+	writeAPIResponse(w, http.StatusAccepted, j.info)
+}
+
+func (c *command) handleLatestJob(w http.ResponseWriter, r *http.Request) {
+	j := c.latest()
+	if j == nil {
+		writeAPIError(w, http.StatusNotFound, "no job has run yet")
+		return
+	}
+	j.Lock()
+	defer j.Unlock()
+	if j.info.Stats != nil {
+		j.info.Stats.Lock()
+		defer j.info.Stats.Unlock()
+	}
+	writeAPIResponse(w, http.StatusOK, j.info)
+}
+
+func (c *command) handleLatestJobLog(w http.ResponseWriter, r *http.Request) {
+	j := c.latest()
+	if j == nil {
+		writeAPIError(w, http.StatusNotFound, "no job has run yet")
+		return
+	}
+	j.Lock()
+	defer j.Unlock()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write(j.log.Bytes())
+}
+
+// handleReload reloads the configuration and responds with the resulting
+// schedules. In case the configuration is invalid, the previous schedules
+// are kept and the error is returned.
+func (c *command) handleReload(w http.ResponseWriter, r *http.Request) {
+	c.logger.Info("Reloading configuration as requested using the API")
+	if err := c.reloadSchedules(); err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	c.handleListSchedules(w, r)
+}
+
+func (c *command) latest() *job {
+	c.Lock()
+	defer c.Unlock()
+	return c.latestJob
+}
+
+func writeAPIResponse(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeAPIResponse(w, status, map[string]string{"error": message})
+}
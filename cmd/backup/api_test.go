@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/robfig/cron/v3"
+)
+
+func TestAPIHandler(t *testing.T) {
+	c := &command{
+		logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+		cr:      cron.New(),
+		configs: map[string]*Config{},
+	}
+	id, err := c.cr.AddFunc("@daily", func() {})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	c.schedules = []schedule{{id: id, source: "backup.env", kind: "backup", expression: "@daily"}}
+	handler := c.apiHandler("token")
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		setup          func(t *testing.T)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"missing token", http.MethodGet, "/schedules", "", nil, http.StatusUnauthorized, "invalid or missing token"},
+		{"invalid token", http.MethodGet, "/schedules", "other", nil, http.StatusUnauthorized, "invalid or missing token"},
+		{"schedules", http.MethodGet, "/schedules", "token", nil, http.StatusOK, `"source":"backup.env","kind":"backup","expression":"@daily"`},
+		{"unknown source", http.MethodPost, "/backups/other.env", "token", nil, http.StatusNotFound, "no configuration named other.env"},
+		{"no job", http.MethodGet, "/jobs/latest", "token", nil, http.StatusNotFound, "no job has run yet"},
+		{
+			"latest job", http.MethodGet, "/jobs/latest", "token",
+			func(t *testing.T) {
+				j := c.newJob(&Config{source: "backup.env"}, "api")
+				_, _ = j.Write([]byte("running backup"))
+			},
+			http.StatusOK, `"id":1,"source":"backup.env","trigger":"api","status":"running"`,
+		},
+		{"latest job log", http.MethodGet, "/jobs/latest/log", "token", nil, http.StatusOK, "running backup"},
+		{
+			"invalid reload", http.MethodPost, "/reload", "token",
+			func(t *testing.T) {
+				t.Setenv("BACKUP_CRON_EXPRESSION", "invalid")
+			},
+			http.StatusUnprocessableEntity, "error parsing schedule invalid of env",
+		},
+		{"schedules after invalid reload", http.MethodGet, "/schedules", "token", nil, http.StatusOK, `"source":"backup.env","kind":"backup","expression":"@daily"`},
+		{
+			"reload", http.MethodPost, "/reload", "token",
+			func(t *testing.T) {
+				t.Setenv("BACKUP_CRON_EXPRESSION", "@hourly")
+			},
+			http.StatusOK, `"source":"env","kind":"backup","expression":"@hourly"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.setup != nil {
+				test.setup(t)
+			}
+			req := httptest.NewRequest(test.method, test.path, nil)
+			if test.token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != test.expectedStatus {
+				t.Errorf("Expected status %d, got %d", test.expectedStatus, rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), test.expectedBody) {
+				t.Errorf("Expected body to contain %s, got %s", test.expectedBody, rec.Body.String())
+			}
+		})
+	}
+
+	if _, ok := c.configs["backup.env"]; ok {
+		t.Error("Expected configuration to be replaced after reloading")
+	}
+}
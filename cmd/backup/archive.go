@@ -8,34 +8,41 @@ package main
 
 import (
 	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/klauspost/compress/zstd"
 	"github.com/klauspost/pgzip"
 	"github.com/offen/docker-volume-backup/internal/errwrap"
 )
 
-func createArchive(files []string, inputFilePath, outputFilePath string, compression string, compressionConcurrency int) error {
+func createArchive(files []string, dumpDirs map[string][]byte, virtualFiles []virtualFile, inputFilePath, outputFilePath string, compression string, compressionConcurrency int) ([]archivedFile, error) {
 	_, outputFilePath, err := makeAbsolute(stripTrailingSlashes(inputFilePath), outputFilePath)
 	if err != nil {
-		return errwrap.Wrap(err, "error transposing given file paths")
+		return nil, errwrap.Wrap(err, "error transposing given file paths")
 	}
 	if err := os.MkdirAll(filepath.Dir(outputFilePath), 0755); err != nil {
-		return errwrap.Wrap(err, "error creating output file path")
+		return nil, errwrap.Wrap(err, "error creating output file path")
 	}
 
-	if err := compress(files, outputFilePath, compression, compressionConcurrency); err != nil {
-		return errwrap.Wrap(err, "error creating archive")
+	archived, err := compress(files, dumpDirs, virtualFiles, outputFilePath, compression, compressionConcurrency)
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error creating archive")
 	}
 
-	return nil
+	return archived, nil
 }
 
 func stripTrailingSlashes(path string) string {
@@ -55,49 +62,74 @@ func makeAbsolute(inputFilePath, outputFilePath string) (string, string, error)
 	return inputFilePath, outputFilePath, err
 }
 
-func compress(paths []string, outFilePath, algo string, concurrency int) error {
+func compress(paths []string, dumpDirs map[string][]byte, virtualFiles []virtualFile, outFilePath, algo string, concurrency int) ([]archivedFile, error) {
 	file, err := os.Create(outFilePath)
 	if err != nil {
-		return errwrap.Wrap(err, "error creating out file")
+		return nil, errwrap.Wrap(err, "error creating out file")
 	}
 
 	prefix := path.Dir(outFilePath)
-	compressWriter, err := getCompressionWriter(file, algo, concurrency)
+	archived, err := writeArchive(paths, dumpDirs, virtualFiles, prefix, file, algo, concurrency)
+	if err != nil {
+		return nil, errors.Join(err, file.Close())
+	}
+
+	err = file.Close()
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error closing file")
+	}
+
+	return archived, nil
+}
+
+// writeArchive writes a compressed tar archive of the given paths to w and
+// returns a description of all entries written. Directories that have an
+// entry in dumpDirs are written as GNU dumpdir entries. Virtual files are
+// appended after all paths. The given prefix is stripped from the paths when
+// naming archive entries.
+func writeArchive(paths []string, dumpDirs map[string][]byte, virtualFiles []virtualFile, prefix string, w io.Writer, algo string, concurrency int) ([]archivedFile, error) {
+	compressWriter, err := getCompressionWriter(w, algo, concurrency)
 	if err != nil {
-		return errwrap.Wrap(err, "error getting compression writer")
+		return nil, errwrap.Wrap(err, "error getting compression writer")
 	}
 	tarWriter := tar.NewWriter(compressWriter)
 
+	var archived []archivedFile
 	for _, p := range paths {
-		if err := writeTarball(p, tarWriter, prefix); err != nil {
-			return errwrap.Wrap(err, fmt.Sprintf("error writing %s to archive", p))
+		entry, err := writeTarball(p, tarWriter, prefix, dumpDirs[p])
+		if err != nil {
+			return nil, errwrap.Wrap(err, fmt.Sprintf("error writing %s to archive", p))
+		}
+		if entry != nil {
+			archived = append(archived, *entry)
 		}
 	}
-
+	for _, f := range virtualFiles {
+		entry, err := writeVirtualFile(f, tarWriter, prefix)
+		if err != nil {
+			return nil, errwrap.Wrap(err, fmt.Sprintf("error writing %s to archive", f.path))
+		}
+		archived = append(archived, *entry)
+	}
 	err = tarWriter.Close()
 	if err != nil {
-		return errwrap.Wrap(err, "error closing tar writer")
+		return nil, errwrap.Wrap(err, "error closing tar writer")
 	}
 
 	err = compressWriter.Close()
 	if err != nil {
-		return errwrap.Wrap(err, "error closing compression writer")
-	}
-
-	err = file.Close()
-	if err != nil {
-		return errwrap.Wrap(err, "error closing file")
+		return nil, errwrap.Wrap(err, "error closing compression writer")
 	}
 
-	return nil
+	return archived, nil
 }
 
-func getCompressionWriter(file *os.File, algo string, concurrency int) (io.WriteCloser, error) {
+func getCompressionWriter(w io.Writer, algo string, concurrency int) (io.WriteCloser, error) {
 	switch algo {
 	case "none":
-		return &passThroughWriteCloser{file}, nil
+		return &passThroughWriteCloser{w}, nil
 	case "gz":
-		w, err := pgzip.NewWriterLevel(file, 5)
+		w, err := pgzip.NewWriterLevel(w, 5)
 		if err != nil {
 			return nil, errwrap.Wrap(err, "gzip error")
 		}
@@ -112,7 +144,7 @@ func getCompressionWriter(file *os.File, algo string, concurrency int) (io.Write
 
 		return w, nil
 	case "zst":
-		compressWriter, err := zstd.NewWriter(file)
+		compressWriter, err := zstd.NewWriter(w)
 		if err != nil {
 			return nil, errwrap.Wrap(err, "zstd error")
 		}
@@ -122,7 +154,15 @@ func getCompressionWriter(file *os.File, algo string, concurrency int) (io.Write
 	}
 }
 
-func writeTarball(path string, tarWriter *tar.Writer, prefix string) (returnErr error) {
+// archivedFile describes a single entry that has been written to an archive.
+type archivedFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Mode   string `json:"mode"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+func writeTarball(path string, tarWriter *tar.Writer, prefix string, dumpDir []byte) (_ *archivedFile, returnErr error) {
 	fileInfo, err := os.Lstat(path)
 	if err != nil {
 		returnErr = errwrap.Wrap(err, fmt.Sprintf("error getting file info for %s", path))
@@ -130,7 +170,7 @@ func writeTarball(path string, tarWriter *tar.Writer, prefix string) (returnErr
 	}
 
 	if fileInfo.Mode()&os.ModeSocket == os.ModeSocket {
-		return nil
+		return nil, nil
 	}
 
 	var link string
@@ -148,15 +188,30 @@ func writeTarball(path string, tarWriter *tar.Writer, prefix string) (returnErr
 		return
 	}
 	header.Name = strings.TrimPrefix(path, prefix)
+	if dumpDir != nil && header.Typeflag == tar.TypeDir {
+		header.Typeflag = typeGNUDumpDir
+		header.Size = int64(len(dumpDir))
+		header.Format = tar.FormatGNU
+	}
 
 	err = tarWriter.WriteHeader(header)
 	if err != nil {
 		returnErr = errwrap.Wrap(err, "error writing file info header")
 		return
 	}
+	if header.Typeflag == typeGNUDumpDir {
+		if _, err := tarWriter.Write(dumpDir); err != nil {
+			returnErr = errwrap.Wrap(err, "error writing dumpdir")
+			return
+		}
+	}
 
+	archived := &archivedFile{
+		Path: header.Name,
+		Mode: fileInfo.Mode().String(),
+	}
 	if !fileInfo.Mode().IsRegular() {
-		return nil
+		return archived, nil
 	}
 
 	file, err := os.Open(path)
@@ -168,17 +223,66 @@ func writeTarball(path string, tarWriter *tar.Writer, prefix string) (returnErr
 		returnErr = errors.Join(returnErr, file.Close())
 	}()
 
-	_, err = io.Copy(tarWriter, file)
+	hash := sha256.New()
+	archived.Size, err = io.Copy(io.MultiWriter(tarWriter, hash), file)
 	if err != nil {
 		returnErr = errwrap.Wrap(err, fmt.Sprintf("error copying %s to tar writer", path))
 		return
 	}
+	archived.SHA256 = hex.EncodeToString(hash.Sum(nil))
 
-	return nil
+	return archived, nil
 }
 
+// virtualFile is a regular file that is written to an archive without
+// existing in the backup sources, e.g. the output of a command.
+type virtualFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+	open    func() (io.ReadCloser, error)
+}
+
+func writeVirtualFile(f virtualFile, tarWriter *tar.Writer, prefix string) (_ *archivedFile, returnErr error) {
+	mode := fs.FileMode(0644)
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     strings.TrimPrefix(f.path, prefix),
+		Size:     f.size,
+		Mode:     int64(mode),
+		ModTime:  f.modTime,
+	}
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return nil, errwrap.Wrap(err, "error writing file info header")
+	}
+
+	r, err := f.open()
+	if err != nil {
+		return nil, errwrap.Wrap(err, fmt.Sprintf("error opening %s", f.path))
+	}
+	defer func() {
+		returnErr = errors.Join(returnErr, r.Close())
+	}()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tarWriter, hash), r); err != nil {
+		return nil, errwrap.Wrap(err, fmt.Sprintf("error copying %s to tar writer", f.path))
+	}
+	return &archivedFile{
+		Path:   header.Name,
+		Size:   header.Size,
+		Mode:   mode.String(),
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// typeGNUDumpDir is the type flag of GNU dumpdir entries. Such entries
+// describe a directory and list all of its children, so children that are
+// not listed are removed when extracting incremental archives.
+const typeGNUDumpDir = 'D'
+
 type passThroughWriteCloser struct {
-	target io.WriteCloser
+	target io.Writer
 }
 
 func (p *passThroughWriteCloser) Write(b []byte) (int, error) {
@@ -188,3 +292,234 @@ func (p *passThroughWriteCloser) Write(b []byte) (int, error) {
 func (p *passThroughWriteCloser) Close() error {
 	return nil
 }
+
+// getDecompressionReader wraps the given reader so that it returns the
+// decompressed contents. The compression algorithm is detected by looking at
+// the leading bytes of the stream, so archives can be read independently of
+// the file name they have been stored under.
+func getDecompressionReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, errwrap.Wrap(err, "error reading archive header")
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gzipReader, err := pgzip.NewReader(br)
+		if err != nil {
+			return nil, errwrap.Wrap(err, "gzip error")
+		}
+		return gzipReader, nil
+	case bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zstdReader, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, errwrap.Wrap(err, "zstd error")
+		}
+		return zstdReader.IOReadCloser(), nil
+	default:
+		return io.NopCloser(br), nil
+	}
+}
+
+// extractArchive reads a tar archive from the given reader and writes all of
+// its entries to disk. Entries are stored with absolute paths by
+// writeTarball, so each entry is restored at its original location relative
+// to the given target directory.
+func extractArchive(r io.Reader, target string) (int, error) {
+	target, err := filepath.Abs(target)
+	if err != nil {
+		return 0, errwrap.Wrap(err, "error getting absolute path")
+	}
+
+	var numEntries int
+	var dirs []*tar.Header
+	tarReader := tar.NewReader(r)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return numEntries, errwrap.Wrap(err, "error reading tar header")
+		}
+
+		dst := filepath.Join(target, filepath.Clean("/"+header.Name))
+		if err := checkSymlinkParents(target, dst); err != nil {
+			return numEntries, errwrap.Wrap(err, fmt.Sprintf("refusing to extract %s", header.Name))
+		}
+
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return numEntries, errwrap.Wrap(err, fmt.Sprintf("error creating parent directory for %s", dst))
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir, typeGNUDumpDir:
+			if header.Typeflag == typeGNUDumpDir {
+				if err := purgeDirectory(dst, tarReader); err != nil {
+					return numEntries, errwrap.Wrap(err, fmt.Sprintf("error purging directory %s", dst))
+				}
+			}
+			if err := os.MkdirAll(dst, 0700); err != nil {
+				return numEntries, errwrap.Wrap(err, fmt.Sprintf("error creating directory %s", dst))
+			}
+			// Permissions and timestamps of directories are applied after
+			// all entries have been written as creating children would
+			// otherwise update the modification time again.
+			h := *header
+			h.Name = dst
+			dirs = append(dirs, &h)
+			numEntries++
+			continue
+		case tar.TypeReg:
+			if err := writeFileFromArchive(dst, header, tarReader); err != nil {
+				return numEntries, errwrap.Wrap(err, fmt.Sprintf("error writing file %s", dst))
+			}
+		case tar.TypeSymlink:
+			if err := remove(dst); err != nil {
+				return numEntries, errwrap.Wrap(err, fmt.Sprintf("error removing existing file %s", dst))
+			}
+			if err := os.Symlink(header.Linkname, dst); err != nil {
+				return numEntries, errwrap.Wrap(err, fmt.Sprintf("error creating symlink %s", dst))
+			}
+		case tar.TypeLink:
+			linkTarget := filepath.Join(target, filepath.Clean("/"+header.Linkname))
+			if err := checkSymlinkParents(target, linkTarget); err != nil {
+				return numEntries, errwrap.Wrap(err, fmt.Sprintf("refusing to link %s", header.Name))
+			}
+			if err := remove(dst); err != nil {
+				return numEntries, errwrap.Wrap(err, fmt.Sprintf("error removing existing file %s", dst))
+			}
+			if err := os.Link(linkTarget, dst); err != nil {
+				return numEntries, errwrap.Wrap(err, fmt.Sprintf("error creating hard link %s", dst))
+			}
+		default:
+			// Device files, fifos and the like cannot be restored.
+			continue
+		}
+
+		if err := applyOwnership(dst, header); err != nil {
+			return numEntries, err
+		}
+		if header.Typeflag != tar.TypeSymlink {
+			if err := os.Chtimes(dst, header.AccessTime, header.ModTime); err != nil {
+				return numEntries, errwrap.Wrap(err, fmt.Sprintf("error setting modification time of %s", dst))
+			}
+		}
+		numEntries++
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		dir := dirs[i]
+		if err := os.Chmod(dir.Name, dir.FileInfo().Mode().Perm()); err != nil {
+			return numEntries, errwrap.Wrap(err, fmt.Sprintf("error setting permissions of %s", dir.Name))
+		}
+		if err := applyOwnership(dir.Name, dir); err != nil {
+			return numEntries, err
+		}
+		if err := os.Chtimes(dir.Name, dir.AccessTime, dir.ModTime); err != nil {
+			return numEntries, errwrap.Wrap(err, fmt.Sprintf("error setting modification time of %s", dir.Name))
+		}
+	}
+
+	return numEntries, nil
+}
+
+// purgeDirectory reads the contents of a GNU dumpdir entry from r and removes
+// all children of dir that are not listed. In case dir exists, but is not a
+// directory, it is removed.
+func purgeDirectory(dir string, r io.Reader) error {
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		return errwrap.Wrap(err, "error reading dumpdir")
+	}
+	listed := map[string]bool{}
+	for _, entry := range bytes.Split(contents, []byte{0}) {
+		if len(entry) > 1 {
+			listed[string(entry[1:])] = true
+		}
+	}
+
+	fi, err := os.Lstat(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return errwrap.Wrap(err, "error getting file info")
+	}
+	if !fi.IsDir() {
+		return remove(dir)
+	}
+	children, err := os.ReadDir(dir)
+	if err != nil {
+		return errwrap.Wrap(err, "error reading directory")
+	}
+	for _, child := range children {
+		if listed[child.Name()] {
+			continue
+		}
+		if err := remove(filepath.Join(dir, child.Name())); err != nil {
+			return errwrap.Wrap(err, fmt.Sprintf("error removing %s", child.Name()))
+		}
+	}
+	return nil
+}
+
+func writeFileFromArchive(dst string, header *tar.Header, r io.Reader) (returnErr error) {
+	if err := remove(dst); err != nil {
+		return errwrap.Wrap(err, "error removing existing file")
+	}
+	file, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, header.FileInfo().Mode().Perm())
+	if err != nil {
+		return errwrap.Wrap(err, "error creating file")
+	}
+	defer func() {
+		returnErr = errors.Join(returnErr, file.Close())
+	}()
+
+	if _, err := io.Copy(file, r); err != nil {
+		return errwrap.Wrap(err, "error copying contents from archive")
+	}
+	return nil
+}
+
+// applyOwnership restores the owner of the given file as stored in the
+// archive. This is only possible when running as root, so it's skipped
+// otherwise.
+func applyOwnership(dst string, header *tar.Header) error {
+	if os.Geteuid() != 0 {
+		return nil
+	}
+	if err := os.Lchown(dst, header.Uid, header.Gid); err != nil {
+		return errwrap.Wrap(err, fmt.Sprintf("error setting ownership of %s", dst))
+	}
+	return nil
+}
+
+// checkSymlinkParents returns an error in case any of the parent directories
+// of dst below target is a symlink, which would allow a crafted archive to
+// write files outside of the target directory.
+func checkSymlinkParents(target, dst string) error {
+	rel, err := filepath.Rel(target, filepath.Dir(dst))
+	if err != nil {
+		return errwrap.Wrap(err, "error computing relative path")
+	}
+	current := target
+	for _, elem := range strings.Split(rel, string(filepath.Separator)) {
+		if elem == "." {
+			continue
+		}
+		current = filepath.Join(current, elem)
+		fi, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return errwrap.Wrap(err, fmt.Sprintf("error checking %s", current))
+		}
+		if fi.Mode()&os.ModeSymlink == os.ModeSymlink {
+			return errwrap.Wrap(nil, fmt.Sprintf("parent directory %s is a symlink", current))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+// Copyright 2026 - offen.software <hioffen@posteo.de>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	ctr "github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/client"
+	"github.com/offen/docker-volume-backup/internal/errwrap"
+)
+
+// outputCommand is a command whose output is added to the archive.
+type outputCommand struct {
+	command     string
+	user        string
+	location    string
+	description string
+}
+
+// streamCommand returns the command defined in the
+// `docker-volume-backup.archive-stream.command` label of the given container.
+// Its output is added to the archive at the path given in the
+// `docker-volume-backup.archive-stream` label, relative to the given backup
+// sources.
+func streamCommand(c ctr.Summary, backupSources string) (outputCommand, error) {
+	command := c.Labels["docker-volume-backup.archive-stream.command"]
+	if command == "" {
+		return outputCommand{}, errwrap.Wrap(nil, fmt.Sprintf("container %s does not define a command to stream", containerName(c)))
+	}
+	location := filepath.Join(backupSources, c.Labels["docker-volume-backup.archive-stream"])
+	if location == filepath.Clean(backupSources) || !isWithin(location, backupSources) {
+		return outputCommand{}, errwrap.Wrap(nil, fmt.Sprintf("container %s defines a path outside of the backup sources", containerName(c)))
+	}
+	return outputCommand{
+		command:     command,
+		user:        c.Labels["docker-volume-backup.archive-stream.user"],
+		location:    location,
+		description: "command output",
+	}, nil
+}
+
+// outputContainers returns all containers that are labeled for adding the
+// output of a command to the archive, i.e. for dumping their databases or
+// streaming the output of a custom command.
+func (s *script) outputContainers() ([]ctr.Summary, error) {
+	if s.cli == nil {
+		return nil, nil
+	}
+
+	var containers []ctr.Summary
+	for _, label := range []string{"docker-volume-backup.dump", "docker-volume-backup.archive-stream"} {
+		f := client.Filters{}.Add("label", label)
+		if s.c.ExecLabel != "" {
+			f.Add("label", fmt.Sprintf("docker-volume-backup.exec-label=%s", s.c.ExecLabel))
+		}
+		result, err := s.cli.ContainerList(context.Background(), client.ContainerListOptions{
+			Filters: f,
+		})
+		if err != nil {
+			return nil, errwrap.Wrap(err, "error querying for containers")
+		}
+		for _, c := range result.Items {
+			if slices.ContainsFunc(containers, func(other ctr.Summary) bool { return other.ID == c.ID }) {
+				return nil, errwrap.Wrap(nil, fmt.Sprintf("container %s cannot be labeled for both dumping and streaming", containerName(c)))
+			}
+			containers = append(containers, c)
+		}
+	}
+	if len(containers) == 0 {
+		return nil, nil
+	}
+
+	if s.c.BackupRepository {
+		return nil, errwrap.Wrap(nil, "adding command output to the archive is not supported when using a repository")
+	}
+	if s.c.BackupSplitByDirectory {
+		return nil, errwrap.Wrap(nil, "adding command output to the archive is not supported when splitting backups by directory")
+	}
+	return containers, nil
+}
+
+// captureOutputs runs the commands of the given containers and returns
+// their output as virtual files located in the given backup sources.
+func (s *script) captureOutputs(containers []ctr.Summary, backupSources string) ([]virtualFile, error) {
+	var files []virtualFile
+	for _, c := range containers {
+		var cmd outputCommand
+		var err error
+		if _, ok := c.Labels["docker-volume-backup.dump"]; ok {
+			cmd, err = dumpCommand(c, backupSources)
+		} else {
+			cmd, err = streamCommand(c, backupSources)
+		}
+		if err != nil {
+			return nil, errwrap.Wrap(err, "error determining command")
+		}
+
+		if _, err := os.Lstat(cmd.location); !errors.Is(err, os.ErrNotExist) {
+			return nil, errwrap.Wrap(err, fmt.Sprintf("cannot add output of container %s as `%s` already exists", containerName(c), cmd.location))
+		}
+
+		s.logger.Info(
+			fmt.Sprintf("Capturing %s of container %s to a temporary file in `%s`.", cmd.description, containerName(c), s.spoolDirectory()),
+		)
+		f, err := s.spoolOutput(c.ID, cmd)
+		if err != nil {
+			return nil, errwrap.Wrap(err, fmt.Sprintf("error capturing %s of container %s", cmd.description, containerName(c)))
+		}
+		files = append(files, f)
+		s.logger.Info(
+			fmt.Sprintf("Captured %d bytes of container %s to `%s`.", f.size, containerName(c), cmd.location),
+		)
+	}
+	return files, nil
+}
+
+// spoolDirectory returns the directory command output is spooled to before
+// it is added to the archive.
+func (s *script) spoolDirectory() string {
+	if s.c.ExecSpoolDirectory != "" {
+		return s.c.ExecSpoolDirectory
+	}
+	return os.TempDir()
+}
+
+// spoolOutput runs the given command and streams its output into a
+// temporary file in EXEC_SPOOL_DIRECTORY. As tar archives need to know the
+// size of an entry before its contents are written, the output cannot be
+// written to the archive directly. The temporary file is removed after the
+// run has finished.
+func (s *script) spoolOutput(containerID string, cmd outputCommand) (_ virtualFile, returnErr error) {
+	spool, err := os.CreateTemp(s.spoolDirectory(), "docker-volume-backup-output-*")
+	if err != nil {
+		return virtualFile{}, errwrap.Wrap(err, "error creating temporary file")
+	}
+	s.registerHook(hookLevelPlumbing, func(error) error {
+		if err := remove(spool.Name()); err != nil {
+			return errwrap.Wrap(err, "error removing temporary file")
+		}
+		return nil
+	})
+	defer func() {
+		returnErr = errors.Join(returnErr, spool.Close())
+	}()
+
+	// Dump commands can be verbose, so stderr is forwarded while the command
+	// is running and only its beginning is kept for reporting errors.
+	stderr := &cappedBuffer{max: 1 << 16}
+	var stderrWriter io.Writer = stderr
+	if s.c.ExecForwardOutput {
+		stderrWriter = io.MultiWriter(stderr, os.Stderr)
+	}
+	counter := &countingWriter{w: spool}
+	err = s.execStream(containerID, cmd.command, cmd.user, counter, stderrWriter)
+	if err != nil {
+		if output := bytes.TrimSpace(stderr.Bytes()); len(output) != 0 {
+			err = errwrap.Wrap(err, string(output))
+		}
+		return virtualFile{}, errwrap.Wrap(err, "error running command")
+	}
+
+	return virtualFile{
+		path:    cmd.location,
+		modTime: time.Now(),
+		size:    int64(counter.n),
+		open: func() (io.ReadCloser, error) {
+			return os.Open(spool.Name())
+		},
+	}, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+
+	ctr "github.com/moby/moby/api/types/container"
+)
+
+func TestStreamCommand(t *testing.T) {
+	tests := []struct {
+		name             string
+		labels           map[string]string
+		expectedLocation string
+		expectError      bool
+	}{
+		{
+			"valid",
+			map[string]string{
+				"docker-volume-backup.archive-stream":         "dumps/app.json",
+				"docker-volume-backup.archive-stream.command": "app export",
+			},
+			"/backup/dumps/app.json",
+			false,
+		},
+		{
+			"missing command",
+			map[string]string{
+				"docker-volume-backup.archive-stream": "app.json",
+			},
+			"",
+			true,
+		},
+		{
+			"outside of sources",
+			map[string]string{
+				"docker-volume-backup.archive-stream":         "../app.json",
+				"docker-volume-backup.archive-stream.command": "app export",
+			},
+			"",
+			true,
+		},
+		{
+			"sources",
+			map[string]string{
+				"docker-volume-backup.archive-stream":         "",
+				"docker-volume-backup.archive-stream.command": "app export",
+			},
+			"",
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cmd, err := streamCommand(ctr.Summary{ID: "app", Labels: test.labels}, "/backup/")
+			if (err != nil) != test.expectError {
+				t.Fatalf("Unexpected error value %v", err)
+			}
+			if cmd.location != test.expectedLocation {
+				t.Errorf("Expected location %s, got %s", test.expectedLocation, cmd.location)
+			}
+		})
+	}
+}
+
+func TestCappedBuffer(t *testing.T) {
+	b := &cappedBuffer{max: 8}
+	for _, chunk := range []string{"error: ", "something ", "went wrong"} {
+		if n, err := b.Write([]byte(chunk)); err != nil || n != len(chunk) {
+			t.Fatalf("Unexpected result writing %q: %d, %v", chunk, n, err)
+		}
+	}
+	if expected := "error: s"; b.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, b.String())
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	content  string
+}
+
+func buildArchive(t *testing.T, entries []testEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		header := &tar.Header{
+			Name:     e.name,
+			Typeflag: e.typeflag,
+			Linkname: e.linkname,
+			Mode:     0644,
+			Size:     int64(len(e.content)),
+		}
+		if e.typeflag != tar.TypeReg && e.typeflag != typeGNUDumpDir {
+			header.Size = 0
+		}
+		if e.typeflag == tar.TypeDir || e.typeflag == typeGNUDumpDir {
+			header.Mode = 0755
+		}
+		if e.typeflag == typeGNUDumpDir {
+			header.Format = tar.FormatGNU
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if header.Size > 0 {
+			if _, err := tw.Write([]byte(e.content)); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractArchive(t *testing.T) {
+	tests := []struct {
+		name        string
+		entries     []testEntry
+		prepare     func(t *testing.T, target, outside string)
+		expectError bool
+		check       func(t *testing.T, target, outside string)
+	}{
+		{
+			"relative parent names stay within target",
+			[]testEntry{
+				{name: "../../escape.txt", typeflag: tar.TypeReg, content: "escape"},
+			},
+			nil,
+			false,
+			func(t *testing.T, target, outside string) {
+				expectContent(t, filepath.Join(target, "escape.txt"), "escape")
+				expectMissing(t, filepath.Join(filepath.Dir(target), "escape.txt"))
+			},
+		},
+		{
+			"file below symlinked parent",
+			[]testEntry{
+				{name: "/link", typeflag: tar.TypeSymlink, linkname: "OUTSIDE"},
+				{name: "/link/evil.txt", typeflag: tar.TypeReg, content: "evil"},
+			},
+			nil,
+			true,
+			func(t *testing.T, target, outside string) {
+				expectMissing(t, filepath.Join(outside, "evil.txt"))
+			},
+		},
+		{
+			"hard link within archive",
+			[]testEntry{
+				{name: "/data/a.txt", typeflag: tar.TypeReg, content: "shared"},
+				{name: "/data/b.txt", typeflag: tar.TypeLink, linkname: "/data/a.txt"},
+			},
+			nil,
+			false,
+			func(t *testing.T, target, outside string) {
+				a, _ := os.Stat(filepath.Join(target, "data", "a.txt"))
+				b, err := os.Stat(filepath.Join(target, "data", "b.txt"))
+				if err != nil || !os.SameFile(a, b) {
+					t.Errorf("Expected hard link to a.txt, got %v", err)
+				}
+			},
+		},
+		{
+			"hard link with relative parent name",
+			[]testEntry{
+				{name: "/a.txt", typeflag: tar.TypeReg, content: "inside"},
+				{name: "/b.txt", typeflag: tar.TypeLink, linkname: "../../a.txt"},
+			},
+			nil,
+			false,
+			func(t *testing.T, target, outside string) {
+				expectContent(t, filepath.Join(target, "b.txt"), "inside")
+			},
+		},
+		{
+			"hard link below symlinked parent",
+			[]testEntry{
+				{name: "/link", typeflag: tar.TypeSymlink, linkname: "OUTSIDE"},
+				{name: "/stolen.txt", typeflag: tar.TypeLink, linkname: "/link/secret.txt"},
+			},
+			func(t *testing.T, target, outside string) {
+				writeFile(t, filepath.Join(outside, "secret.txt"), "secret")
+			},
+			true,
+			func(t *testing.T, target, outside string) {
+				expectMissing(t, filepath.Join(target, "stolen.txt"))
+			},
+		},
+		{
+			"existing symlink at destination",
+			[]testEntry{
+				{name: "/file.txt", typeflag: tar.TypeReg, content: "restored"},
+			},
+			func(t *testing.T, target, outside string) {
+				writeFile(t, filepath.Join(outside, "victim.txt"), "victim")
+				if err := os.Symlink(filepath.Join(outside, "victim.txt"), filepath.Join(target, "file.txt")); err != nil {
+					t.Fatalf("Unexpected error %v", err)
+				}
+			},
+			false,
+			func(t *testing.T, target, outside string) {
+				expectContent(t, filepath.Join(outside, "victim.txt"), "victim")
+				fi, err := os.Lstat(filepath.Join(target, "file.txt"))
+				if err != nil || !fi.Mode().IsRegular() {
+					t.Errorf("Expected regular file to replace symlink, got %v", err)
+				}
+				expectContent(t, filepath.Join(target, "file.txt"), "restored")
+			},
+		},
+		{
+			"dumpdir removes unlisted children",
+			[]testEntry{
+				{name: "/data/", typeflag: typeGNUDumpDir, content: "Nkept.txt\x00Ynew.txt\x00Dsub\x00\x00"},
+				{name: "/data/new.txt", typeflag: tar.TypeReg, content: "new"},
+			},
+			func(t *testing.T, target, outside string) {
+				writeFile(t, filepath.Join(target, "data", "kept.txt"), "kept")
+				writeFile(t, filepath.Join(target, "data", "deleted.txt"), "deleted")
+				writeFile(t, filepath.Join(target, "data", "sub", "file.txt"), "file")
+				writeFile(t, filepath.Join(target, "data", "gone", "file.txt"), "file")
+			},
+			false,
+			func(t *testing.T, target, outside string) {
+				expectContent(t, filepath.Join(target, "data", "kept.txt"), "kept")
+				expectContent(t, filepath.Join(target, "data", "new.txt"), "new")
+				expectContent(t, filepath.Join(target, "data", "sub", "file.txt"), "file")
+				expectMissing(t, filepath.Join(target, "data", "deleted.txt"))
+				expectMissing(t, filepath.Join(target, "data", "gone"))
+			},
+		},
+		{
+			"dumpdir replaces symlink",
+			[]testEntry{
+				{name: "/data/", typeflag: typeGNUDumpDir, content: "\x00"},
+			},
+			func(t *testing.T, target, outside string) {
+				writeFile(t, filepath.Join(outside, "victim.txt"), "victim")
+				if err := os.Symlink(outside, filepath.Join(target, "data")); err != nil {
+					t.Fatalf("Unexpected error %v", err)
+				}
+			},
+			false,
+			func(t *testing.T, target, outside string) {
+				expectContent(t, filepath.Join(outside, "victim.txt"), "victim")
+				fi, err := os.Lstat(filepath.Join(target, "data"))
+				if err != nil || !fi.IsDir() {
+					t.Errorf("Expected directory to replace symlink, got %v", err)
+				}
+			},
+		},
+		{
+			"symlink is restored as is",
+			[]testEntry{
+				{name: "/link", typeflag: tar.TypeSymlink, linkname: "OUTSIDE"},
+			},
+			nil,
+			false,
+			func(t *testing.T, target, outside string) {
+				link, err := os.Readlink(filepath.Join(target, "link"))
+				if err != nil || link != outside {
+					t.Errorf("Expected symlink to %s, got %s and %v", outside, link, err)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			target := filepath.Join(root, "target")
+			outside := filepath.Join(root, "outside")
+			for _, dir := range []string{target, outside} {
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					t.Fatalf("Unexpected error %v", err)
+				}
+			}
+			if test.prepare != nil {
+				test.prepare(t, target, outside)
+			}
+			entries := make([]testEntry, len(test.entries))
+			for i, e := range test.entries {
+				if e.linkname == "OUTSIDE" {
+					e.linkname = outside
+				}
+				entries[i] = e
+			}
+
+			_, err := extractArchive(bytes.NewReader(buildArchive(t, entries)), target)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			test.check(t, target, outside)
+		})
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	source := t.TempDir()
+	writeFile(t, filepath.Join(source, "data", "file.txt"), "contents")
+	if err := os.Symlink("file.txt", filepath.Join(source, "data", "link")); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	paths := []string{
+		source,
+		filepath.Join(source, "data"),
+		filepath.Join(source, "data", "file.txt"),
+		filepath.Join(source, "data", "link"),
+	}
+	virtualFiles := []virtualFile{
+		{
+			path: filepath.Join(source, "dump.sql"),
+			size: int64(len("dumped")),
+			open: func() (io.ReadCloser, error) {
+				return io.NopCloser(strings.NewReader("dumped")), nil
+			},
+		},
+	}
+
+	for _, compression := range []string{"gz", "zst", "none"} {
+		for _, encryption := range []string{"gpg", "age", "none"} {
+			t.Run(compression+"/"+encryption, func(t *testing.T) {
+				c := &Config{}
+				switch encryption {
+				case "gpg":
+					c.GpgPassphrase = "test"
+				case "age":
+					c.AgePassphrase = "test"
+				}
+				s := &script{c: c, file: "/tmp/backup.tar"}
+
+				var archive bytes.Buffer
+				var w io.WriteCloser = &passThroughWriteCloser{&archive}
+				name := "backup.tar"
+				extension, encryptor, err := s.getEncryptor()
+				if err != nil {
+					t.Fatalf("Unexpected error %v", err)
+				}
+				if encryptor != nil {
+					name = name + "." + extension
+					if w, err = encryptor(&archive); err != nil {
+						t.Fatalf("Unexpected error %v", err)
+					}
+				}
+				if _, err := writeArchive(paths, nil, virtualFiles, filepath.Dir(source), w, compression, 1); err != nil {
+					t.Fatalf("Unexpected error %v", err)
+				}
+				if err := w.Close(); err != nil {
+					t.Fatalf("Unexpected error %v", err)
+				}
+
+				plaintext, err := s.decryptArchive(name, &archive)
+				if err != nil {
+					t.Fatalf("Unexpected error %v", err)
+				}
+				decompressed, err := getDecompressionReader(plaintext)
+				if err != nil {
+					t.Fatalf("Unexpected error %v", err)
+				}
+				target := t.TempDir()
+				numEntries, err := extractArchive(decompressed, target)
+				if err != nil {
+					t.Fatalf("Unexpected error %v", err)
+				}
+				if numEntries != len(paths)+len(virtualFiles) {
+					t.Errorf("Expected %d entries, got %d", len(paths)+len(virtualFiles), numEntries)
+				}
+				expectContent(t, filepath.Join(target, filepath.Base(source), "dump.sql"), "dumped")
+				restored := filepath.Join(target, filepath.Base(source), "data")
+				expectContent(t, filepath.Join(restored, "file.txt"), "contents")
+				if link, err := os.Readlink(filepath.Join(restored, "link")); err != nil || link != "file.txt" {
+					t.Errorf("Expected symlink to file.txt, got %s and %v", link, err)
+				}
+			})
+		}
+	}
+}
+
+func writeFile(t *testing.T, location, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(location), 0755); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := os.WriteFile(location, []byte(content), 0644); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+}
+
+func expectContent(t *testing.T, location, expected string) {
+	t.Helper()
+	content, err := os.ReadFile(location)
+	if err != nil {
+		t.Errorf("Unexpected error reading %s: %v", location, err)
+		return
+	}
+	if string(content) != expected {
+		t.Errorf("Expected %s to contain %q, got %q", location, expected, content)
+	}
+}
+
+func expectMissing(t *testing.T, location string) {
+	t.Helper()
+	if _, err := os.Lstat(location); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected %s not to exist, got %v", location, err)
+	}
+}
@@ -4,21 +4,31 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/offen/docker-volume-backup/internal/errwrap"
 	"github.com/robfig/cron/v3"
 )
 
 type command struct {
+	sync.Mutex
 	logger    *slog.Logger
-	schedules []cron.EntryID
+	schedules []schedule
+	configs   map[string]*Config
 	cr        *cron.Cron
 	reload    chan struct{}
+	metrics   *metricsRegistry
+	jobs      int
+	latestJob *job
 }
 
 func newCommand() *command {
@@ -43,7 +53,7 @@ func (c *command) runAsCommand() error {
 		for _, w := range warnings {
 			c.logger.Warn(w)
 		}
-		if err := runScript(config); err != nil {
+		if _, err := runScript(config); err != nil {
 			return errwrap.Wrap(err, "error running script")
 		}
 	}
@@ -51,25 +61,45 @@ func (c *command) runAsCommand() error {
 	return nil
 }
 
+// cronParser parses the cron expressions of all schedules, which can
+// optionally define seconds.
+var cronParser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
 type foregroundOpts struct {
 	profileCronExpression string
+	metricsAddress        string
+	apiAddress            string
 }
 
 // runInForeground starts the program as a long running process, scheduling
 // a job for each configuration that is available.
 func (c *command) runInForeground(opts foregroundOpts) error {
-	c.cr = cron.New(
-		cron.WithParser(
-			cron.NewParser(
-				cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
-			),
-		),
-	)
+	c.cr = cron.New(cron.WithParser(cronParser))
 
+	if opts.metricsAddress != "" {
+		c.metrics = newMetricsRegistry()
+		shutdown, err := c.serveMetrics(opts.metricsAddress)
+		if err != nil {
+			return errwrap.Wrap(err, "error serving metrics")
+		}
+		defer shutdown()
+	}
+
+	c.reload = make(chan struct{}, 1)
 	if err := c.schedule(configStrategyConfd); err != nil {
 		return errwrap.Wrap(err, "error scheduling")
 	}
 
+	if opts.apiAddress != "" {
+		shutdown, err := c.serveAPI(opts.apiAddress)
+		if err != nil {
+			return errwrap.Wrap(err, "error serving API")
+		}
+		defer shutdown()
+	}
+
 	if opts.profileCronExpression != "" {
 		if _, err := c.cr.AddFunc(opts.profileCronExpression, c.profile); err != nil {
 			return errwrap.Wrap(err, "error adding profiling job")
@@ -77,7 +107,6 @@ func (c *command) runInForeground(opts foregroundOpts) error {
 	}
 
 	var quit = make(chan os.Signal, 1)
-	c.reload = make(chan struct{}, 1)
 	signal.Notify(quit, syscall.SIGTERM, syscall.SIGINT)
 	c.cr.Start()
 
@@ -88,27 +117,38 @@ func (c *command) runInForeground(opts foregroundOpts) error {
 			<-ctx.Done()
 			return nil
 		case <-c.reload:
-			if err := c.schedule(configStrategyConfd); err != nil {
-				return errwrap.Wrap(err, "error reloading configuration")
-			}
+			// Errors are logged, and the previous schedules are kept.
+			_ = c.reloadSchedules()
 		}
 	}
 }
 
-// schedule wipes all existing schedules and enqueues all schedules available
-// using the given configuration strategy
-func (c *command) schedule(strategy configStrategy) error {
-	for _, id := range c.schedules {
-		c.cr.Remove(id)
+// reloadSchedules replaces all schedules with the ones defined in the
+// current configuration. In case the configuration is invalid, the error is
+// logged and returned, and the existing schedules are kept.
+func (c *command) reloadSchedules() error {
+	if err := c.schedule(configStrategyConfd); err != nil {
+		c.logger.Error(
+			fmt.Sprintf("Unexpected error reloading configuration, keeping previous schedules: %v", errwrap.Unwrap(err)),
+			"error",
+			err,
+		)
+		return errwrap.Wrap(err, "error reloading configuration")
 	}
+	return nil
+}
 
+// schedule wipes all existing schedules and enqueues all schedules available
+// using the given configuration strategy. The configuration is loaded and
+// validated before existing schedules are removed, so they are kept in case
+// it is invalid.
+func (c *command) schedule(strategy configStrategy) error {
 	configurations, err := sourceConfiguration(strategy)
 	if err != nil {
 		return errwrap.Wrap(err, "error sourcing configuration")
 	}
 
-	for _, cfg := range configurations {
-		config := cfg
+	for _, config := range configurations {
 		warnings, warnErr := config.timezoneDeprecationWarnings()
 		if warnErr != nil {
 			return errwrap.Wrap(warnErr, "error collecting startup warnings")
@@ -116,7 +156,27 @@ func (c *command) schedule(strategy configStrategy) error {
 		for _, w := range warnings {
 			c.logger.Warn(w)
 		}
+		expressions := []string{config.BackupCronExpression}
+		if config.BackupVerifyCronExpression != "" {
+			expressions = append(expressions, config.BackupVerifyCronExpression)
+		}
+		for _, expression := range expressions {
+			if _, err := cronParser.Parse(expression); err != nil {
+				return errwrap.Wrap(err, fmt.Sprintf("error parsing schedule %s of %s", expression, metricsSource(config)))
+			}
+		}
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	for _, s := range c.schedules {
+		c.cr.Remove(s.id)
+	}
+	c.schedules = nil
+	c.configs = map[string]*Config{}
 
+	for _, cfg := range configurations {
+		config := cfg
 		id, err := c.cr.AddFunc(config.BackupCronExpression, func() {
 			c.logger.Info(
 				fmt.Sprintf(
@@ -125,34 +185,82 @@ func (c *command) schedule(strategy configStrategy) error {
 				),
 			)
 
-			if err := runScript(config); err != nil {
-				c.logger.Error(
-					fmt.Sprintf(
-						"Unexpected error running schedule %s: %v",
-						config.BackupCronExpression,
-						errwrap.Unwrap(err),
-					),
-					"error",
-					err,
-				)
-			}
+			c.runJob(c.newJob(config, "schedule"), config)
 		})
 
 		if err != nil {
 			return errwrap.Wrap(err, fmt.Sprintf("error adding schedule %s", config.BackupCronExpression))
 		}
 		c.logger.Info(fmt.Sprintf("Successfully scheduled backup %s with expression %s", config.source, config.BackupCronExpression))
+		if c.metrics != nil {
+			c.metrics.track(metricsSource(config))
+		}
 		if ok := checkCronSchedule(config.BackupCronExpression); !ok {
 			c.logger.Warn(
 				fmt.Sprintf("Scheduled cron expression %s will never run, is this intentional?", config.BackupCronExpression),
 			)
 		}
-		c.schedules = append(c.schedules, id)
+		c.schedules = append(c.schedules, schedule{id: id, source: metricsSource(config), kind: "backup", expression: config.BackupCronExpression})
+		c.configs[metricsSource(config)] = config
+
+		if config.BackupVerifyCronExpression == "" {
+			continue
+		}
+		verifyID, err := c.cr.AddFunc(config.BackupVerifyCronExpression, func() {
+			c.logger.Info(
+				fmt.Sprintf(
+					"Now verifying latest backups on schedule %s",
+					config.BackupVerifyCronExpression,
+				),
+			)
+
+			if err := runVerification(config); err != nil {
+				c.logger.Error(
+					fmt.Sprintf(
+						"Unexpected error verifying backups on schedule %s: %v",
+						config.BackupVerifyCronExpression,
+						errwrap.Unwrap(err),
+					),
+					"error",
+					err,
+				)
+			}
+		})
+		if err != nil {
+			return errwrap.Wrap(err, fmt.Sprintf("error adding verification schedule %s", config.BackupVerifyCronExpression))
+		}
+		c.logger.Info(fmt.Sprintf("Successfully scheduled verification %s with expression %s", config.source, config.BackupVerifyCronExpression))
+		c.schedules = append(c.schedules, schedule{id: verifyID, source: metricsSource(config), kind: "verify", expression: config.BackupVerifyCronExpression})
 	}
 
 	return nil
 }
 
+// serveMetrics exposes Prometheus metrics about all backup runs on the given
+// address. The returned function stops the server.
+func (c *command) serveMetrics(address string) (func(), error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, errwrap.Wrap(err, fmt.Sprintf("error listening on %s", address))
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", c.metrics)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			c.logger.Error(
+				fmt.Sprintf("Unexpected error serving metrics: %v", err),
+				"error",
+				err,
+			)
+		}
+	}()
+	c.logger.Info(fmt.Sprintf("Serving metrics on %s/metrics", listener.Addr()))
+	return func() {
+		_ = server.Close()
+	}, nil
+}
+
 // must exits the program when passed an error. It should be the only
 // place where the application exits forcefully.
 func (c *command) must(err error) {
@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"text/template"
@@ -36,26 +37,51 @@ type Config struct {
 	BackupCompression                    CompressionType `split_words:"true" default:"gz"`
 	GzipParallelism                      WholeNumber     `split_words:"true" default:"1"`
 	BackupSources                        string          `split_words:"true" default:"/backup"`
+	BackupSplitByDirectory               bool            `split_words:"true"`
 	BackupFilename                       string          `split_words:"true" default:"backup-%Y-%m-%dT%H-%M-%S.{{ .Extension }}"`
 	BackupFilenameExpand                 bool            `split_words:"true"`
 	BackupLatestSymlink                  string          `split_words:"true"`
 	BackupArchive                        string          `split_words:"true" default:"/archive"`
 	BackupCronExpression                 string          `split_words:"true" default:"@daily"`
+	BackupVerifyCronExpression           string          `split_words:"true"`
+	BackupVerifyUploads                  VerifyUploads   `split_words:"true" default:"download"`
 	BackupJitter                         time.Duration   `split_words:"true" default:"0s"`
 	BackupRetentionDays                  int32           `split_words:"true" default:"-1"`
+	BackupRetentionCount                 int             `split_words:"true"`
+	BackupRetentionKeepLast              int             `split_words:"true"`
+	BackupRetentionKeepDaily             int             `split_words:"true"`
+	BackupRetentionKeepWeekly            int             `split_words:"true"`
+	BackupRetentionKeepMonthly           int             `split_words:"true"`
+	BackupRetentionKeepYearly            int             `split_words:"true"`
 	BackupPruningLeeway                  time.Duration   `split_words:"true" default:"1m"`
 	BackupPruningPrefix                  string          `split_words:"true"`
 	BackupStopContainerLabel             string          `split_words:"true"`
 	BackupStopDuringBackupLabel          string          `split_words:"true" default:"true"`
 	BackupStopDuringBackupNoRestartLabel string          `split_words:"true" default:"true"`
+	BackupStopDuringBackupMatchMounts    bool            `split_words:"true"`
+	BackupPauseDuringBackupLabel         string          `split_words:"true" default:"true"`
 	BackupStopServiceTimeout             time.Duration   `split_words:"true" default:"5m"`
+	BackupHealthcheckTimeout             time.Duration   `split_words:"true" default:"5m"`
+	BackupVolumesLabel                   string          `split_words:"true" default:"true"`
+	BackupVolumesHelperImage             string          `split_words:"true" default:"alpine:3"`
 	BackupFromSnapshot                   bool            `split_words:"true"`
+	BackupStreaming                      bool            `split_words:"true"`
+	BackupIncremental                    bool            `split_words:"true"`
+	BackupIncrementalFullEvery           int             `split_words:"true" default:"7"`
+	BackupIncrementalStateFile           string          `split_words:"true"`
+	BackupRepository                     bool            `split_words:"true"`
+	BackupRepositoryKey                  string          `split_words:"true"`
 	BackupExcludeRegexp                  RegexpDecoder   `split_words:"true"`
 	BackupSkipBackendsFromPrune          []string        `split_words:"true"`
 	GpgPassphrase                        string          `split_words:"true"`
 	GpgPublicKeyRing                     string          `split_words:"true"`
 	AgePassphrase                        string          `split_words:"true"`
 	AgePublicKeys                        []string        `split_words:"true"`
+	GpgPrivateKeyRing                    string          `split_words:"true"`
+	GpgPrivateKeyPassphrase              string          `split_words:"true"`
+	AgeIdentities                        string          `split_words:"true"`
+	BackupManifestSigningKey             string          `split_words:"true"`
+	BackupManifestSigningKeyPassphrase   string          `split_words:"true"`
 	NotificationURLs                     []string        `envconfig:"NOTIFICATION_URLS"`
 	NotificationLevel                    string          `split_words:"true" default:"error"`
 	EmailNotificationRecipient           string          `split_words:"true"`
@@ -78,6 +104,15 @@ type Config struct {
 	SSHRemotePath                        string          `split_words:"true"`
 	ExecLabel                            string          `split_words:"true"`
 	ExecForwardOutput                    bool            `split_words:"true"`
+	ExecSpoolDirectory                   string          `split_words:"true"`
+	MetricsPushgatewayURL                string          `envconfig:"METRICS_PUSHGATEWAY_URL"`
+	MetricsTextfileDirectory             string          `split_words:"true"`
+	WebhookURLs                          []string        `envconfig:"WEBHOOK_URLS"`
+	WebhookEvents                        []string        `split_words:"true"`
+	WebhookHeaders                       HeaderMap       `split_words:"true"`
+	WebhookTimeout                       time.Duration   `split_words:"true" default:"10s"`
+	WebhookRetries                       int             `split_words:"true" default:"2"`
+	WebhookRetryInterval                 time.Duration   `split_words:"true" default:"5s"`
 	LockTimeout                          time.Duration   `split_words:"true" default:"60m"`
 	AzureStorageAccountName              string          `split_words:"true"`
 	AzureStoragePrimaryAccountKey        string          `split_words:"true"`
@@ -120,6 +155,25 @@ func (c *CompressionType) String() string {
 	return string(*c)
 }
 
+// VerifyUploads defines how uploaded archives are verified. "download" uses
+// server side checksums and falls back to downloading the archive again,
+// "checksum" only uses server side checksums and "none" skips verification.
+type VerifyUploads string
+
+func (v *VerifyUploads) Decode(value string) error {
+	switch value {
+	case "download", "checksum", "none":
+		*v = VerifyUploads(value)
+		return nil
+	default:
+		return errwrap.Wrap(nil, fmt.Sprintf("error decoding upload verification mode %s", value))
+	}
+}
+
+func (v *VerifyUploads) String() string {
+	return string(*v)
+}
+
 type CertDecoder struct {
 	Cert *x509.Certificate
 }
@@ -195,6 +249,27 @@ func (n *WholeNumber) Int() int {
 	return int(*n)
 }
 
+// HeaderMap is a type that can be used to decode a list of HTTP headers in
+// the format `Name: value`, separated by newlines. Header values cannot
+// contain newlines, so other than commas they are unambiguous.
+type HeaderMap map[string]string
+
+func (h *HeaderMap) Decode(v string) error {
+	headers := HeaderMap{}
+	for _, header := range strings.Split(v, "\n") {
+		if strings.TrimSpace(header) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(header, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return errwrap.Wrap(nil, fmt.Sprintf("error decoding header %s, expected format `Name: value`", header))
+		}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	*h = headers
+	return nil
+}
+
 type envVarLookup struct {
 	ok    bool
 	key   string
@@ -278,6 +353,16 @@ func (c *Config) resolve() (reset func() error, warnings []string, err error) {
 		)
 	}
 
+	if c.BackupRetentionCount != 0 {
+		if c.BackupRetentionKeepLast != 0 {
+			warnings = append(warnings,
+				"Both BACKUP_RETENTION_COUNT and BACKUP_RETENTION_KEEP_LAST have been set, ignoring BACKUP_RETENTION_COUNT.",
+			)
+		} else {
+			c.BackupRetentionKeepLast = c.BackupRetentionCount
+		}
+	}
+
 	if c.BackupStopDuringBackupLabel != "" && c.BackupStopContainerLabel != "" {
 		err = errwrap.Wrap(nil, "both BACKUP_STOP_DURING_BACKUP_LABEL and BACKUP_STOP_CONTAINER_LABEL have been set, cannot continue")
 		return
@@ -290,19 +375,58 @@ func (c *Config) resolve() (reset func() error, warnings []string, err error) {
 		c.BackupStopDuringBackupLabel = c.BackupStopContainerLabel
 	}
 
+	if c.BackupRepository && (c.BackupStreaming || c.BackupIncremental) {
+		err = errwrap.Wrap(nil, "BACKUP_REPOSITORY cannot be combined with BACKUP_STREAMING or BACKUP_INCREMENTAL, cannot continue")
+		return
+	}
+
+	if c.BackupIncrementalStateFile == "" {
+		// Each configuration keeps its own state so that incremental backups
+		// are never based on archives created by another configuration.
+		c.BackupIncrementalStateFile = "/var/lib/docker-volume-backup/incremental-state.json"
+		if source := metricsSource(c); source != "env" {
+			c.BackupIncrementalStateFile = fmt.Sprintf("/var/lib/docker-volume-backup/incremental-state-%s.json", source)
+		}
+	}
+
+	if c.BackupSplitByDirectory && c.BackupIncremental {
+		err = errwrap.Wrap(nil, "BACKUP_SPLIT_BY_DIRECTORY cannot be combined with BACKUP_INCREMENTAL, cannot continue")
+		return
+	}
+
+	for _, event := range c.WebhookEvents {
+		phase, step, _ := strings.Cut(event, "-")
+		if !slices.Contains(lifecyclePhases, lifecyclePhase(phase)) || (step != "pre" && step != "post") {
+			err = errwrap.Wrap(nil, fmt.Sprintf("unknown webhook event %s in WEBHOOK_EVENTS, cannot continue", event))
+			return
+		}
+	}
+
 	tmplFileName, tErr := template.New("extension").Parse(c.BackupFilename)
 	if tErr != nil {
 		err = errwrap.Wrap(tErr, "unable to parse backup file extension template")
 		return
 	}
 
+	// In case backups are split by directory, the name of the directory is
+	// only known when creating the archive, so the placeholder is kept as is.
+	var source string
+	if c.BackupSplitByDirectory {
+		source = sourcePlaceholder
+	}
+
 	var bf bytes.Buffer
 	if tErr := tmplFileName.Execute(&bf, map[string]string{
+		"Source": source,
 		"Extension": func() string {
+			format := "tar"
+			if c.BackupRepository {
+				format = "snapshot"
+			}
 			if c.BackupCompression == "none" {
-				return "tar"
+				return format
 			}
-			return fmt.Sprintf("tar.%s", c.BackupCompression)
+			return fmt.Sprintf("%s.%s", format, c.BackupCompression)
 		}(),
 	}); tErr != nil {
 		err = errwrap.Wrap(tErr, "error executing backup file extension template")
@@ -310,6 +434,36 @@ func (c *Config) resolve() (reset func() error, warnings []string, err error) {
 	}
 	c.BackupFilename = bf.String()
 
+	if c.BackupSplitByDirectory {
+		if !strings.Contains(c.BackupFilename, sourcePlaceholder) {
+			err = errwrap.Wrap(nil, "BACKUP_FILENAME needs to contain {{ .Source }} when BACKUP_SPLIT_BY_DIRECTORY is set, cannot continue")
+			return
+		}
+		tmplPrefix, tErr := template.New("prefix").Parse(c.BackupPruningPrefix)
+		if tErr != nil {
+			err = errwrap.Wrap(tErr, "unable to parse pruning prefix template")
+			return
+		}
+		var pf bytes.Buffer
+		if tErr := tmplPrefix.Execute(&pf, map[string]string{"Source": sourcePlaceholder}); tErr != nil {
+			err = errwrap.Wrap(tErr, "error executing pruning prefix template")
+			return
+		}
+		c.BackupPruningPrefix = pf.String()
+
+		if !strings.Contains(c.BackupPruningPrefix, sourcePlaceholder) {
+			// Retention would be applied to the archives of all directories
+			// combined otherwise, so the prefix is derived from the literal
+			// part of the file name.
+			derived, _, _ := strings.Cut(c.BackupFilename, "%")
+			if !strings.Contains(derived, sourcePlaceholder) || !strings.HasPrefix(derived, c.BackupPruningPrefix) {
+				err = errwrap.Wrap(nil, "BACKUP_PRUNING_PREFIX needs to contain {{ .Source }} when BACKUP_SPLIT_BY_DIRECTORY is set and it cannot be derived from BACKUP_FILENAME, cannot continue")
+				return
+			}
+			c.BackupPruningPrefix = derived
+		}
+	}
+
 	if c.AzureStorageEndpoint != "" {
 		endpointTemplate, tErr := template.New("endpoint").Parse(c.AzureStorageEndpoint)
 		if tErr != nil {
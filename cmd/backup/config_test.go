@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestResolveIncrementalStateFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		expected string
+	}{
+		{
+			"environment",
+			Config{source: "from environment"},
+			"/var/lib/docker-volume-backup/incremental-state.json",
+		},
+		{
+			"conf.d",
+			Config{source: "01daily.env"},
+			"/var/lib/docker-volume-backup/incremental-state-01daily.env.json",
+		},
+		{
+			"explicit",
+			Config{source: "01daily.env", BackupIncrementalStateFile: "/state/daily.json"},
+			"/state/daily.json",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := test.config
+			c.NotificationLevel = "error"
+			c.BackupFilename = "backup.{{ .Extension }}"
+			reset, _, err := c.resolve()
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			defer func() { _ = reset() }()
+			if c.BackupIncrementalStateFile != test.expected {
+				t.Errorf("Expected %s, got %s", test.expected, c.BackupIncrementalStateFile)
+			}
+		})
+	}
+}
@@ -4,10 +4,16 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path"
+	"time"
 
 	"github.com/offen/docker-volume-backup/internal/errwrap"
+	"github.com/offen/docker-volume-backup/internal/storage"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -15,27 +21,95 @@ import (
 // as per the given configuration.
 func (s *script) copyArchive() error {
 	_, name := path.Split(s.file)
-	if stat, err := os.Stat(s.file); err != nil {
+	stat, err := os.Stat(s.file)
+	if err != nil {
 		return errwrap.Wrap(err, "unable to stat backup file")
-	} else {
-		size := stat.Size()
-		s.stats.BackupFile = BackupFileStats{
-			Size:     uint64(size),
-			Name:     name,
-			FullPath: s.file,
-		}
+	}
+	size := uint64(stat.Size())
+	s.setBackupFile(BackupFileStats{
+		Size:     size,
+		Name:     name,
+		FullPath: s.file,
+	})
+
+	sums, err := checksumFile(s.file)
+	if err != nil {
+		return errwrap.Wrap(err, "error computing checksums of backup file")
 	}
 
 	eg := errgroup.Group{}
 	for _, backend := range s.storages {
 		b := backend
 		eg.Go(func() error {
-			return b.Copy(s.file)
+			start := time.Now()
+			if err := b.Copy(s.file); err != nil {
+				return err
+			}
+			s.recordUpload(b.Name(), size, time.Since(start))
+			return s.verifyUpload(b, name, sums)
 		})
 	}
 	if err := eg.Wait(); err != nil {
 		return errwrap.Wrap(err, "error copying archive")
 	}
 
+	if err := s.uploadManifest(); err != nil {
+		return errwrap.Wrap(err, "error uploading manifest")
+	}
+	return nil
+}
+
+// recordUpload adds the given upload to the stats of the given backend. In
+// case backups are split by directory, uploads of all archives are summed up.
+func (s *script) recordUpload(backend string, size uint64, took time.Duration) {
+	s.stats.Lock()
+	defer s.stats.Unlock()
+	storage := s.stats.Storages[backend]
+	storage.UploadedBytes += size
+	storage.UploadDuration += took
+	s.stats.Storages[backend] = storage
+}
+
+// verifyUpload makes sure the archive of the given name that has been
+// uploaded to b matches the given checksums and uploads the checksum sidecar
+// file next to it.
+func (s *script) verifyUpload(b storage.Backend, name string, sums storage.Checksums) error {
+	verified := false
+	if s.c.BackupVerifyUploads != "none" {
+		var err error
+		verified, err = storage.VerifyUpload(b, name, sums, s.c.BackupVerifyUploads == "download")
+		if err != nil {
+			return errwrap.Wrap(err, fmt.Sprintf("error verifying upload to %s", b.Name()))
+		}
+	}
+	if err := b.Upload(name+storage.ChecksumSuffix, bytes.NewReader(sums.Sidecar(name))); err != nil {
+		return errwrap.Wrap(err, fmt.Sprintf("error uploading checksum to %s", b.Name()))
+	}
+	if !verified {
+		s.logger.Info(
+			fmt.Sprintf("Skipped verifying checksum of backup `%s` in %s.", name, b.Name()),
+		)
+		return nil
+	}
+	s.logger.Info(
+		fmt.Sprintf("Verified checksum of backup `%s` in %s.", name, b.Name()),
+	)
 	return nil
 }
+
+// checksumFile computes the checksums of the file at the given location.
+func checksumFile(file string) (_ storage.Checksums, returnErr error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return storage.Checksums{}, errwrap.Wrap(err, "error opening file")
+	}
+	defer func() {
+		returnErr = errors.Join(returnErr, f.Close())
+	}()
+
+	w := storage.NewChecksumWriter()
+	if _, err := io.Copy(w, f); err != nil {
+		return storage.Checksums{}, errwrap.Wrap(err, "error reading file")
+	}
+	return w.Sum(), nil
+}
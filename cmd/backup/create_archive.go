@@ -7,18 +7,75 @@ import (
 	"fmt"
 	"io/fs"
 	"path/filepath"
+	"slices"
 
 	"github.com/offen/docker-volume-backup/internal/errwrap"
 	"github.com/otiai10/copy"
 )
 
 // createArchive creates a tar archive of the configured backup location and
-// saves it to disk.
+// saves it to disk. In repository mode, a snapshot is created instead.
 func (s *script) createArchive() error {
-	backupSources := s.c.BackupSources
+	outputContainers, err := s.outputContainers()
+	if err != nil {
+		return errwrap.Wrap(err, "error looking up containers to capture output of")
+	}
+
+	if s.c.BackupRepository {
+		return s.createSnapshot()
+	}
+
+	backupSources, filesEligibleForBackup, err := s.collectFilesForBackup()
+	if err != nil {
+		return errwrap.Wrap(err, "error collecting files for backup")
+	}
+
+	filesEligibleForBackup, dumpDirs, err := s.selectIncrementalFiles(backupSources, filesEligibleForBackup)
+	if err != nil {
+		return errwrap.Wrap(err, "error selecting files for incremental backup")
+	}
+
+	outputs, err := s.captureOutputs(outputContainers, backupSources)
+	if err != nil {
+		return errwrap.Wrap(err, "error capturing command output")
+	}
 
-	if s.c.BackupFromSnapshot {
-		backupSources = filepath.Join("/tmp", s.c.BackupSources)
+	tarFile := s.file
+	s.registerHook(hookLevelPlumbing, func(error) error {
+		if err := remove(tarFile); err != nil {
+			return errwrap.Wrap(err, "error removing tar file")
+		}
+		s.logger.Info(
+			fmt.Sprintf("Removed tar file `%s`.", tarFile),
+		)
+		return nil
+	})
+
+	archived, err := createArchive(filesEligibleForBackup, dumpDirs, outputs, backupSources, tarFile, s.c.BackupCompression.String(), s.c.GzipParallelism.Int())
+	if err != nil {
+		return errwrap.Wrap(err, "error compressing backup folder")
+	}
+	s.archivedFiles = archived
+
+	s.logger.Info(
+		fmt.Sprintf("Created backup of `%s` at `%s`.", backupSources, tarFile),
+	)
+	return nil
+}
+
+// collectFilesForBackup returns the location of the files to back up and all
+// paths within it that are not excluded. In case a snapshot is requested, it
+// is created before walking the location. Copies of discovered volumes are
+// collected too in case backups are not split by directory.
+func (s *script) collectFilesForBackup() (string, []string, error) {
+	backupSources := s.backupSources
+	roots := []string{backupSources}
+
+	switch {
+	case slices.Contains(s.volumeCopies, s.backupSources):
+		// Copies of volumes are snapshots already.
+	case s.c.BackupFromSnapshot:
+		backupSources = filepath.Join("/tmp", s.backupSources)
 		// copy before compressing guard against a situation where backup folder's content are still growing.
 		s.registerHook(hookLevelPlumbing, func(error) error {
 			if err := remove(backupSources); err != nil {
@@ -29,54 +86,44 @@ func (s *script) createArchive() error {
 			)
 			return nil
 		})
-		if err := copy.Copy(s.c.BackupSources, backupSources, copy.Options{
+		if err := copy.Copy(s.backupSources, backupSources, copy.Options{
 			PreserveTimes: true,
 			PreserveOwner: true,
 		}); err != nil {
-			return errwrap.Wrap(err, "error creating snapshot")
+			return "", nil, errwrap.Wrap(err, "error creating snapshot")
 		}
 		s.logger.Info(
-			fmt.Sprintf("Created snapshot of `%s` at `%s`.", s.c.BackupSources, backupSources),
+			fmt.Sprintf("Created snapshot of `%s` at `%s`.", s.backupSources, backupSources),
 		)
-	}
-
-	tarFile := s.file
-	s.registerHook(hookLevelPlumbing, func(error) error {
-		if err := remove(tarFile); err != nil {
-			return errwrap.Wrap(err, "error removing tar file")
-		}
-		s.logger.Info(
-			fmt.Sprintf("Removed tar file `%s`.", tarFile),
-		)
-		return nil
-	})
-
-	backupPath, err := filepath.Abs(stripTrailingSlashes(backupSources))
-	if err != nil {
-		return errwrap.Wrap(err, "error getting absolute path")
+		// The snapshot is created in the same location volumes are copied
+		// to, so it contains the copies already in case backups are not
+		// split by directory.
+		roots = []string{backupSources}
+	case !s.c.BackupSplitByDirectory:
+		roots = append(roots, s.volumeCopies...)
 	}
 
 	var filesEligibleForBackup []string
-	if err := filepath.WalkDir(backupPath, func(path string, di fs.DirEntry, err error) error {
+	for _, root := range roots {
+		backupPath, err := filepath.Abs(stripTrailingSlashes(root))
 		if err != nil {
-			return err
+			return "", nil, errwrap.Wrap(err, "error getting absolute path")
 		}
 
-		if s.c.BackupExcludeRegexp.Re != nil && s.c.BackupExcludeRegexp.Re.MatchString(path) {
+		if err := filepath.WalkDir(backupPath, func(path string, di fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if s.c.BackupExcludeRegexp.Re != nil && s.c.BackupExcludeRegexp.Re.MatchString(path) {
+				return nil
+			}
+			filesEligibleForBackup = append(filesEligibleForBackup, path)
 			return nil
+		}); err != nil {
+			return "", nil, errwrap.Wrap(err, "error walking filesystem tree")
 		}
-		filesEligibleForBackup = append(filesEligibleForBackup, path)
-		return nil
-	}); err != nil {
-		return errwrap.Wrap(err, "error walking filesystem tree")
 	}
 
-	if err := createArchive(filesEligibleForBackup, backupSources, tarFile, s.c.BackupCompression.String(), s.c.GzipParallelism.Int()); err != nil {
-		return errwrap.Wrap(err, "error compressing backup folder")
-	}
-
-	s.logger.Info(
-		fmt.Sprintf("Created backup of `%s` at `%s`.", backupSources, tarFile),
-	)
-	return nil
+	return backupSources, filesEligibleForBackup, nil
 }
@@ -0,0 +1,119 @@
+// Copyright 2026 - offen.software <hioffen@posteo.de>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	openpgp "github.com/ProtonMail/go-crypto/openpgp/v2"
+	"github.com/offen/docker-volume-backup/internal/errwrap"
+)
+
+// decryptArchive wraps the given reader so that it returns the plaintext of
+// the archive with the given name. The encryption scheme is inferred from the
+// extension that has been added by encryptArchive. In case the archive is not
+// encrypted, the reader is returned unchanged.
+func (s *script) decryptArchive(name string, r io.Reader) (io.Reader, error) {
+	switch {
+	case strings.HasSuffix(name, ".gpg"):
+		return s.decryptWithGPG(r)
+	case strings.HasSuffix(name, ".age"):
+		identities, err := s.getConfiguredAgeIdentities()
+		if err != nil {
+			return nil, errwrap.Wrap(err, "failed to get configured age identities")
+		}
+		plaintext, err := age.Decrypt(r, identities...)
+		if err != nil {
+			return nil, errwrap.Wrap(err, "error decrypting archive using age")
+		}
+		return plaintext, nil
+	default:
+		return r, nil
+	}
+}
+
+func (s *script) getConfiguredAgeIdentities() ([]age.Identity, error) {
+	if s.c.AgePassphrase == "" && s.c.AgeIdentities == "" {
+		return nil, fmt.Errorf("no age identities configured")
+	}
+	if s.c.AgePassphrase != "" {
+		if s.c.AgeIdentities != "" {
+			return nil, fmt.Errorf("age decryption must only be enabled via passphrase or identities, not both")
+		}
+		i, err := age.NewScryptIdentity(s.c.AgePassphrase)
+		if err != nil {
+			return nil, errwrap.Wrap(err, "failed to create scrypt identity from age passphrase")
+		}
+		return []age.Identity{i}, nil
+	}
+
+	// SSH private keys are PEM encoded, native age identities are
+	// given as one key per line.
+	if strings.Contains(s.c.AgeIdentities, "-----BEGIN") {
+		i, err := agessh.ParseIdentity([]byte(s.c.AgeIdentities))
+		if err != nil {
+			return nil, errwrap.Wrap(err, "failed to parse ssh identity")
+		}
+		return []age.Identity{i}, nil
+	}
+	identities, err := age.ParseIdentities(strings.NewReader(s.c.AgeIdentities))
+	if err != nil {
+		return nil, errwrap.Wrap(err, "failed to parse age identities")
+	}
+	return identities, nil
+}
+
+func (s *script) decryptWithGPG(r io.Reader) (io.Reader, error) {
+	if s.c.GpgPassphrase == "" && s.c.GpgPrivateKeyRing == "" {
+		return nil, errwrap.Wrap(nil, "archive is encrypted using gpg, but neither a passphrase nor a private key ring is configured")
+	}
+
+	var keyRing openpgp.EntityList
+	if s.c.GpgPrivateKeyRing != "" {
+		entityList, err := openpgp.ReadArmoredKeyRing(strings.NewReader(s.c.GpgPrivateKeyRing))
+		if err != nil {
+			return nil, errwrap.Wrap(err, "error parsing armored private key ring")
+		}
+		if s.c.GpgPrivateKeyPassphrase != "" {
+			for _, entity := range entityList {
+				if err := entity.DecryptPrivateKeys([]byte(s.c.GpgPrivateKeyPassphrase)); err != nil {
+					return nil, errwrap.Wrap(err, "error decrypting private keys")
+				}
+			}
+		}
+		keyRing = entityList
+	}
+
+	// Asymmetrically encrypted archives are armored, symmetrically encrypted
+	// ones are not.
+	br := bufio.NewReader(r)
+	var ciphertext io.Reader = br
+	if head, _ := br.Peek(len("-----BEGIN PGP")); bytes.Equal(head, []byte("-----BEGIN PGP")) {
+		block, err := armor.Decode(br)
+		if err != nil {
+			return nil, errwrap.Wrap(err, "error decoding armored archive")
+		}
+		ciphertext = block.Body
+	}
+
+	promptCalled := false
+	md, err := openpgp.ReadMessage(ciphertext, keyRing, func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+		if !symmetric || s.c.GpgPassphrase == "" || promptCalled {
+			return nil, errwrap.Wrap(nil, "unable to decrypt archive using the configured keys")
+		}
+		promptCalled = true
+		return []byte(s.c.GpgPassphrase), nil
+	}, nil)
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error decrypting archive using gpg")
+	}
+	return md.UnverifiedBody, nil
+}
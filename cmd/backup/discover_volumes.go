@@ -0,0 +1,200 @@
+// Copyright 2026 - offen.software <hioffen@posteo.de>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	ctr "github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/api/types/mount"
+	"github.com/moby/moby/api/types/volume"
+	"github.com/moby/moby/client"
+	"github.com/offen/docker-volume-backup/internal/errwrap"
+)
+
+// discoveredVolumes returns the names of all volumes that are mounted by the
+// given containers or that are contained in the given list of volumes.
+func discoveredVolumes(containers []ctr.Summary, volumes []volume.Volume) []string {
+	var names []string
+	for _, c := range containers {
+		for _, m := range c.Mounts {
+			if m.Type == mount.TypeVolume && m.Name != "" {
+				names = append(names, m.Name)
+			}
+		}
+	}
+	for _, v := range volumes {
+		names = append(names, v.Name)
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// discoverVolumes returns the names of all volumes that are labeled for
+// backup, or that are mounted by containers that are labeled for backup.
+func (s *script) discoverVolumes() ([]string, error) {
+	if s.cli == nil {
+		return nil, nil
+	}
+
+	label := fmt.Sprintf("docker-volume-backup.volumes=%s", s.c.BackupVolumesLabel)
+	containers, err := s.cli.ContainerList(context.Background(), client.ContainerListOptions{
+		All:     true,
+		Filters: client.Filters{}.Add("label", label),
+	})
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error querying for containers")
+	}
+	volumes, err := s.cli.VolumeList(context.Background(), client.VolumeListOptions{
+		Filters: client.Filters{}.Add("label", label),
+	})
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error querying for volumes")
+	}
+	return discoveredVolumes(containers.Items, volumes.Items), nil
+}
+
+// copyDiscoveredVolumes copies the contents of all discovered volumes into a
+// scratch directory below /tmp, which is removed after the run has finished.
+// The copies are archived as if they were located in BACKUP_SOURCES. The
+// volumes are read using the Docker archive API of a helper container that
+// is created but never started.
+func (s *script) copyDiscoveredVolumes() error {
+	names, err := s.discoverVolumes()
+	if err != nil {
+		return errwrap.Wrap(err, "error discovering volumes")
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	s.logger.Info(
+		fmt.Sprintf("Discovered %d volume(s) labeled docker-volume-backup.volumes=%s: %v.", len(names), s.c.BackupVolumesLabel, names),
+	)
+
+	for _, name := range names {
+		location := filepath.Join(s.c.BackupSources, name)
+		if _, err := os.Lstat(location); !errors.Is(err, os.ErrNotExist) {
+			return errwrap.Wrap(err, fmt.Sprintf("cannot back up volume %s as `%s` already exists", name, location))
+		}
+	}
+	// The archive is expected to contain BACKUP_SOURCES, even if nothing
+	// is mounted there.
+	if err := os.MkdirAll(s.c.BackupSources, 0755); err != nil {
+		return errwrap.Wrap(err, fmt.Sprintf("error creating `%s`", s.c.BackupSources))
+	}
+
+	// Entries are named by stripping the directory of the archive, so the
+	// copies are placed in the same location as snapshots are.
+	scratch := filepath.Join("/tmp", s.c.BackupSources)
+	if _, err := os.Lstat(scratch); errors.Is(err, os.ErrNotExist) {
+		s.registerHook(hookLevelPlumbing, func(error) error {
+			if err := remove(scratch); err != nil {
+				return errwrap.Wrap(err, "error removing copies of volumes")
+			}
+			return nil
+		})
+	}
+	if err := os.MkdirAll(scratch, 0700); err != nil {
+		return errwrap.Wrap(err, fmt.Sprintf("error creating `%s`", scratch))
+	}
+
+	if err := s.ensureImage(s.c.BackupVolumesHelperImage); err != nil {
+		return errwrap.Wrap(err, "error ensuring helper image is present")
+	}
+
+	var mounts []mount.Mount
+	for _, name := range names {
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeVolume,
+			Source:   name,
+			Target:   "/" + name,
+			ReadOnly: true,
+		})
+	}
+	helper, err := s.cli.ContainerCreate(context.Background(), client.ContainerCreateOptions{
+		Image:      s.c.BackupVolumesHelperImage,
+		HostConfig: &ctr.HostConfig{Mounts: mounts},
+	})
+	if err != nil {
+		return errwrap.Wrap(err, "error creating helper container")
+	}
+	defer func() {
+		if _, err := s.cli.ContainerRemove(context.Background(), helper.ID, client.ContainerRemoveOptions{Force: true}); err != nil {
+			s.logger.Warn(
+				fmt.Sprintf("Failed to remove helper container %s: %v", helper.ID, err),
+			)
+		}
+	}()
+
+	for _, name := range names {
+		if err := s.copyVolume(helper.ID, name, scratch); err != nil {
+			return errwrap.Wrap(err, fmt.Sprintf("error copying volume %s", name))
+		}
+	}
+	return nil
+}
+
+// copyVolume copies the volume of the given name that is mounted into the
+// given container to a directory of the same name in the given location.
+// The copy is removed after the run has finished, even if it failed.
+func (s *script) copyVolume(containerID, name, location string) (returnErr error) {
+	target := filepath.Join(location, name)
+	if _, err := os.Lstat(target); !errors.Is(err, os.ErrNotExist) {
+		return errwrap.Wrap(err, fmt.Sprintf("cannot copy volume as `%s` already exists", target))
+	}
+	s.registerHook(hookLevelPlumbing, func(error) error {
+		if err := remove(target); err != nil {
+			return errwrap.Wrap(err, "error removing copy of volume")
+		}
+		s.logger.Info(
+			fmt.Sprintf("Removed copy of volume %s at `%s`.", name, target),
+		)
+		return nil
+	})
+
+	result, err := s.cli.CopyFromContainer(context.Background(), containerID, client.CopyFromContainerOptions{
+		SourcePath: "/" + name,
+	})
+	if err != nil {
+		return errwrap.Wrap(err, "error reading volume")
+	}
+	defer func() {
+		returnErr = errors.Join(returnErr, result.Content.Close())
+	}()
+
+	// Entries are named after the mount point, so the contents end up in a
+	// directory named after the volume.
+	entries, err := extractArchive(result.Content, location)
+	if err != nil {
+		return errwrap.Wrap(err, "error extracting volume")
+	}
+	s.volumeCopies = append(s.volumeCopies, target)
+	s.logger.Info(
+		fmt.Sprintf("Copied %d entries of volume %s to `%s`.", entries, name, target),
+	)
+	return nil
+}
+
+// ensureImage pulls the given image in case it is not present yet.
+func (s *script) ensureImage(image string) error {
+	if _, err := s.cli.ImageInspect(context.Background(), image); err == nil {
+		return nil
+	}
+	s.logger.Info(
+		fmt.Sprintf("Pulling image %s.", image),
+	)
+	response, err := s.cli.ImagePull(context.Background(), image, client.ImagePullOptions{})
+	if err != nil {
+		return errwrap.Wrap(err, fmt.Sprintf("error pulling image %s", image))
+	}
+	if err := response.Wait(context.Background()); err != nil {
+		return errwrap.Wrap(err, fmt.Sprintf("error pulling image %s", image))
+	}
+	return nil
+}
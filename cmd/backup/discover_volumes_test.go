@@ -0,0 +1,147 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	ctr "github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/api/types/mount"
+	"github.com/moby/moby/api/types/volume"
+)
+
+func TestDiscoveredVolumes(t *testing.T) {
+	tests := []struct {
+		name       string
+		containers []ctr.Summary
+		volumes    []volume.Volume
+		expected   []string
+	}{
+		{
+			"nothing labeled",
+			nil,
+			nil,
+			nil,
+		},
+		{
+			"named volumes of containers",
+			[]ctr.Summary{
+				{Mounts: []ctr.MountPoint{
+					{Type: mount.TypeVolume, Name: "db_data", Destination: "/var/lib/postgresql/data"},
+					{Type: mount.TypeBind, Source: "/etc/app", Destination: "/etc/app"},
+					{Type: mount.TypeTmpfs, Destination: "/tmp"},
+				}},
+				{Mounts: []ctr.MountPoint{
+					{Type: mount.TypeVolume, Name: "app_data", Destination: "/data"},
+				}},
+			},
+			nil,
+			[]string{"app_data", "db_data"},
+		},
+		{
+			"labeled volumes",
+			[]ctr.Summary{
+				{Mounts: []ctr.MountPoint{
+					{Type: mount.TypeVolume, Name: "shared", Destination: "/data"},
+				}},
+			},
+			[]volume.Volume{
+				{Name: "shared"},
+				{Name: "archive"},
+			},
+			[]string{"archive", "shared"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := discoveredVolumes(test.containers, test.volumes); !reflect.DeepEqual(test.expected, result) {
+				t.Errorf("Expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestCollectVolumeCopies(t *testing.T) {
+	sources := t.TempDir()
+	writeFile(t, filepath.Join(sources, "app", "app.txt"), "app")
+	copies := t.TempDir()
+	volume := filepath.Join(copies, "data")
+	writeFile(t, filepath.Join(volume, "data.txt"), "data")
+
+	tests := []struct {
+		name          string
+		split         bool
+		backupSources string
+		expected      []string
+	}{
+		{
+			"single archive",
+			false,
+			sources,
+			[]string{
+				sources,
+				filepath.Join(sources, "app"),
+				filepath.Join(sources, "app", "app.txt"),
+				volume,
+				filepath.Join(volume, "data.txt"),
+			},
+		},
+		{
+			"split by directory",
+			true,
+			filepath.Join(sources, "app"),
+			[]string{
+				filepath.Join(sources, "app"),
+				filepath.Join(sources, "app", "app.txt"),
+			},
+		},
+		{
+			"split volume",
+			true,
+			volume,
+			[]string{
+				volume,
+				filepath.Join(volume, "data.txt"),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &script{
+				c: &Config{
+					BackupSources:          sources,
+					BackupSplitByDirectory: test.split,
+					// Copies of volumes are not snapshotted again.
+					BackupFromSnapshot: test.backupSources == volume,
+				},
+				backupSources: test.backupSources,
+				volumeCopies:  []string{volume},
+			}
+			_, files, err := s.collectFilesForBackup()
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(test.expected, files) {
+				t.Errorf("Expected %v, got %v", test.expected, files)
+			}
+		})
+	}
+
+	t.Run("dumpdir", func(t *testing.T) {
+		files := []string{sources, filepath.Join(sources, "app"), volume, filepath.Join(volume, "data.txt")}
+		current := map[string]fileState{
+			sources:                       {Dir: true},
+			filepath.Join(sources, "app"): {Dir: true},
+			volume:                        {Dir: true},
+		}
+		result := dumpDirs(files, files, current, map[string]string{volume: sources})
+		if expected := "Dapp\x00Ddata\x00\x00"; string(result[sources]) != expected {
+			t.Errorf("Expected %q, got %q", expected, result[sources])
+		}
+		if expected := "Ydata.txt\x00\x00"; string(result[volume]) != expected {
+			t.Errorf("Expected %q, got %q", expected, result[volume])
+		}
+	})
+}
@@ -0,0 +1,58 @@
+// Copyright 2026 - offen.software <hioffen@posteo.de>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	ctr "github.com/moby/moby/api/types/container"
+	"github.com/offen/docker-volume-backup/internal/errwrap"
+)
+
+// databaseDump describes how to dump a database of a certain type.
+type databaseDump struct {
+	command   string
+	extension string
+}
+
+// databaseDumps maps the values supported by the `docker-volume-backup.dump`
+// label to the command that writes a dump of all databases to stdout. The
+// commands read credentials from the environment variables used by the
+// official images.
+var databaseDumps = map[string]databaseDump{
+	"postgres": {
+		command:   `sh -c 'exec pg_dumpall --username="${POSTGRES_USER:-postgres}"'`,
+		extension: ".sql",
+	},
+	"mysql": {
+		command:   `sh -c 'exec mysqldump --all-databases --single-transaction --user=root --password="$MYSQL_ROOT_PASSWORD"'`,
+		extension: ".sql",
+	},
+	"mariadb": {
+		command:   `sh -c 'exec mariadb-dump --all-databases --single-transaction --user=root --password="$MARIADB_ROOT_PASSWORD"'`,
+		extension: ".sql",
+	},
+	"mongodb": {
+		command:   `sh -c 'exec mongodump --archive ${MONGO_INITDB_ROOT_USERNAME:+--username="$MONGO_INITDB_ROOT_USERNAME" --password="$MONGO_INITDB_ROOT_PASSWORD" --authenticationDatabase=admin}'`,
+		extension: ".archive",
+	},
+}
+
+// dumpCommand returns the command dumping the database of the given
+// container. The dump is named after the container and located in the
+// given backup sources.
+func dumpCommand(c ctr.Summary, backupSources string) (outputCommand, error) {
+	kind := c.Labels["docker-volume-backup.dump"]
+	dump, ok := databaseDumps[kind]
+	if !ok {
+		return outputCommand{}, errwrap.Wrap(nil, fmt.Sprintf("unsupported database type %s for container %s", kind, containerName(c)))
+	}
+	return outputCommand{
+		command:     dump.command,
+		user:        c.Labels["docker-volume-backup.dump.user"],
+		location:    filepath.Join(backupSources, containerName(c)+dump.extension),
+		description: fmt.Sprintf("%s database", kind),
+	}, nil
+}
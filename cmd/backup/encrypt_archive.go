@@ -33,6 +33,24 @@ func countTrue(b ...bool) int {
 // In case no passphrase or publickey is given it returns early, leaving the backup file
 // untouched.
 func (s *script) encryptArchive() error {
+	extension, encryptor, err := s.getEncryptor()
+	if err != nil {
+		return err
+	}
+	if encryptor == nil {
+		return nil
+	}
+	return s.doEncrypt(extension, encryptor)
+}
+
+// encryptor wraps the given writer so that all data written to the returned
+// writer is encrypted.
+type encryptor func(ciphertextWriter io.Writer) (io.WriteCloser, error)
+
+// getEncryptor returns the encryptor for the configured encryption method and
+// the extension that is appended to the name of encrypted archives. In case no
+// encryption is configured, a nil encryptor is returned.
+func (s *script) getEncryptor() (string, encryptor, error) {
 	useGPGSymmetric := s.c.GpgPassphrase != ""
 	useGPGAsymmetric := s.c.GpgPublicKeyRing != ""
 	useAgeSymmetric := s.c.AgePassphrase != ""
@@ -44,28 +62,28 @@ func (s *script) encryptArchive() error {
 		useAgeAsymmetric,
 	); nconfigured {
 	case 0:
-		return nil
+		return "", nil, nil
 	case 1:
 		// ok!
 	default:
-		return fmt.Errorf(
+		return "", nil, fmt.Errorf(
 			"error in selecting archive encryption method: expected 0 or 1 to be configured, %d methods are configured",
 			nconfigured,
 		)
 	}
 
 	if useGPGSymmetric {
-		return s.encryptWithGPGSymmetric()
+		return "gpg", s.encryptWithGPGSymmetric, nil
 	} else if useGPGAsymmetric {
-		return s.encryptWithGPGAsymmetric()
-	} else if useAgeSymmetric || useAgeAsymmetric {
-		ar, err := s.getConfiguredAgeRecipients()
-		if err != nil {
-			return errwrap.Wrap(err, "failed to get configured age recipients")
-		}
-		return s.encryptWithAge(ar)
+		return "gpg", s.encryptWithGPGAsymmetric, nil
+	}
+	ar, err := s.getConfiguredAgeRecipients()
+	if err != nil {
+		return "", nil, errwrap.Wrap(err, "failed to get configured age recipients")
 	}
-	return nil
+	return "age", func(ciphertextWriter io.Writer) (io.WriteCloser, error) {
+		return age.Encrypt(ciphertextWriter, ar...)
+	}, nil
 }
 
 func (s *script) getConfiguredAgeRecipients() ([]age.Recipient, error) {
@@ -108,19 +126,11 @@ func parseAgeRecipient(arg string) (age.Recipient, error) {
 	return nil, fmt.Errorf("unknown recipient type: %q", arg)
 }
 
-func (s *script) encryptWithAge(rec []age.Recipient) error {
-	return s.doEncrypt("age", func(ciphertextWriter io.Writer) (io.WriteCloser, error) {
-		return age.Encrypt(ciphertextWriter, rec...)
-	})
-}
-
-func (s *script) encryptWithGPGSymmetric() error {
-	return s.doEncrypt("gpg", func(ciphertextWriter io.Writer) (io.WriteCloser, error) {
-		_, name := path.Split(s.file)
-		return openpgp.SymmetricallyEncrypt(ciphertextWriter, []byte(s.c.GpgPassphrase), &openpgp.FileHints{
-			FileName: name,
-		}, nil)
-	})
+func (s *script) encryptWithGPGSymmetric(ciphertextWriter io.Writer) (io.WriteCloser, error) {
+	_, name := path.Split(s.file)
+	return openpgp.SymmetricallyEncrypt(ciphertextWriter, []byte(s.c.GpgPassphrase), &openpgp.FileHints{
+		FileName: name,
+	}, nil)
 }
 
 type closeAllWriter struct {
@@ -137,40 +147,38 @@ func (c *closeAllWriter) Close() (err error) {
 
 var _ io.WriteCloser = (*closeAllWriter)(nil)
 
-func (s *script) encryptWithGPGAsymmetric() error {
-	return s.doEncrypt("gpg", func(ciphertextWriter io.Writer) (_ io.WriteCloser, outerr error) {
-		entityList, err := openpgp.ReadArmoredKeyRing(bytes.NewReader([]byte(s.c.GpgPublicKeyRing)))
-		if err != nil {
-			return nil, errwrap.Wrap(err, "error parsing armored keyring")
-		}
+func (s *script) encryptWithGPGAsymmetric(ciphertextWriter io.Writer) (_ io.WriteCloser, outerr error) {
+	entityList, err := openpgp.ReadArmoredKeyRing(bytes.NewReader([]byte(s.c.GpgPublicKeyRing)))
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error parsing armored keyring")
+	}
 
-		armoredWriter, err := armor.Encode(ciphertextWriter, "PGP MESSAGE", nil)
-		if err != nil {
-			return nil, errwrap.Wrap(err, "error preparing encryption")
+	armoredWriter, err := armor.Encode(ciphertextWriter, "PGP MESSAGE", nil)
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error preparing encryption")
+	}
+	defer func() {
+		if outerr != nil {
+			_ = armoredWriter.Close()
 		}
-		defer func() {
-			if outerr != nil {
-				_ = armoredWriter.Close()
-			}
-		}()
+	}()
 
-		_, name := path.Split(s.file)
-		encWriter, err := openpgp.Encrypt(armoredWriter, entityList, nil, nil, &openpgp.FileHints{
-			FileName: name,
-		}, nil)
-		if err != nil {
-			return nil, err
-		}
-		return &closeAllWriter{
-			Writer:  encWriter,
-			closers: []io.Closer{encWriter, armoredWriter},
-		}, nil
-	})
+	_, name := path.Split(s.file)
+	encWriter, err := openpgp.Encrypt(armoredWriter, entityList, nil, nil, &openpgp.FileHints{
+		FileName: name,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &closeAllWriter{
+		Writer:  encWriter,
+		closers: []io.Closer{encWriter, armoredWriter},
+	}, nil
 }
 
 func (s *script) doEncrypt(
 	extension string,
-	encryptor func(ciphertextWriter io.Writer) (io.WriteCloser, error),
+	encryptor encryptor,
 ) (outerr error) {
 	encFile := fmt.Sprintf("%s.%s", s.file, extension)
 	s.registerHook(hookLevelPlumbing, func(error) error {
@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/cosiner/argv"
@@ -23,12 +24,22 @@ import (
 )
 
 func (s *script) exec(containerRef string, command string, user string) ([]byte, []byte, error) {
+	var outBuf, errBuf bytes.Buffer
+	if err := s.execStream(containerRef, command, user, &outBuf, &errBuf); err != nil {
+		return outBuf.Bytes(), errBuf.Bytes(), err
+	}
+	return outBuf.Bytes(), errBuf.Bytes(), nil
+}
+
+// execStream runs the given command in the given container, writing its
+// output to stdout and stderr while it is running.
+func (s *script) execStream(containerRef string, command string, user string, stdout, stderr io.Writer) error {
 	args, err := argv.Argv(command, nil, nil)
 	if err != nil {
-		return nil, nil, errwrap.Wrap(err, fmt.Sprintf("error parsing argv from '%s'", command))
+		return errwrap.Wrap(err, fmt.Sprintf("error parsing argv from '%s'", command))
 	}
 	if len(args) == 0 {
-		return nil, nil, errwrap.Wrap(nil, "received unexpected empty command")
+		return errwrap.Wrap(nil, "received unexpected empty command")
 	}
 
 	commandEnv := []string{
@@ -43,54 +54,52 @@ func (s *script) exec(containerRef string, command string, user string) ([]byte,
 		User:         user,
 	})
 	if err != nil {
-		return nil, nil, errwrap.Wrap(err, "error creating container exec")
+		return errwrap.Wrap(err, "error creating container exec")
 	}
 
 	resp, err := s.cli.ExecAttach(context.Background(), execID.ID, client.ExecAttachOptions{})
 	if err != nil {
-		return nil, nil, errwrap.Wrap(err, "error attaching container exec")
+		return errwrap.Wrap(err, "error attaching container exec")
 	}
 	defer resp.Close()
 
-	var outBuf, errBuf, fullRespBuf bytes.Buffer
-	outputDone := make(chan error)
-
-	tee := io.TeeReader(resp.Reader, &fullRespBuf)
-
-	go func() {
-		_, err := stdcopy.StdCopy(&outBuf, &errBuf, tee)
-		outputDone <- err
-	}()
-
-	if err := <-outputDone; err != nil {
-		if body, bErr := io.ReadAll(&fullRespBuf); bErr == nil {
-			// if possible, try to append the exec output to the error
-			// as it's likely to be more relevant for users than the error from
-			// calling stdcopy.Copy
-			err = errwrap.Wrap(errors.New(string(body)), err.Error())
-		}
-		return nil, nil, errwrap.Wrap(err, "error demultiplexing output")
-	}
+	// Only the beginning of the response is kept for reporting errors, as
+	// the output of a command might be arbitrarily large.
+	fullRespBuf := &cappedBuffer{max: 1 << 16}
+	tee := io.TeeReader(resp.Reader, fullRespBuf)
 
-	stdout, err := io.ReadAll(&outBuf)
-	if err != nil {
-		return nil, nil, errwrap.Wrap(err, "error reading stdout")
-	}
-	stderr, err := io.ReadAll(&errBuf)
-	if err != nil {
-		return nil, nil, errwrap.Wrap(err, "error reading stderr")
+	if _, err := stdcopy.StdCopy(stdout, stderr, tee); err != nil {
+		// if possible, try to append the exec output to the error
+		// as it's likely to be more relevant for users than the error from
+		// calling stdcopy.Copy
+		err = errwrap.Wrap(errors.New(fullRespBuf.String()), err.Error())
+		return errwrap.Wrap(err, "error demultiplexing output")
 	}
 
 	res, err := s.cli.ExecInspect(context.Background(), execID.ID, client.ExecInspectOptions{})
 	if err != nil {
-		return nil, nil, errwrap.Wrap(err, "error inspecting container exec")
+		return errwrap.Wrap(err, "error inspecting container exec")
 	}
 
 	if res.ExitCode > 0 {
-		return stdout, stderr, errwrap.Wrap(nil, fmt.Sprintf("running command exited %d", res.ExitCode))
+		return errwrap.Wrap(nil, fmt.Sprintf("running command exited %d", res.ExitCode))
 	}
 
-	return stdout, stderr, nil
+	return nil
+}
+
+// cappedBuffer is a buffer that silently discards all writes exceeding its
+// maximum size.
+type cappedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	if remaining := c.max - c.Len(); remaining > 0 {
+		c.Buffer.Write(p[:min(len(p), remaining)])
+	}
+	return len(p), nil
 }
 
 func (s *script) runLabeledCommands(label string) error {
@@ -196,17 +205,21 @@ const (
 	lifecyclePhasePrune   lifecyclePhase = "prune"
 )
 
+var lifecyclePhases = []lifecyclePhase{
+	lifecyclePhaseArchive,
+	lifecyclePhaseProcess,
+	lifecyclePhaseCopy,
+	lifecyclePhasePrune,
+}
+
 func (s *script) withLabeledCommands(step lifecyclePhase, cb func() error) func() error {
-	if s.cli == nil {
-		return cb
-	}
 	return func() (err error) {
-		if err = s.runLabeledCommands(fmt.Sprintf("docker-volume-backup.%s-pre", step)); err != nil {
+		if err = s.runLifecycleHooks(step, "pre", nil); err != nil {
 			err = errwrap.Wrap(err, fmt.Sprintf("error running %s-pre commands", step))
 			return
 		}
 		defer func() {
-			if derr := s.runLabeledCommands(fmt.Sprintf("docker-volume-backup.%s-post", step)); derr != nil {
+			if derr := s.runLifecycleHooks(step, "post", err); derr != nil {
 				err = errors.Join(err, errwrap.Wrap(derr, fmt.Sprintf("error running %s-post commands", step)))
 			}
 		}()
@@ -214,3 +227,21 @@ func (s *script) withLabeledCommands(step lifecyclePhase, cb func() error) func(
 		return
 	}
 }
+
+// runLifecycleHooks runs all local hooks, labeled commands and webhooks that
+// are defined for the given step of the given phase.
+func (s *script) runLifecycleHooks(phase lifecyclePhase, step string, runErr error) error {
+	event := fmt.Sprintf("%s-%s", phase, step)
+	if err := s.runLocalHooks(filepath.Join(localHooksDirectory, event+".d"), event); err != nil {
+		return errwrap.Wrap(err, "error running local hooks")
+	}
+	if s.cli != nil {
+		if err := s.runLabeledCommands(fmt.Sprintf("docker-volume-backup.%s", event)); err != nil {
+			return err
+		}
+	}
+	if err := s.runWebhooks(phase, step, runErr); err != nil {
+		return errwrap.Wrap(err, "error running webhooks")
+	}
+	return nil
+}
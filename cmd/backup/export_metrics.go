@@ -0,0 +1,161 @@
+// Copyright 2026 - offen.software <hioffen@posteo.de>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/offen/docker-volume-backup/internal/errwrap"
+)
+
+const lastSuccessMetric = "docker_volume_backup_last_success_timestamp_seconds"
+
+// exportMetrics pushes metrics about the current run to a Prometheus
+// Pushgateway and writes them to a textfile for the node_exporter, if
+// configured. The given error is the one the run has finished with, if any.
+func (s *script) exportMetrics(runErr error) error {
+	if s.c.MetricsPushgatewayURL == "" && s.c.MetricsTextfileDirectory == "" {
+		return nil
+	}
+	source := metricsSource(s.c)
+
+	var errs []error
+	if s.c.MetricsPushgatewayURL != "" {
+		// The source is part of the grouping key, so it must not be added to
+		// the samples themselves.
+		m := metricSet{}
+		addRunMetrics(m, s.stats, runErr)
+		if runErr == nil {
+			m.add(lastSuccessMetric, "gauge", "Time the last successful backup run has finished.", unixSeconds(time.Now()))
+		}
+		if err := s.pushMetrics(m, source); err != nil {
+			errs = append(errs, errwrap.Wrap(err, "error pushing metrics"))
+		}
+	}
+	if s.c.MetricsTextfileDirectory != "" {
+		location := filepath.Join(s.c.MetricsTextfileDirectory, fmt.Sprintf("docker_volume_backup_%s.prom", textfileName(source)))
+		m := metricSet{}
+		addRunMetrics(m, s.stats, runErr, "source", source)
+		lastSuccess := unixSeconds(time.Now())
+		if runErr != nil {
+			lastSuccess = previousValue(location, lastSuccessMetric)
+		}
+		m.add(lastSuccessMetric, "gauge", "Time the last successful backup run has finished.", lastSuccess, "source", source)
+		if err := writeTextfile(m, location); err != nil {
+			errs = append(errs, errwrap.Wrap(err, "error writing metrics textfile"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pushMetrics pushes the given metrics to the configured Pushgateway, grouped
+// by the given source. Metrics of the same name that have been pushed
+// before are replaced.
+func (s *script) pushMetrics(m metricSet, source string) error {
+	var body bytes.Buffer
+	if err := m.write(&body); err != nil {
+		return errwrap.Wrap(err, "error writing metrics")
+	}
+
+	endpoint := fmt.Sprintf(
+		"%s/metrics/job/docker-volume-backup/source/%s",
+		strings.TrimSuffix(s.c.MetricsPushgatewayURL, "/"), url.PathEscape(source),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, &body)
+	if err != nil {
+		return errwrap.Wrap(err, "error creating request")
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errwrap.Wrap(err, "error sending request")
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return errwrap.Wrap(nil, fmt.Sprintf("received unexpected status code %d: %s", res.StatusCode, bytes.TrimSpace(message)))
+	}
+	s.logger.Info(
+		fmt.Sprintf("Pushed metrics to %s.", s.c.MetricsPushgatewayURL),
+	)
+	return nil
+}
+
+var invalidTextfileChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// textfileName returns a version of the given source that can safely be
+// used in a file name.
+func textfileName(source string) string {
+	return invalidTextfileChars.ReplaceAllString(source, "_")
+}
+
+// writeTextfile writes the given metrics to the given location. The file is
+// replaced atomically so the node_exporter never reads partial content.
+func writeTextfile(m metricSet, location string) (returnErr error) {
+	f, err := os.CreateTemp(filepath.Dir(location), ".docker_volume_backup_*")
+	if err != nil {
+		return errwrap.Wrap(err, "error creating temporary file")
+	}
+	defer func() {
+		if returnErr != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	if err := m.write(f); err != nil {
+		return errors.Join(errwrap.Wrap(err, "error writing metrics"), f.Close())
+	}
+	if err := f.Close(); err != nil {
+		return errwrap.Wrap(err, "error closing temporary file")
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return errwrap.Wrap(err, "error setting permissions")
+	}
+	if err := os.Rename(f.Name(), location); err != nil {
+		return errwrap.Wrap(err, "error replacing textfile")
+	}
+	return nil
+}
+
+// previousValue reads the value of the metric of the given name from the
+// textfile at the given location. In case the file or the metric does not
+// exist, 0 is returned.
+func previousValue(location, name string) float64 {
+	f, err := os.Open(location)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, name+"{") && !strings.HasPrefix(line, name+" ") {
+			continue
+		}
+		fields := strings.Fields(line)
+		value, err := strconv.ParseFloat(fields[len(fields)-1], 64)
+		if err != nil {
+			return 0
+		}
+		return value
+	}
+	return 0
+}
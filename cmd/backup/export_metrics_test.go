@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportMetrics(t *testing.T) {
+	var pushedPath, pushedBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		pushedPath, pushedBody = r.URL.Path, string(body)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	s := &script{
+		c: &Config{
+			MetricsPushgatewayURL:    server.URL + "/",
+			MetricsTextfileDirectory: dir,
+			source:                   "daily.env",
+		},
+		stats: &Stats{
+			StartTime: time.Now(),
+			Storages:  map[string]StorageStats{"Local": {UploadedBytes: 512}},
+		},
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	if err := s.exportMetrics(nil); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if pushedPath != "/metrics/job/docker-volume-backup/source/daily.env" {
+		t.Errorf("Unexpected push path %s", pushedPath)
+	}
+	for _, expected := range []string{
+		"docker_volume_backup_last_run_success 1\n",
+		`docker_volume_backup_last_run_uploaded_bytes{backend="Local"} 512` + "\n",
+		"docker_volume_backup_last_success_timestamp_seconds ",
+	} {
+		if !strings.Contains(pushedBody, expected) {
+			t.Errorf("Expected pushed metrics to contain %q, got %s", expected, pushedBody)
+		}
+	}
+
+	location := filepath.Join(dir, "docker_volume_backup_daily_env.prom")
+	lastSuccess := previousValue(location, lastSuccessMetric)
+	if lastSuccess == 0 {
+		t.Fatalf("Expected last success to be written to textfile")
+	}
+
+	if err := s.exportMetrics(errors.New("failed")); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if strings.Contains(pushedBody, lastSuccessMetric) {
+		t.Errorf("Expected last success not to be pushed for failed run, got %s", pushedBody)
+	}
+	if value := previousValue(location, lastSuccessMetric); value != lastSuccess {
+		t.Errorf("Expected last success %v to be kept, got %v", lastSuccess, value)
+	}
+	content, err := os.ReadFile(location)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !strings.Contains(string(content), `docker_volume_backup_last_run_success{source="daily.env"} 0`) {
+		t.Errorf("Expected failed run in textfile, got %s", content)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected temporary files to be removed, got %v", entries)
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2026 - offen.software <hioffen@posteo.de>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/offen/docker-volume-backup/internal/errwrap"
+)
+
+// incrementalState is persisted after each successful run in incremental
+// mode. It describes the files contained in the full backup that subsequent
+// incremental backups are based on.
+type incrementalState struct {
+	Config  string               `json:"config,omitempty"`
+	Sources string               `json:"sources"`
+	Full    string               `json:"full"`
+	Runs    int                  `json:"runs"`
+	Files   map[string]fileState `json:"files"`
+}
+
+// fileState is used for detecting whether a file has changed since the full
+// backup has been created.
+type fileState struct {
+	ModTime time.Time `json:"mtime"`
+	Inode   uint64    `json:"inode"`
+	Size    int64     `json:"size"`
+	Dir     bool      `json:"dir,omitempty"`
+}
+
+// selectIncrementalFiles returns the files that need to be archived and the
+// contents of the GNU dumpdir entries that are written for all directories.
+// Files that have been deleted since the last full backup are recorded in
+// s.deletedFiles. In case no incremental backup is due, all given files are
+// returned. The updated state is persisted after the run has completed
+// successfully.
+func (s *script) selectIncrementalFiles(backupSources string, files []string) ([]string, map[string][]byte, error) {
+	if !s.c.BackupIncremental {
+		return files, nil, nil
+	}
+
+	current := make(map[string]fileState, len(files))
+	for _, file := range files {
+		fi, err := os.Lstat(file)
+		if err != nil {
+			return nil, nil, errwrap.Wrap(err, fmt.Sprintf("error getting file info for %s", file))
+		}
+		state := fileState{
+			ModTime: fi.ModTime(),
+			Size:    fi.Size(),
+			Dir:     fi.IsDir(),
+		}
+		// Snapshots and volumes are copied anew on each run, so their
+		// inodes change even if the files have not.
+		if stat, ok := fi.Sys().(*syscall.Stat_t); ok && !s.c.BackupFromSnapshot && !s.isVolumeCopy(file) {
+			state.Inode = stat.Ino
+		}
+		current[file] = state
+	}
+
+	previous, err := readIncrementalState(s.c.BackupIncrementalStateFile)
+	if err != nil {
+		return nil, nil, errwrap.Wrap(err, "error reading incremental state")
+	}
+
+	var next incrementalState
+	var selected []string
+	switch {
+	case previous == nil:
+		s.logger.Info("No incremental state found, creating full backup.")
+	case previous.Config != "" && previous.Config != metricsSource(s.c):
+		s.logger.Warn(
+			fmt.Sprintf("Incremental state has been created by configuration `%s`, creating full backup.", previous.Config),
+		)
+	case previous.Sources != backupSources:
+		s.logger.Warn(
+			fmt.Sprintf("Incremental state has been created for `%s`, creating full backup.", previous.Sources),
+		)
+	case previous.Runs >= s.c.BackupIncrementalFullEvery:
+		s.logger.Info(
+			fmt.Sprintf("Creating full backup after %d runs based on `%s`.", previous.Runs, previous.Full),
+		)
+	default:
+		next = *previous
+		next.Runs++
+		for _, file := range files {
+			// Directories are always archived so their permissions and
+			// timestamps can be restored.
+			state := current[file]
+			before, ok := previous.Files[file]
+			if !ok || state.Dir || !before.ModTime.Equal(state.ModTime) || before.Inode != state.Inode || before.Size != state.Size {
+				selected = append(selected, file)
+			}
+		}
+		for file := range previous.Files {
+			if _, ok := current[file]; !ok {
+				s.deletedFiles = append(s.deletedFiles, file)
+			}
+		}
+		sort.Strings(s.deletedFiles)
+		s.incrementalBase = previous.Full
+		s.logger.Info(
+			fmt.Sprintf(
+				"Creating incremental backup based on `%s` containing %d changed and %d deleted paths.",
+				previous.Full, len(selected), len(s.deletedFiles),
+			),
+		)
+	}
+
+	if s.incrementalBase == "" {
+		next = incrementalState{
+			Config:  metricsSource(s.c),
+			Sources: backupSources,
+			Runs:    1,
+			Files:   current,
+		}
+		selected = files
+	}
+
+	s.registerHook(hookLevelPlumbing, func(err error) error {
+		if err != nil {
+			return nil
+		}
+		if next.Full == "" {
+			_, next.Full = path.Split(s.file)
+		}
+		if err := writeIncrementalState(s.c.BackupIncrementalStateFile, &next); err != nil {
+			return errwrap.Wrap(err, "error writing incremental state")
+		}
+		return nil
+	})
+
+	// Copies of volumes are archived as children of BACKUP_SOURCES, so they
+	// need to be listed in its dumpdir for not being removed on extraction.
+	parents := map[string]string{}
+	if !s.c.BackupFromSnapshot {
+		backupPath, err := filepath.Abs(stripTrailingSlashes(backupSources))
+		if err != nil {
+			return nil, nil, errwrap.Wrap(err, "error getting absolute path")
+		}
+		for _, location := range s.volumeCopies {
+			parents[location] = backupPath
+		}
+	}
+
+	return selected, dumpDirs(files, selected, current, parents), nil
+}
+
+// isVolumeCopy returns whether the given path is located within a copy of a
+// discovered volume.
+func (s *script) isVolumeCopy(file string) bool {
+	for _, location := range s.volumeCopies {
+		if file == location || strings.HasPrefix(file, location+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// dumpDirs returns the contents of the GNU dumpdir entries for all
+// directories in files. A dumpdir lists all children of a directory, marking
+// directories with D, files contained in the archive with Y and unchanged
+// files with N. When extracting, children that are not listed are removed,
+// so files that have been deleted since the full backup are removed, too.
+// Directories that are archived as children of a directory other than
+// their parent on disk are looked up in parents.
+func dumpDirs(files, selected []string, current map[string]fileState, parents map[string]string) map[string][]byte {
+	included := make(map[string]bool, len(selected))
+	for _, file := range selected {
+		included[file] = true
+	}
+	result := map[string][]byte{}
+	for _, file := range files {
+		if current[file].Dir {
+			result[file] = nil
+		}
+	}
+	// files are sorted lexically as they have been collected using
+	// filepath.WalkDir, so the children are listed in order, too.
+	for _, file := range files {
+		parent, ok := parents[file]
+		if !ok {
+			parent = filepath.Dir(file)
+		}
+		if _, ok := result[parent]; !ok || parent == file {
+			continue
+		}
+		code := byte('N')
+		switch {
+		case current[file].Dir:
+			code = 'D'
+		case included[file]:
+			code = 'Y'
+		}
+		result[parent] = append(append(append(result[parent], code), filepath.Base(file)...), 0)
+	}
+	for dir, contents := range result {
+		result[dir] = append(contents, 0)
+	}
+	return result
+}
+
+func readIncrementalState(location string) (*incrementalState, error) {
+	data, err := os.ReadFile(location)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error reading state file")
+	}
+	var state incrementalState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, errwrap.Wrap(err, "error unmarshaling state file")
+	}
+	return &state, nil
+}
+
+// writeIncrementalState atomically replaces the state file at the given
+// location.
+func writeIncrementalState(location string, state *incrementalState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return errwrap.Wrap(err, "error marshaling state")
+	}
+	if err := os.MkdirAll(filepath.Dir(location), 0755); err != nil {
+		return errwrap.Wrap(err, "error creating directory for state file")
+	}
+	tmp := location + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return errwrap.Wrap(err, "error writing state file")
+	}
+	if err := os.Rename(tmp, location); err != nil {
+		return errwrap.Wrap(err, "error replacing state file")
+	}
+	return nil
+}
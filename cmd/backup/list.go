@@ -0,0 +1,152 @@
+// Copyright 2026 - offen.software <hioffen@posteo.de>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/offen/docker-volume-backup/internal/errwrap"
+	"github.com/offen/docker-volume-backup/internal/storage"
+)
+
+// listedBackup describes a single backup that is stored in one of the
+// configured storage backends.
+type listedBackup struct {
+	Config               string    `json:"config"`
+	Backend              string    `json:"backend"`
+	Name                 string    `json:"name"`
+	Size                 int64     `json:"size"`
+	LastModified         time.Time `json:"lastModified"`
+	MatchesPruningPrefix bool      `json:"matchesPruningPrefix"`
+	MissingFrom          []string  `json:"missingFrom,omitempty"`
+}
+
+// runList prints all backups that are stored in the storage backends of
+// all available configurations.
+func runList(args []string) error {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	source := flags.String("config", "", "only list backups for the given conf.d file")
+	asJSON := flags.Bool("json", false, "print the list of backups as JSON")
+	if err := flags.Parse(args); err != nil {
+		return errwrap.Wrap(err, "error parsing flags")
+	}
+
+	configurations, err := sourceConfiguration(configStrategyConfd)
+	if err != nil {
+		return errwrap.Wrap(err, "error sourcing configuration")
+	}
+
+	backups := []listedBackup{}
+	for _, config := range configurations {
+		if *source != "" && config.source != *source {
+			continue
+		}
+		s := newScript(config)
+		// Log output must not be mixed with the list that is printed to stdout.
+		s.logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+		if err := s.runSubcommand(func() error {
+			result, err := s.listBackups()
+			if err != nil {
+				return err
+			}
+			backups = append(backups, result...)
+			return nil
+		}, false); err != nil {
+			return errwrap.Wrap(err, fmt.Sprintf("error listing backups for %s", config.source))
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(backups); err != nil {
+			return errwrap.Wrap(err, "error encoding list of backups")
+		}
+		return nil
+	}
+	if err := printBackups(os.Stdout, backups, time.Now()); err != nil {
+		return errwrap.Wrap(err, "error printing list of backups")
+	}
+	return nil
+}
+
+// listBackups collects the backups stored in all configured storage backends.
+// Backups that are stored in some but not all backends are flagged by
+// populating their MissingFrom field.
+func (s *script) listBackups() ([]listedBackup, error) {
+	var backups []listedBackup
+	presentIn := map[string]map[string]bool{}
+	for _, backend := range s.storages {
+		infos, err := backend.List("")
+		if err != nil {
+			return nil, errwrap.Wrap(err, fmt.Sprintf("error listing backups in %s", backend.Name()))
+		}
+		for _, info := range infos {
+			if storage.IsSidecar(info.Name) || storage.IsChunk(info.Name) {
+				continue
+			}
+			if presentIn[info.Name] == nil {
+				presentIn[info.Name] = map[string]bool{}
+			}
+			presentIn[info.Name][backend.Name()] = true
+			backups = append(backups, listedBackup{
+				Config:               s.c.source,
+				Backend:              backend.Name(),
+				Name:                 info.Name,
+				Size:                 info.Size,
+				LastModified:         info.LastModified,
+				MatchesPruningPrefix: strings.HasPrefix(info.Name, s.c.commonPruningPrefix()),
+			})
+		}
+	}
+
+	for i, backup := range backups {
+		for _, backend := range s.storages {
+			if !presentIn[backup.Name][backend.Name()] {
+				backups[i].MissingFrom = append(backups[i].MissingFrom, backend.Name())
+			}
+		}
+	}
+
+	sort.SliceStable(backups, func(i, j int) bool {
+		if backups[i].Name != backups[j].Name {
+			return backups[i].Name < backups[j].Name
+		}
+		return backups[i].Backend < backups[j].Backend
+	})
+	return backups, nil
+}
+
+// printBackups writes the given backups to w as a human-readable table.
+func printBackups(w io.Writer, backups []listedBackup, now time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CONFIG\tBACKEND\tNAME\tSIZE\tAGE\tPRUNING PREFIX\tMISSING FROM")
+	for _, b := range backups {
+		matches := "no"
+		if b.MatchesPruningPrefix {
+			matches = "yes"
+		}
+		missingFrom := "-"
+		if len(b.MissingFrom) != 0 {
+			missingFrom = strings.Join(b.MissingFrom, ",")
+		}
+		fmt.Fprintf(
+			tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			b.Config, b.Backend, b.Name,
+			formatBytes(uint64(b.Size), false),
+			now.Sub(b.LastModified).Round(time.Second),
+			matches, missingFrom,
+		)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/offen/docker-volume-backup/internal/storage"
+)
+
+// memoryBackend is a storage backend keeping all files in memory.
+type memoryBackend struct {
+	sync.Mutex
+	name  string
+	files map[string][]byte
+	mtime map[string]time.Time
+}
+
+func newMemoryBackend(name string) *memoryBackend {
+	return &memoryBackend{name: name, files: map[string][]byte{}, mtime: map[string]time.Time{}}
+}
+
+func (b *memoryBackend) Name() string { return b.name }
+
+func (b *memoryBackend) Copy(file string) error {
+	return errors.New("not implemented")
+}
+
+func (b *memoryBackend) Upload(name string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	b.Lock()
+	defer b.Unlock()
+	b.files[name] = data
+	if _, ok := b.mtime[name]; !ok {
+		b.mtime[name] = time.Now()
+	}
+	return nil
+}
+
+func (b *memoryBackend) Prune(policy storage.RetentionPolicy, pruningPrefix string) (*storage.PruneStats, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (b *memoryBackend) List(prefix string) ([]storage.BackupInfo, error) {
+	b.Lock()
+	defer b.Unlock()
+	var result []storage.BackupInfo
+	for name, data := range b.files {
+		if strings.HasPrefix(name, prefix) {
+			result = append(result, storage.BackupInfo{Name: name, Size: int64(len(data)), LastModified: b.mtime[name]})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+func (b *memoryBackend) Download(name string, w io.Writer) error {
+	b.Lock()
+	data, ok := b.files[name]
+	b.Unlock()
+	if !ok {
+		return errors.New("file not found")
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func (b *memoryBackend) Remove(names []string) error {
+	b.Lock()
+	defer b.Unlock()
+	for _, name := range names {
+		delete(b.files, name)
+		delete(b.mtime, name)
+	}
+	return nil
+}
+
+func TestListBackups(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	local := newMemoryBackend("Local")
+	remote := newMemoryBackend("S3")
+	for _, b := range []*memoryBackend{local, remote} {
+		b.files["backup-1.tar.gz"] = []byte("first")
+		b.files["backup-1.tar.gz.sha256"] = []byte("checksum")
+		b.mtime["backup-1.tar.gz"] = now.Add(-time.Hour)
+	}
+	local.files["backup-2.tar.gz"] = []byte("second")
+	local.mtime["backup-2.tar.gz"] = now
+	remote.files["other.tar.gz"] = []byte("other")
+	remote.mtime["other.tar.gz"] = now
+
+	s := &script{
+		c:        &Config{source: "conf", BackupPruningPrefix: "backup-"},
+		storages: []storage.Backend{local, remote},
+	}
+	backups, err := s.listBackups()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	expected := []listedBackup{
+		{Config: "conf", Backend: "Local", Name: "backup-1.tar.gz", Size: 5, LastModified: now.Add(-time.Hour), MatchesPruningPrefix: true},
+		{Config: "conf", Backend: "S3", Name: "backup-1.tar.gz", Size: 5, LastModified: now.Add(-time.Hour), MatchesPruningPrefix: true},
+		{Config: "conf", Backend: "Local", Name: "backup-2.tar.gz", Size: 6, LastModified: now, MatchesPruningPrefix: true, MissingFrom: []string{"S3"}},
+		{Config: "conf", Backend: "S3", Name: "other.tar.gz", Size: 5, LastModified: now, MissingFrom: []string{"Local"}},
+	}
+	if !reflect.DeepEqual(expected, backups) {
+		t.Errorf("Expected %v, got %v", expected, backups)
+	}
+
+	var out bytes.Buffer
+	if err := printBackups(&out, backups, now); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Expected header and 4 rows, got %q", out.String())
+	}
+	for i, fields := range [][]string{
+		{"CONFIG", "BACKEND", "NAME", "SIZE", "AGE", "PRUNING", "PREFIX", "MISSING", "FROM"},
+		{"conf", "Local", "backup-1.tar.gz", "5", "B", "1h0m0s", "yes", "-"},
+		{"conf", "S3", "backup-1.tar.gz", "5", "B", "1h0m0s", "yes", "-"},
+		{"conf", "Local", "backup-2.tar.gz", "6", "B", "0s", "yes", "S3"},
+		{"conf", "S3", "other.tar.gz", "5", "B", "0s", "no", "Local"},
+	} {
+		if actual := strings.Fields(lines[i]); !reflect.DeepEqual(fields, actual) {
+			t.Errorf("Expected line %d to be %v, got %v", i, fields, actual)
+		}
+	}
+}
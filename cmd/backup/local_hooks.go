@@ -0,0 +1,67 @@
+// Copyright 2026 - offen.software <hioffen@posteo.de>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/offen/docker-volume-backup/internal/errwrap"
+)
+
+// localHooksDirectory contains a directory of executables for each step of
+// each lifecycle phase, e.g. `archive-pre.d`.
+const localHooksDirectory = "/etc/dockervolumebackup/hooks.d"
+
+// runLocalHooks runs all executables in the given directory in lexical
+// order. The output of each executable is logged. In case an executable
+// fails, the remaining ones are skipped.
+func (s *script) runLocalHooks(dir string, event string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return errwrap.Wrap(err, fmt.Sprintf("error reading `%s`", dir))
+	}
+
+	for _, entry := range entries {
+		location := filepath.Join(dir, entry.Name())
+		info, err := os.Stat(location)
+		if err != nil {
+			return errwrap.Wrap(err, fmt.Sprintf("error getting file info for %s", location))
+		}
+		if info.IsDir() {
+			continue
+		}
+		if info.Mode()&0111 == 0 {
+			s.logger.Warn(
+				fmt.Sprintf("Skipping hook `%s` as it is not executable.", location),
+			)
+			continue
+		}
+
+		s.logger.Info(fmt.Sprintf("Running %s hook `%s`.", event, location))
+		cmd := exec.Command(location)
+		cmd.Env = append(
+			os.Environ(),
+			fmt.Sprintf("COMMAND_RUNTIME_ARCHIVE_FILEPATH=%s", s.file),
+			fmt.Sprintf("COMMAND_RUNTIME_EVENT=%s", event),
+		)
+		output, err := cmd.CombinedOutput()
+		if output = bytes.TrimSpace(output); len(output) != 0 {
+			s.logger.Info(
+				fmt.Sprintf("Output of hook `%s`:\n%s", location, output),
+			)
+		}
+		if err != nil {
+			return errwrap.Wrap(err, fmt.Sprintf("error running hook `%s`", location))
+		}
+	}
+	return nil
+}
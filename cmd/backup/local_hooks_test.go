@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunLocalHooks(t *testing.T) {
+	dir := t.TempDir()
+	result := filepath.Join(t.TempDir(), "result")
+	hooks := map[string]string{
+		"20-second":  "echo second >> " + result,
+		"10-first":   "echo first >> " + result + "\necho \"running $COMMAND_RUNTIME_EVENT for $COMMAND_RUNTIME_ARCHIVE_FILEPATH\"",
+		"30-fail":    "echo failing >&2\nexit 1",
+		"40-skipped": "echo skipped >> " + result,
+	}
+	for name, script := range hooks {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	writeFile(t, filepath.Join(dir, "05-not-executable"), "#!/bin/sh\necho not-executable >> "+result)
+
+	var logs bytes.Buffer
+	s := &script{
+		c:      &Config{},
+		file:   "/tmp/backup.tar.gz",
+		logger: slog.New(slog.NewTextHandler(&logs, nil)),
+	}
+	if err := s.runLocalHooks(dir, "archive-pre"); err == nil {
+		t.Error("Expected error from failing hook")
+	}
+	expectContent(t, result, "first\nsecond\n")
+	for _, expected := range []string{"running archive-pre for /tmp/backup.tar.gz", "failing"} {
+		if !strings.Contains(logs.String(), expected) {
+			t.Errorf("Expected logs to contain %q, got %s", expected, logs.String())
+		}
+	}
+
+	if err := s.runLocalHooks(filepath.Join(dir, "missing"), "archive-pre"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
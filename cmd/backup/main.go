@@ -10,6 +10,8 @@ import (
 func main() {
 	foreground := flag.Bool("foreground", false, "run the tool in the foreground")
 	profile := flag.String("profile", "", "collect runtime metrics and log them periodically on the given cron expression")
+	metrics := flag.String("metrics", "", "expose Prometheus metrics on the given address when running in the foreground, e.g. :9090")
+	api := flag.String("api", "", "serve an HTTP API for controlling backups on the given address when running in the foreground, e.g. :8080 or unix:/var/run/backup.sock")
 	flag.Parse()
 	additionalArgs := flag.Args()
 	c := newCommand()
@@ -19,6 +21,15 @@ func main() {
 		case "print-config":
 			c.must(runPrintConfig())
 			return
+		case "list":
+			c.must(runList(additionalArgs[1:]))
+			return
+		case "restore":
+			c.must(runRestore(additionalArgs[1:]))
+			return
+		case "verify":
+			c.must(runVerify(additionalArgs[1:]))
+			return
 		default:
 			panic("unknown command: " + additionalArgs[0])
 		}
@@ -26,6 +37,8 @@ func main() {
 	if *foreground {
 		opts := foregroundOpts{
 			profileCronExpression: *profile,
+			metricsAddress:        *metrics,
+			apiAddress:            *api,
 		}
 		c.must(c.runInForeground(opts))
 	} else {
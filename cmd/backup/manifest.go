@@ -0,0 +1,191 @@
+// Copyright 2026 - offen.software <hioffen@posteo.de>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"runtime/debug"
+	"strings"
+
+	openpgp "github.com/ProtonMail/go-crypto/openpgp/v2"
+	"github.com/offen/docker-volume-backup/internal/errwrap"
+	"github.com/offen/docker-volume-backup/internal/storage"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	manifestSuffix  = ".manifest.json"
+	signatureSuffix = ".asc"
+)
+
+// manifest describes the contents of an archive and how it has been created.
+type manifest struct {
+	Archive     string         `json:"archive"`
+	Version     string         `json:"version"`
+	Sources     []string       `json:"sources"`
+	Compression string         `json:"compression"`
+	Encryption  string         `json:"encryption,omitempty"`
+	Base        string         `json:"base,omitempty"`
+	Files       []archivedFile `json:"files"`
+	Deleted     []string       `json:"deleted,omitempty"`
+	Stats       *Stats         `json:"stats"`
+}
+
+// uploadManifest creates a manifest for the current archive and uploads it
+// to all configured storage backends, next to the archive. The manifest lists
+// the contents of the archive, so it is encrypted using the same method as the
+// archive. In case a signing key is configured, a detached signature of the
+// uploaded manifest is uploaded too. Incremental archives are additionally
+// marked as such, and snapshots list the chunks they reference.
+func (s *script) uploadManifest() error {
+	if len(s.storages) == 0 {
+		return nil
+	}
+	_, name := path.Split(s.file)
+	m := manifest{
+		Archive:     name,
+		Version:     toolVersion(),
+		Sources:     []string{s.backupSources},
+		Compression: s.c.BackupCompression.String(),
+		Encryption:  s.encryptionMethod(),
+		Base:        s.incrementalBase,
+		Files:       s.archivedFiles,
+		Deleted:     s.deletedFiles,
+		Stats:       s.stats,
+	}
+
+	s.stats.Lock()
+	data, err := json.MarshalIndent(m, "", "  ")
+	s.stats.Unlock()
+	if err != nil {
+		return errwrap.Wrap(err, "error marshaling manifest")
+	}
+
+	manifestName := name + manifestSuffix
+	extension, encryptor, err := s.getEncryptor()
+	if err != nil {
+		return errwrap.Wrap(err, "error getting encryptor")
+	}
+	if encryptor != nil {
+		manifestName = fmt.Sprintf("%s.%s", manifestName, extension)
+		if data, err = encryptManifest(data, encryptor); err != nil {
+			return errwrap.Wrap(err, "error encrypting manifest")
+		}
+	}
+
+	files := map[string][]byte{
+		manifestName: data,
+	}
+	if s.c.BackupManifestSigningKey != "" {
+		signature, err := s.signManifest(data)
+		if err != nil {
+			return errwrap.Wrap(err, "error signing manifest")
+		}
+		files[manifestName+signatureSuffix] = signature
+	} else {
+		s.logger.Warn(
+			fmt.Sprintf("Uploading manifest `%s` without a signature as BACKUP_MANIFEST_SIGNING_KEY is not set.", manifestName),
+		)
+	}
+	if s.incrementalBase != "" {
+		files[name+storage.IncrementalSuffix] = []byte(s.incrementalBase + "\n")
+	}
+	if s.snapshotChunks != nil {
+		files[name+storage.ChunksSuffix] = []byte(strings.Join(s.snapshotChunks, "\n") + "\n")
+	}
+
+	eg := errgroup.Group{}
+	for _, backend := range s.storages {
+		b := backend
+		for fileName, content := range files {
+			eg.Go(func() error {
+				return b.Upload(fileName, bytes.NewReader(content))
+			})
+		}
+	}
+	if err := eg.Wait(); err != nil {
+		return errwrap.Wrap(err, "error uploading manifest")
+	}
+
+	s.logger.Info(
+		fmt.Sprintf("Uploaded manifest listing %d files for backup `%s`.", len(s.archivedFiles), name),
+	)
+	return nil
+}
+
+// encryptManifest encrypts the given manifest using the given encryptor.
+func encryptManifest(data []byte, encryptor encryptor) ([]byte, error) {
+	var ciphertext bytes.Buffer
+	w, err := encryptor(&ciphertext)
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error creating encryptor")
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, errors.Join(errwrap.Wrap(err, "error writing ciphertext"), w.Close())
+	}
+	if err := w.Close(); err != nil {
+		return nil, errwrap.Wrap(err, "error closing encryptor")
+	}
+	return ciphertext.Bytes(), nil
+}
+
+// signManifest creates an armored detached signature of the given data using
+// the configured signing key.
+func (s *script) signManifest(data []byte) ([]byte, error) {
+	entityList, err := openpgp.ReadArmoredKeyRing(strings.NewReader(s.c.BackupManifestSigningKey))
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error parsing armored signing key")
+	}
+	if len(entityList) == 0 {
+		return nil, errwrap.Wrap(nil, "no keys found in signing key")
+	}
+	signer := entityList[0]
+	if s.c.BackupManifestSigningKeyPassphrase != "" {
+		if err := signer.DecryptPrivateKeys([]byte(s.c.BackupManifestSigningKeyPassphrase)); err != nil {
+			return nil, errwrap.Wrap(err, "error decrypting signing key")
+		}
+	}
+
+	var signature bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&signature, []*openpgp.Entity{signer}, bytes.NewReader(data), nil); err != nil {
+		return nil, errwrap.Wrap(err, "error creating signature")
+	}
+	return signature.Bytes(), nil
+}
+
+// encryptionMethod returns a description of the configured encryption method.
+func (s *script) encryptionMethod() string {
+	switch {
+	case s.c.GpgPassphrase != "":
+		return "gpg-symmetric"
+	case s.c.GpgPublicKeyRing != "":
+		return "gpg-asymmetric"
+	case s.c.AgePassphrase != "":
+		return "age-passphrase"
+	case len(s.c.AgePublicKeys) != 0:
+		return "age-publickey"
+	default:
+		return ""
+	}
+}
+
+// toolVersion returns the version of the running binary as recorded at
+// build time.
+func toolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	version := info.Main.Version
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			version = fmt.Sprintf("%s (%s)", version, setting.Value)
+		}
+	}
+	return version
+}
@@ -0,0 +1,123 @@
+// Copyright 2026 - offen.software <hioffen@posteo.de>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	ctr "github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/api/types/mount"
+	"github.com/moby/moby/client"
+	"github.com/offen/docker-volume-backup/internal/errwrap"
+)
+
+// mountKey returns a key identifying the data the given mount point refers
+// to. Mounts that do not refer to persistent data return an empty key.
+func mountKey(m ctr.MountPoint) string {
+	switch m.Type {
+	case mount.TypeVolume:
+		return "volume:" + m.Name
+	case mount.TypeBind:
+		return "bind:" + m.Source
+	default:
+		return ""
+	}
+}
+
+// sourceMounts returns the keys of all given mounts that are mounted within
+// the given backup sources, or that contain them.
+func sourceMounts(mounts []ctr.MountPoint, backupSources string) map[string]bool {
+	backupSources = filepath.Clean(backupSources)
+	keys := map[string]bool{}
+	for _, m := range mounts {
+		destination := filepath.Clean(m.Destination)
+		if !isWithin(destination, backupSources) && !isWithin(backupSources, destination) {
+			continue
+		}
+		if key := mountKey(m); key != "" {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+// isWithin checks whether the given path equals or is located below the
+// given parent.
+func isWithin(path, parent string) bool {
+	rel, err := filepath.Rel(parent, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+// usesMounts checks whether the given container mounts any of the data
+// identified by the given keys.
+func usesMounts(c ctr.Summary, keys map[string]bool) bool {
+	for _, m := range c.Mounts {
+		if key := mountKey(m); key != "" && keys[key] {
+			return true
+		}
+	}
+	return false
+}
+
+// backupSourceMounts returns the keys of all mounts that are backed up using
+// the current configuration. These are the mounts of this container that are
+// located within BACKUP_SOURCES and all discovered volumes.
+func (s *script) backupSourceMounts() (map[string]bool, error) {
+	// Unless overridden, the hostname of a container is its id.
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error getting hostname")
+	}
+	own, err := s.cli.ContainerInspect(context.Background(), hostname, client.ContainerInspectOptions{})
+	if err != nil {
+		return nil, errwrap.Wrap(err, fmt.Sprintf("error inspecting own container %s, make sure its hostname has not been changed", hostname))
+	}
+	keys := sourceMounts(own.Container.Mounts, s.c.BackupSources)
+
+	volumes, err := s.discoverVolumes()
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error discovering volumes")
+	}
+	for _, name := range volumes {
+		keys["volume:"+name] = true
+	}
+	return keys, nil
+}
+
+// filterByMounts returns the given containers that mount any of the data
+// that is backed up using the current configuration.
+func (s *script) filterByMounts(containers []handledContainer) ([]handledContainer, error) {
+	keys, err := s.backupSourceMounts()
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error looking up mounts of backup sources")
+	}
+
+	var matched []handledContainer
+	var names []string
+	for _, c := range containers {
+		if usesMounts(c.summary, keys) {
+			matched = append(matched, c)
+			names = append(names, containerName(c.summary))
+		}
+	}
+	s.logger.Info(
+		fmt.Sprintf(
+			"%d out of %d labeled container(s) use the data in `%s`: %v.",
+			len(matched), len(containers), s.c.BackupSources, names,
+		),
+	)
+	return matched, nil
+}
+
+// containerName returns a human readable name of the given container.
+func containerName(c ctr.Summary) string {
+	if len(c.Names) == 0 {
+		return c.ID
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
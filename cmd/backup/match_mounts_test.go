@@ -0,0 +1,93 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	ctr "github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/api/types/mount"
+)
+
+func TestSourceMounts(t *testing.T) {
+	own := []ctr.MountPoint{
+		{Type: mount.TypeVolume, Name: "app_data", Destination: "/backup/app_data"},
+		{Type: mount.TypeBind, Source: "/srv/config", Destination: "/backup/config/"},
+		{Type: mount.TypeVolume, Name: "archive", Destination: "/archive"},
+		{Type: mount.TypeVolume, Name: "other", Destination: "/backup-other"},
+		{Type: mount.TypeBind, Source: "/var/run/docker.sock", Destination: "/var/run/docker.sock"},
+		{Type: mount.TypeTmpfs, Destination: "/backup/tmp"},
+	}
+	tests := []struct {
+		name          string
+		backupSources string
+		expected      map[string]bool
+	}{
+		{
+			"mounts below sources",
+			"/backup",
+			map[string]bool{"volume:app_data": true, "bind:/srv/config": true},
+		},
+		{
+			"sources below mount",
+			"/backup/app_data/db/",
+			map[string]bool{"volume:app_data": true},
+		},
+		{
+			"no mounts",
+			"/data",
+			map[string]bool{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keys := sourceMounts(own, test.backupSources)
+			if !reflect.DeepEqual(test.expected, keys) {
+				t.Errorf("Expected %v, got %v", test.expected, keys)
+			}
+		})
+	}
+}
+
+func TestUsesMounts(t *testing.T) {
+	keys := map[string]bool{"volume:app_data": true, "bind:/srv/config": true}
+	tests := []struct {
+		name     string
+		mounts   []ctr.MountPoint
+		expected bool
+	}{
+		{
+			"same volume",
+			[]ctr.MountPoint{{Type: mount.TypeVolume, Name: "app_data", Destination: "/var/opt/app"}},
+			true,
+		},
+		{
+			"same bind mount",
+			[]ctr.MountPoint{{Type: mount.TypeBind, Source: "/srv/config", Destination: "/etc/app"}},
+			true,
+		},
+		{
+			"bind mount of volume name",
+			[]ctr.MountPoint{{Type: mount.TypeBind, Source: "app_data", Destination: "/data"}},
+			false,
+		},
+		{
+			"other volume",
+			[]ctr.MountPoint{{Type: mount.TypeVolume, Name: "db_data", Destination: "/var/lib/db"}},
+			false,
+		},
+		{
+			"no mounts",
+			nil,
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := usesMounts(ctr.Summary{Mounts: test.mounts}, keys); result != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
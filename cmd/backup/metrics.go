@@ -0,0 +1,195 @@
+// Copyright 2026 - offen.software <hioffen@posteo.de>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricFamily is a set of samples sharing the same metric name as per the
+// Prometheus text exposition format.
+type metricFamily struct {
+	help    string
+	kind    string
+	samples []metricSample
+}
+
+type metricSample struct {
+	labels []string
+	value  float64
+}
+
+// metricSet collects metric families keyed by name.
+type metricSet map[string]*metricFamily
+
+// add adds a sample to the metric family of the given name. Labels are given
+// as alternating names and values.
+func (m metricSet) add(name, kind, help string, value float64, labels ...string) {
+	family, ok := m[name]
+	if !ok {
+		family = &metricFamily{help: help, kind: kind}
+		m[name] = family
+	}
+	family.samples = append(family.samples, metricSample{labels: labels, value: value})
+}
+
+// write writes all metrics in the Prometheus text exposition format, ordered
+// by name.
+func (m metricSet) write(w io.Writer) error {
+	var names []string
+	for name := range m {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		family := m[name]
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, family.help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, family.kind)
+		for _, sample := range family.samples {
+			b.WriteString(name)
+			if len(sample.labels) != 0 {
+				var pairs []string
+				for i := 0; i+1 < len(sample.labels); i += 2 {
+					pairs = append(pairs, fmt.Sprintf("%s=%s", sample.labels[i], strconv.Quote(sample.labels[i+1])))
+				}
+				fmt.Fprintf(&b, "{%s}", strings.Join(pairs, ","))
+			}
+			fmt.Fprintf(&b, " %s\n", strconv.FormatFloat(sample.value, 'g', -1, 64))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// metricsSource returns the value of the `source` label for the given
+// configuration, i.e. the name of the conf.d file it has been read from.
+func metricsSource(c *Config) string {
+	if c.source == "" || c.source == "from environment" {
+		return "env"
+	}
+	return c.source
+}
+
+// addRunMetrics adds gauges describing the given run to the given set. The
+// given labels are added to all samples.
+func addRunMetrics(m metricSet, stats *Stats, runErr error, labels ...string) {
+	stats.Lock()
+	defer stats.Unlock()
+
+	m.add("docker_volume_backup_last_run_timestamp_seconds", "gauge", "Time the last backup run has started.", unixSeconds(stats.StartTime), labels...)
+	success := 1.0
+	if runErr != nil {
+		success = 0
+	}
+	m.add("docker_volume_backup_last_run_success", "gauge", "Whether the last backup run has succeeded.", success, labels...)
+	m.add("docker_volume_backup_last_run_duration_seconds", "gauge", "Duration of the last backup run.", stats.TookTime.Seconds(), labels...)
+	m.add("docker_volume_backup_last_run_locked_seconds", "gauge", "Time the last backup run has waited for the lock.", stats.LockedTime.Seconds(), labels...)
+	m.add("docker_volume_backup_last_run_archive_size_bytes", "gauge", "Size of the archive created by the last backup run.", float64(stats.BackupFile.Size), labels...)
+	m.add("docker_volume_backup_last_run_containers_stopped", "gauge", "Number of containers stopped by the last backup run.", float64(stats.Containers.Stopped), labels...)
+	m.add("docker_volume_backup_last_run_containers_stop_errors", "gauge", "Number of containers the last backup run failed to stop.", float64(stats.Containers.StopErrors), labels...)
+
+	var backends []string
+	for backend := range stats.Storages {
+		backends = append(backends, backend)
+	}
+	slices.Sort(backends)
+	for _, backend := range backends {
+		storage := stats.Storages[backend]
+		backendLabels := append(slices.Clone(labels), "backend", backend)
+		m.add("docker_volume_backup_last_run_backups", "gauge", "Number of backups found in a storage backend when pruning.", float64(storage.Total), backendLabels...)
+		m.add("docker_volume_backup_last_run_backups_pruned", "gauge", "Number of backups pruned from a storage backend by the last backup run.", float64(storage.Pruned), backendLabels...)
+		m.add("docker_volume_backup_last_run_prune_errors", "gauge", "Number of backups the last backup run failed to prune from a storage backend.", float64(storage.PruneErrors), backendLabels...)
+		m.add("docker_volume_backup_last_run_uploaded_bytes", "gauge", "Number of bytes uploaded to a storage backend by the last backup run.", float64(storage.UploadedBytes), backendLabels...)
+		m.add("docker_volume_backup_last_run_upload_duration_seconds", "gauge", "Time the last backup run took uploading to a storage backend.", storage.UploadDuration.Seconds(), backendLabels...)
+	}
+}
+
+func unixSeconds(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.UnixNano()) / 1e9
+}
+
+// sourceMetrics holds the state of all runs of a single configuration.
+type sourceMetrics struct {
+	stats       *Stats
+	err         error
+	lastSuccess time.Time
+	runs        uint
+	failures    uint
+}
+
+// metricsRegistry keeps track of all runs in foreground mode and exposes
+// them as Prometheus metrics.
+type metricsRegistry struct {
+	sync.Mutex
+	sources map[string]*sourceMetrics
+}
+
+func newMetricsRegistry() *metricsRegistry {
+	return &metricsRegistry{sources: map[string]*sourceMetrics{}}
+}
+
+// track makes sure metrics for the given source are exposed before its
+// first run has happened.
+func (r *metricsRegistry) track(source string) {
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.sources[source]; !ok {
+		r.sources[source] = &sourceMetrics{}
+	}
+}
+
+// observe records the result of a backup run of the given source.
+func (r *metricsRegistry) observe(source string, stats *Stats, runErr error) {
+	r.track(source)
+	r.Lock()
+	defer r.Unlock()
+	m := r.sources[source]
+	m.runs++
+	m.stats, m.err = stats, runErr
+	if runErr != nil {
+		m.failures++
+		return
+	}
+	m.lastSuccess = time.Now()
+}
+
+// collect returns the metrics of all sources.
+func (r *metricsRegistry) collect() metricSet {
+	r.Lock()
+	defer r.Unlock()
+	var sources []string
+	for source := range r.sources {
+		sources = append(sources, source)
+	}
+	slices.Sort(sources)
+
+	m := metricSet{}
+	for _, source := range sources {
+		s := r.sources[source]
+		m.add("docker_volume_backup_runs_total", "counter", "Number of backup runs.", float64(s.runs), "source", source)
+		m.add("docker_volume_backup_failures_total", "counter", "Number of failed backup runs.", float64(s.failures), "source", source)
+		m.add("docker_volume_backup_last_success_timestamp_seconds", "gauge", "Time the last successful backup run has finished.", unixSeconds(s.lastSuccess), "source", source)
+		if s.stats != nil {
+			addRunMetrics(m, s.stats, s.err, "source", source)
+		}
+	}
+	return m
+}
+
+func (r *metricsRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = r.collect().write(w)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsRegistry(t *testing.T) {
+	r := newMetricsRegistry()
+	r.track("daily.env")
+	r.observe("hourly.env", &Stats{
+		StartTime:  time.Unix(1700000000, 0),
+		TookTime:   90 * time.Second,
+		LockedTime: 2 * time.Second,
+		BackupFile: BackupFileStats{Size: 1024},
+		Containers: ContainersStats{Stopped: 2},
+		Storages:   map[string]StorageStats{"S3": {Total: 5, Pruned: 1}},
+	}, nil)
+	r.observe("hourly.env", &Stats{Storages: map[string]StorageStats{}}, errors.New("failed"))
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, expected := range []string{
+		"# TYPE docker_volume_backup_runs_total counter\n",
+		`docker_volume_backup_runs_total{source="daily.env"} 0` + "\n",
+		`docker_volume_backup_runs_total{source="hourly.env"} 2` + "\n",
+		`docker_volume_backup_failures_total{source="hourly.env"} 1` + "\n",
+		`docker_volume_backup_last_success_timestamp_seconds{source="daily.env"} 0` + "\n",
+		`docker_volume_backup_last_run_success{source="hourly.env"} 0` + "\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected metrics to contain %q, got %s", expected, body)
+		}
+	}
+	if strings.Contains(body, `docker_volume_backup_last_run_success{source="daily.env"}`) {
+		t.Errorf("Unexpected last run metrics for source that has not run yet: %s", body)
+	}
+
+	m := metricSet{}
+	addRunMetrics(m, &Stats{
+		StartTime:  time.Unix(1700000000, 0),
+		TookTime:   90 * time.Second,
+		BackupFile: BackupFileStats{Size: 1024},
+		Storages:   map[string]StorageStats{"S3": {Total: 5, Pruned: 1, UploadedBytes: 1024, UploadDuration: 3 * time.Second}},
+	}, nil, "source", "env")
+	var b strings.Builder
+	if err := m.write(&b); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	for _, expected := range []string{
+		`docker_volume_backup_last_run_timestamp_seconds{source="env"} 1.7e+09` + "\n",
+		`docker_volume_backup_last_run_duration_seconds{source="env"} 90` + "\n",
+		`docker_volume_backup_last_run_archive_size_bytes{source="env"} 1024` + "\n",
+		`docker_volume_backup_last_run_backups_pruned{source="env",backend="S3"} 1` + "\n",
+		`docker_volume_backup_last_run_uploaded_bytes{source="env",backend="S3"} 1024` + "\n",
+		`docker_volume_backup_last_run_upload_duration_seconds{source="env",backend="S3"} 3` + "\n",
+	} {
+		if !strings.Contains(b.String(), expected) {
+			t.Errorf("Expected metrics to contain %q, got %s", expected, b.String())
+		}
+	}
+}
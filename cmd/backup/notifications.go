@@ -10,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"text/template"
 	"time"
 
@@ -54,12 +55,22 @@ func (s *script) notify(titleTemplate string, bodyTemplate string, err error) er
 
 // notifyFailure sends a notification about a failed backup run
 func (s *script) notifyFailure(err error) error {
-	return s.notify("title_failure", "body_failure", err)
+	return s.notify(s.templateName("title_failure"), s.templateName("body_failure"), err)
 }
 
 // notifyFailure sends a notification about a successful backup run
 func (s *script) notifySuccess() error {
-	return s.notify("title_success", "body_success", nil)
+	return s.notify(s.templateName("title_success"), s.templateName("body_success"), nil)
+}
+
+// templateName returns the name of the given notification template in the
+// script's notification scope.
+func (s *script) templateName(name string) string {
+	if s.notificationScope == "" {
+		return name
+	}
+	kind, result, _ := strings.Cut(name, "_")
+	return fmt.Sprintf("%s_%s_%s", kind, s.notificationScope, result)
 }
 
 // sendNotification sends a notification to all configured third party services
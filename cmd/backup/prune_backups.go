@@ -10,19 +10,22 @@ import (
 	"time"
 
 	"github.com/offen/docker-volume-backup/internal/errwrap"
+	"github.com/offen/docker-volume-backup/internal/storage"
 	"golang.org/x/sync/errgroup"
 )
 
 // pruneBackups rotates away backups from local and remote storages using
 // the given configuration. In case the given configuration would delete all
-// backups, it does nothing instead and logs a warning.
+// backups, it does nothing instead and logs a warning. In case backups are
+// split by directory, the backups of each directory can be pruned separately.
+// In repository mode, chunks that are not referenced anymore are removed
+// afterwards.
 func (s *script) pruneBackups() error {
-	if s.c.BackupRetentionDays < 0 {
+	policy, ok := s.retentionPolicy()
+	if !ok {
 		return nil
 	}
 
-	deadline := time.Now().AddDate(0, 0, -int(s.c.BackupRetentionDays)).Add(s.c.BackupPruningLeeway)
-
 	eg := errgroup.Group{}
 	for _, backend := range s.storages {
 		b := backend
@@ -33,16 +36,44 @@ func (s *script) pruneBackups() error {
 				)
 				return nil
 			}
-			stats, err := b.Prune(deadline, s.c.BackupPruningPrefix)
-			if err != nil {
-				return err
+			var total StorageStats
+			for _, target := range s.pruningTargets() {
+				stats, err := b.Prune(policy, target.prefix)
+				if err != nil {
+					return err
+				}
+				total.Total += stats.Total
+				total.Pruned += stats.Pruned
+				if target.source == "" {
+					continue
+				}
+				s.stats.Lock()
+				source := s.stats.Sources[target.source]
+				if source.Storages == nil {
+					source.Storages = map[string]StorageStats{}
+				}
+				source.Storages[b.Name()] = StorageStats{
+					Total:  stats.Total,
+					Pruned: stats.Pruned,
+				}
+				s.stats.Sources[target.source] = source
+				s.stats.Unlock()
 			}
 			s.stats.Lock()
-			s.stats.Storages[b.Name()] = StorageStats{
-				Total:  stats.Total,
-				Pruned: stats.Pruned,
-			}
+			storage := s.stats.Storages[b.Name()]
+			storage.Total, storage.Pruned, storage.PruneErrors = total.Total, total.Pruned, total.PruneErrors
+			s.stats.Storages[b.Name()] = storage
 			s.stats.Unlock()
+
+			if s.c.BackupRepository {
+				removed, err := s.collectGarbage(b)
+				if err != nil {
+					return errwrap.Wrap(err, fmt.Sprintf("error collecting garbage in %s", b.Name()))
+				}
+				s.logger.Info(
+					fmt.Sprintf("Removed %d unreferenced chunks from %s.", removed, b.Name()),
+				)
+			}
 			return nil
 		})
 	}
@@ -54,6 +85,25 @@ func (s *script) pruneBackups() error {
 	return nil
 }
 
+// retentionPolicy returns the retention policy defined by the given
+// configuration. In case no retention is configured, false is returned.
+func (s *script) retentionPolicy() (storage.RetentionPolicy, bool) {
+	policy := storage.RetentionPolicy{
+		// Keeping a number of most recent backups makes sure a number of
+		// backups survives even if no new backups have been created for
+		// longer than the retention period.
+		KeepLast:    s.c.BackupRetentionKeepLast,
+		KeepDaily:   s.c.BackupRetentionKeepDaily,
+		KeepWeekly:  s.c.BackupRetentionKeepWeekly,
+		KeepMonthly: s.c.BackupRetentionKeepMonthly,
+		KeepYearly:  s.c.BackupRetentionKeepYearly,
+	}
+	if s.c.BackupRetentionDays >= 0 {
+		policy.Deadline = time.Now().AddDate(0, 0, -int(s.c.BackupRetentionDays)).Add(s.c.BackupPruningLeeway)
+	}
+	return policy, policy != (storage.RetentionPolicy{})
+}
+
 // skipPrune returns true if the given backend name is contained in the
 // list of skipped backends.
 func skipPrune(name string, skippedBackends []string) bool {
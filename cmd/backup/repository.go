@@ -0,0 +1,576 @@
+// Copyright 2026 - offen.software <hioffen@posteo.de>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/offen/docker-volume-backup/internal/chunker"
+	"github.com/offen/docker-volume-backup/internal/errwrap"
+	"github.com/offen/docker-volume-backup/internal/storage"
+	"golang.org/x/sync/errgroup"
+)
+
+// snapshotFormat identifies snapshot indexes. As it is the value of the first
+// field, snapshots can be told apart from tar archives by their leading bytes.
+const snapshotFormat = "docker-volume-backup-snapshot/v1"
+
+// snapshotIndex is written instead of a tar archive in repository mode. It
+// describes all archived files and the chunks their contents are stored in.
+type snapshotIndex struct {
+	Format  string          `json:"format"`
+	Sources string          `json:"sources"`
+	Entries []snapshotEntry `json:"entries"`
+}
+
+// snapshotEntry describes a single file of a snapshot using the tar header
+// that is written when assembling the snapshot into a tar stream.
+type snapshotEntry struct {
+	Header *tar.Header `json:"header"`
+	Chunks []chunkRef  `json:"chunks,omitempty"`
+}
+
+// chunkRef references a stored chunk alongside the checksum of its
+// plaintext, which is used for verifying the chunk after downloading it.
+type chunkRef struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+}
+
+// chunkUploadConcurrency limits the number of chunks that are uploaded
+// concurrently, and thereby the number of encoded chunks held in memory.
+const chunkUploadConcurrency = 8
+
+// isSnapshot checks whether the given decompressed contents of a backup are
+// a snapshot index instead of a tar archive.
+func isSnapshot(r *bufio.Reader) (bool, error) {
+	magic := fmt.Sprintf(`{"format":%q`, snapshotFormat)
+	head, err := r.Peek(len(magic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, errwrap.Wrap(err, "error reading leading bytes")
+	}
+	return string(head) == magic, nil
+}
+
+// createSnapshot splits all files of the configured backup location into
+// content defined chunks and uploads each chunk that is not yet stored to
+// all configured storage backends. The index describing the snapshot is
+// saved to disk so it can be processed like a regular archive.
+func (s *script) createSnapshot() error {
+	if len(s.storages) == 0 {
+		return errwrap.Wrap(nil, "repository mode requires at least one storage backend")
+	}
+
+	backupSources, filesEligibleForBackup, err := s.collectFilesForBackup()
+	if err != nil {
+		return errwrap.Wrap(err, "error collecting files for backup")
+	}
+
+	store, err := s.newChunkStore()
+	if err != nil {
+		return errwrap.Wrap(err, "error opening repository")
+	}
+
+	snapshotFile := s.file
+	s.registerHook(hookLevelPlumbing, func(error) error {
+		if err := remove(snapshotFile); err != nil {
+			return errwrap.Wrap(err, "error removing snapshot file")
+		}
+		s.logger.Info(
+			fmt.Sprintf("Removed snapshot file `%s`.", snapshotFile),
+		)
+		return nil
+	})
+
+	_, outputFilePath, err := makeAbsolute(stripTrailingSlashes(backupSources), snapshotFile)
+	if err != nil {
+		return errwrap.Wrap(err, "error transposing given file paths")
+	}
+	prefix := path.Dir(outputFilePath)
+
+	index := snapshotIndex{
+		Format:  snapshotFormat,
+		Sources: backupSources,
+	}
+	for _, p := range filesEligibleForBackup {
+		entry, archived, err := store.addFile(p, prefix)
+		if err != nil {
+			return errors.Join(errwrap.Wrap(err, fmt.Sprintf("error adding %s to repository", p)), store.wait())
+		}
+		if entry != nil {
+			index.Entries = append(index.Entries, *entry)
+			s.archivedFiles = append(s.archivedFiles, *archived)
+		}
+	}
+	if err := store.wait(); err != nil {
+		return errwrap.Wrap(err, "error uploading chunks")
+	}
+
+	if err := s.writeSnapshotIndex(outputFilePath, &index); err != nil {
+		return errwrap.Wrap(err, "error writing snapshot index")
+	}
+	s.snapshotChunks = store.referencedChunks()
+
+	s.logger.Info(
+		fmt.Sprintf(
+			"Created snapshot of `%s` at `%s` referencing %d chunks, %d of which have been uploaded (%d bytes).",
+			backupSources, snapshotFile, len(s.snapshotChunks), store.uploadedChunks, store.uploadedBytes,
+		),
+	)
+	return nil
+}
+
+// writeSnapshotIndex writes the given index to the file at the given
+// location using the configured compression.
+func (s *script) writeSnapshotIndex(location string, index *snapshotIndex) (returnErr error) {
+	if err := os.MkdirAll(filepath.Dir(location), 0755); err != nil {
+		return errwrap.Wrap(err, "error creating output file path")
+	}
+	file, err := os.Create(location)
+	if err != nil {
+		return errwrap.Wrap(err, "error creating out file")
+	}
+	defer func() {
+		returnErr = errors.Join(returnErr, file.Close())
+	}()
+
+	compressWriter, err := getCompressionWriter(file, s.c.BackupCompression.String(), s.c.GzipParallelism.Int())
+	if err != nil {
+		return errwrap.Wrap(err, "error getting compression writer")
+	}
+	if err := json.NewEncoder(compressWriter).Encode(index); err != nil {
+		return errwrap.Wrap(err, "error encoding snapshot index")
+	}
+	if err := compressWriter.Close(); err != nil {
+		return errwrap.Wrap(err, "error closing compression writer")
+	}
+	return nil
+}
+
+// chunkStore stores chunks in all configured storage backends, skipping
+// chunks that are already present. Chunks are uploaded in the background,
+// so wait needs to be called once all files have been added.
+type chunkStore struct {
+	s         *script
+	extension string
+	encryptor encryptor
+	// macKey is used for naming encrypted chunks, so their names do not
+	// reveal the checksum of their plaintext. fingerprint identifies the
+	// keys chunks are encrypted with, so changing them does not reuse chunks
+	// that have been encrypted using other keys.
+	macKey      []byte
+	fingerprint string
+	// stored holds the names of the chunks present in each storage backend,
+	// using the same order as the script's storages.
+	stored     []map[string]bool
+	referenced map[string]bool
+
+	eg  *errgroup.Group
+	ctx context.Context
+
+	uploadedChunks int
+	uploadedBytes  int
+}
+
+func (s *script) newChunkStore() (*chunkStore, error) {
+	extension, encryptor, err := s.getEncryptor()
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error getting encryptor")
+	}
+	eg, ctx := errgroup.WithContext(context.Background())
+	eg.SetLimit(chunkUploadConcurrency)
+	store := &chunkStore{
+		s:          s,
+		extension:  extension,
+		encryptor:  encryptor,
+		referenced: map[string]bool{},
+		eg:         eg,
+		ctx:        ctx,
+	}
+	if encryptor != nil {
+		// A random key would change whenever the container is recreated,
+		// causing all chunks to be uploaded again, so the key has to be
+		// configured explicitly.
+		key := strings.TrimSpace(s.c.BackupRepositoryKey)
+		if key == "" {
+			return nil, errwrap.Wrap(nil, "BACKUP_REPOSITORY_KEY or BACKUP_REPOSITORY_KEY_FILE is required for naming encrypted chunks, cannot continue")
+		}
+		store.macKey = []byte(key)
+		mac := hmac.New(sha256.New, store.macKey)
+		mac.Write([]byte(s.c.encryptionIdentity()))
+		store.fingerprint = hex.EncodeToString(mac.Sum(nil)[:8])
+	}
+	for _, backend := range s.storages {
+		chunks, err := backend.List(storage.ChunkPrefix)
+		if err != nil {
+			return nil, errwrap.Wrap(err, fmt.Sprintf("error listing chunks in %s", backend.Name()))
+		}
+		stored := make(map[string]bool, len(chunks))
+		for _, chunk := range chunks {
+			stored[chunk.Name] = true
+		}
+		store.stored = append(store.stored, stored)
+	}
+	return store, nil
+}
+
+// addFile stores the contents of the file at the given path and returns the
+// snapshot entry describing it. The given prefix is stripped from the path
+// when naming the entry. Sockets are skipped.
+func (c *chunkStore) addFile(p, prefix string) (_ *snapshotEntry, _ *archivedFile, returnErr error) {
+	fileInfo, err := os.Lstat(p)
+	if err != nil {
+		return nil, nil, errwrap.Wrap(err, fmt.Sprintf("error getting file info for %s", p))
+	}
+	if fileInfo.Mode()&os.ModeSocket == os.ModeSocket {
+		return nil, nil, nil
+	}
+
+	var link string
+	if fileInfo.Mode()&os.ModeSymlink == os.ModeSymlink {
+		if link, err = os.Readlink(p); err != nil {
+			return nil, nil, errwrap.Wrap(err, fmt.Sprintf("error resolving symlink %s", p))
+		}
+	}
+
+	header, err := tar.FileInfoHeader(fileInfo, link)
+	if err != nil {
+		return nil, nil, errwrap.Wrap(err, "error getting file info header")
+	}
+	header.Name = strings.TrimPrefix(p, prefix)
+
+	entry := &snapshotEntry{Header: header}
+	archived := &archivedFile{
+		Path: header.Name,
+		Mode: fileInfo.Mode().String(),
+	}
+	if !fileInfo.Mode().IsRegular() {
+		return entry, archived, nil
+	}
+
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, nil, errwrap.Wrap(err, fmt.Sprintf("error opening %s", p))
+	}
+	defer func() {
+		returnErr = errors.Join(returnErr, file.Close())
+	}()
+
+	hash := sha256.New()
+	chunks := chunker.New(io.TeeReader(file, hash))
+	for {
+		chunk, err := chunks.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, errwrap.Wrap(err, fmt.Sprintf("error reading %s", p))
+		}
+		ref, err := c.put(chunk)
+		if err != nil {
+			return nil, nil, errwrap.Wrap(err, "error storing chunk")
+		}
+		entry.Chunks = append(entry.Chunks, ref)
+		archived.Size += int64(len(chunk))
+	}
+	// The file might have changed size since calling Lstat, so the header
+	// needs to describe the contents that have actually been stored.
+	header.Size = archived.Size
+	archived.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	return entry, archived, nil
+}
+
+// put schedules uploading the given chunk to all storage backends it is
+// missing from and returns a reference to it. Unencrypted chunks are named
+// after the checksum of their plaintext, encrypted chunks are named using
+// the fingerprint of the encryption keys and a keyed hash of their
+// plaintext.
+func (c *chunkStore) put(chunk []byte) (chunkRef, error) {
+	if err := c.ctx.Err(); err != nil {
+		return chunkRef{}, errwrap.Wrap(context.Cause(c.ctx), "error uploading previous chunk")
+	}
+
+	sum := sha256.Sum256(chunk)
+	ref := chunkRef{
+		Name:   storage.ChunkPrefix + hex.EncodeToString(sum[:]),
+		SHA256: hex.EncodeToString(sum[:]),
+	}
+	if c.macKey != nil {
+		mac := hmac.New(sha256.New, c.macKey)
+		mac.Write(chunk)
+		ref.Name = fmt.Sprintf("%s%s-%x.%s", storage.ChunkPrefix, c.fingerprint, mac.Sum(nil), c.extension)
+	}
+	c.referenced[ref.Name] = true
+
+	var missing []storage.Backend
+	for i, stored := range c.stored {
+		if !stored[ref.Name] {
+			missing = append(missing, c.s.storages[i])
+			stored[ref.Name] = true
+		}
+	}
+	if len(missing) == 0 {
+		return ref, nil
+	}
+
+	// encode returns a new buffer, so the chunk can be reused by the caller
+	// while the upload is in progress.
+	encoded, err := c.encode(chunk)
+	if err != nil {
+		return chunkRef{}, errwrap.Wrap(err, "error encoding chunk")
+	}
+	for _, b := range missing {
+		c.eg.Go(func() error {
+			if err := b.Upload(ref.Name, bytes.NewReader(encoded)); err != nil {
+				return errwrap.Wrap(err, fmt.Sprintf("error uploading chunk to %s", b.Name()))
+			}
+			return nil
+		})
+	}
+	c.uploadedChunks++
+	c.uploadedBytes += len(encoded)
+	return ref, nil
+}
+
+// wait blocks until all scheduled uploads have finished.
+func (c *chunkStore) wait() error {
+	return c.eg.Wait()
+}
+
+// encryptionIdentity returns a value that changes whenever the keys that
+// are used for encrypting backups change.
+func (c *Config) encryptionIdentity() string {
+	recipients := slices.Clone(c.AgePublicKeys)
+	sort.Strings(recipients)
+	return strings.Join(append([]string{c.GpgPassphrase, c.GpgPublicKeyRing, c.AgePassphrase}, recipients...), "\x00")
+}
+
+// encode compresses and encrypts the given chunk using the configured
+// methods.
+func (c *chunkStore) encode(chunk []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser = &passThroughWriteCloser{&buf}
+	if c.encryptor != nil {
+		var err error
+		w, err = c.encryptor(&buf)
+		if err != nil {
+			return nil, errwrap.Wrap(err, "error encrypting chunk")
+		}
+	}
+	compressWriter, err := getCompressionWriter(w, c.s.c.BackupCompression.String(), c.s.c.GzipParallelism.Int())
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error getting compression writer")
+	}
+	if _, err := compressWriter.Write(chunk); err != nil {
+		return nil, errwrap.Wrap(err, "error compressing chunk")
+	}
+	if err := compressWriter.Close(); err != nil {
+		return nil, errwrap.Wrap(err, "error closing compression writer")
+	}
+	if err := w.Close(); err != nil {
+		return nil, errwrap.Wrap(err, "error closing encryption writer")
+	}
+	return buf.Bytes(), nil
+}
+
+// referencedChunks returns the sorted names of all chunks that have been
+// stored.
+func (c *chunkStore) referencedChunks() []string {
+	names := make([]string, 0, len(c.referenced))
+	for name := range c.referenced {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// openSnapshot reads the snapshot index from r and returns a tar stream of
+// all files it describes. Chunks are downloaded from the given backend while
+// the stream is read.
+func (s *script) openSnapshot(backend storage.Backend, r io.Reader) (io.ReadCloser, error) {
+	var index snapshotIndex
+	if err := json.NewDecoder(r).Decode(&index); err != nil {
+		return nil, errwrap.Wrap(err, "error decoding snapshot index")
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		_ = pw.CloseWithError(s.writeSnapshotArchive(backend, &index, pw))
+	}()
+	return pr, nil
+}
+
+// writeSnapshotArchive writes a tar archive of all files described by the
+// given index to w.
+func (s *script) writeSnapshotArchive(backend storage.Backend, index *snapshotIndex, w io.Writer) error {
+	tarWriter := tar.NewWriter(w)
+	for _, entry := range index.Entries {
+		if err := tarWriter.WriteHeader(entry.Header); err != nil {
+			return errwrap.Wrap(err, fmt.Sprintf("error writing header for %s", entry.Header.Name))
+		}
+		for _, chunk := range entry.Chunks {
+			if err := s.readChunk(backend, chunk, tarWriter); err != nil {
+				return errwrap.Wrap(err, fmt.Sprintf("error reading chunk %s of %s", chunk.Name, entry.Header.Name))
+			}
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return errwrap.Wrap(err, "error closing tar writer")
+	}
+	return nil
+}
+
+// readChunk downloads the given chunk, decrypts and decompresses it and
+// writes its plaintext to w after checking it against the checksum stored
+// in the index.
+func (s *script) readChunk(backend storage.Backend, ref chunkRef, w io.Writer) error {
+	var encoded bytes.Buffer
+	if err := backend.Download(ref.Name, &encoded); err != nil {
+		return errwrap.Wrap(err, fmt.Sprintf("error downloading chunk from %s", backend.Name()))
+	}
+	plaintext, err := s.decryptArchive(ref.Name, &encoded)
+	if err != nil {
+		return errwrap.Wrap(err, "error decrypting chunk")
+	}
+	decompressed, err := getDecompressionReader(plaintext)
+	if err != nil {
+		return errwrap.Wrap(err, "error decompressing chunk")
+	}
+	chunk, err := io.ReadAll(decompressed)
+	if err != nil {
+		return errors.Join(errwrap.Wrap(err, "error reading chunk"), decompressed.Close())
+	}
+	if err := decompressed.Close(); err != nil {
+		return errwrap.Wrap(err, "error closing decompression reader")
+	}
+
+	if sum := sha256.Sum256(chunk); hex.EncodeToString(sum[:]) != ref.SHA256 {
+		return errwrap.Wrap(nil, fmt.Sprintf("checksum mismatch: expected sha256 %s, got %x", ref.SHA256, sum))
+	}
+	if _, err := w.Write(chunk); err != nil {
+		return errwrap.Wrap(err, "error writing chunk")
+	}
+	return nil
+}
+
+// collectGarbage removes all chunks from the given backend that are not
+// referenced by any snapshot stored in it. References are read from the
+// chunks sidecar files, or from the index of snapshots that are missing
+// their sidecar file. In case it cannot be determined whether a backup
+// without sidecar file is a snapshot, e.g. because it cannot be decrypted,
+// no chunks are removed. It returns the number of removed chunks.
+func (s *script) collectGarbage(backend storage.Backend) (int, error) {
+	files, err := backend.List("")
+	if err != nil {
+		return 0, errwrap.Wrap(err, "error listing files")
+	}
+	names := map[string]bool{}
+	for _, file := range files {
+		names[file.Name] = true
+	}
+
+	var chunks []string
+	referenced := map[string]bool{}
+	for _, file := range files {
+		switch {
+		case storage.IsChunk(file.Name):
+			chunks = append(chunks, file.Name)
+		case strings.HasSuffix(file.Name, storage.ChunksSuffix):
+			var buf bytes.Buffer
+			if err := backend.Download(file.Name, &buf); err != nil {
+				return 0, errwrap.Wrap(err, fmt.Sprintf("error downloading %s", file.Name))
+			}
+			for _, name := range strings.Fields(buf.String()) {
+				referenced[name] = true
+			}
+		case storage.IsSidecar(file.Name), names[file.Name+storage.ChunksSuffix]:
+		default:
+			index, err := s.downloadSnapshotIndex(backend, file.Name)
+			if err != nil {
+				s.logger.Warn(
+					fmt.Sprintf("Skipping removal of unreferenced chunks in %s as `%s` could not be read: %v", backend.Name(), file.Name, err),
+				)
+				return 0, nil
+			}
+			if index == nil {
+				continue
+			}
+			for _, entry := range index.Entries {
+				for _, chunk := range entry.Chunks {
+					referenced[chunk.Name] = true
+				}
+			}
+		}
+	}
+
+	var unreferenced []string
+	for _, chunk := range chunks {
+		if !referenced[chunk] {
+			unreferenced = append(unreferenced, chunk)
+		}
+	}
+	if len(unreferenced) == 0 {
+		return 0, nil
+	}
+	if err := backend.Remove(unreferenced); err != nil {
+		return 0, errwrap.Wrap(err, "error removing unreferenced chunks")
+	}
+	return len(unreferenced), nil
+}
+
+// downloadSnapshotIndex returns the index of the backup of the given name in
+// case it is a snapshot, or nil in case it is an archive. Downloading an
+// archive is aborted once its leading bytes have been read.
+func (s *script) downloadSnapshotIndex(backend storage.Backend, name string) (_ *snapshotIndex, returnErr error) {
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		_ = pw.CloseWithError(backend.Download(name, pw))
+		close(done)
+	}()
+	// Closing the reader aborts the download in case it has not finished.
+	defer func() {
+		_ = pr.Close()
+		<-done
+	}()
+
+	plaintext, err := s.decryptArchive(name, pr)
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error decrypting backup")
+	}
+	decompressed, err := getDecompressionReader(plaintext)
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error decompressing backup")
+	}
+	defer func() {
+		returnErr = errors.Join(returnErr, decompressed.Close())
+	}()
+
+	contents := bufio.NewReader(decompressed)
+	if ok, err := isSnapshot(contents); err != nil || !ok {
+		return nil, err
+	}
+	var index snapshotIndex
+	if err := json.NewDecoder(contents).Decode(&index); err != nil {
+		return nil, errwrap.Wrap(err, "error decoding snapshot index")
+	}
+	return &index, nil
+}
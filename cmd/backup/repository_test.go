@@ -0,0 +1,184 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/offen/docker-volume-backup/internal/storage"
+)
+
+func TestChunkStorePut(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      Config
+		plaintext   bool
+		expectError bool
+	}{
+		{
+			"unencrypted",
+			Config{BackupCompression: "gz"},
+			true,
+			false,
+		},
+		{
+			"encrypted",
+			Config{BackupCompression: "gz", GpgPassphrase: "first", BackupRepositoryKey: "key"},
+			false,
+			false,
+		},
+		{
+			"encrypted with other key",
+			Config{BackupCompression: "gz", GpgPassphrase: "second", BackupRepositoryKey: "key"},
+			false,
+			false,
+		},
+		{
+			"encrypted without repository key",
+			Config{BackupCompression: "gz", GpgPassphrase: "first"},
+			false,
+			true,
+		},
+	}
+
+	chunk := []byte("contents")
+	plaintextName := storage.ChunkPrefix + "d1b2a59fbea7e20077af9f91b27e95e865061b270be03ff539ab3b73587882e8"
+	names := map[string]bool{}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backend := newMemoryBackend("Memory")
+			s := &script{c: &test.config, storages: []storage.Backend{backend}}
+			store, err := s.newChunkStore()
+			if (err != nil) != test.expectError {
+				t.Fatalf("Unexpected error value %v", err)
+			}
+			if err != nil {
+				return
+			}
+			ref, err := store.put(chunk)
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if err := store.wait(); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+
+			if (ref.Name == plaintextName) != test.plaintext {
+				t.Errorf("Unexpected chunk name %s", ref.Name)
+			}
+			if names[ref.Name] {
+				t.Errorf("Expected chunk name %s to be unique", ref.Name)
+			}
+			names[ref.Name] = true
+			if _, ok := backend.files[ref.Name]; !ok {
+				t.Errorf("Expected chunk %s to be uploaded", ref.Name)
+			}
+
+			var buf bytes.Buffer
+			if err := s.readChunk(backend, ref, &buf); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), chunk) {
+				t.Errorf("Expected %q, got %q", chunk, buf.Bytes())
+			}
+		})
+	}
+}
+
+func TestCollectGarbage(t *testing.T) {
+	c := &Config{BackupCompression: "gz"}
+	backend := newMemoryBackend("Memory")
+	s := &script{
+		c:        c,
+		storages: []storage.Backend{backend},
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	snapshot := func(name string, sidecar bool, contents ...string) {
+		store, err := s.newChunkStore()
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		index := snapshotIndex{Format: snapshotFormat}
+		for _, content := range contents {
+			ref, err := store.put([]byte(content))
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			index.Entries = append(index.Entries, snapshotEntry{
+				Header: &tar.Header{Name: content, Typeflag: tar.TypeReg, Size: int64(len(content))},
+				Chunks: []chunkRef{ref},
+			})
+		}
+		if err := store.wait(); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		location := filepath.Join(t.TempDir(), name)
+		if err := s.writeSnapshotIndex(location, &index); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		data, err := os.ReadFile(location)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		backend.files[name] = data
+		if sidecar {
+			backend.files[name+storage.ChunksSuffix] = []byte(strings.Join(store.referencedChunks(), "\n"))
+		}
+	}
+
+	snapshot("with-sidecar.snapshot.gz", true, "first")
+	snapshot("without-sidecar.snapshot.gz", false, "second")
+	snapshot("pruned.snapshot.gz", true, "third")
+	delete(backend.files, "pruned.snapshot.gz")
+	delete(backend.files, "pruned.snapshot.gz"+storage.ChunksSuffix)
+	backend.files["archive.tar"] = []byte("not a snapshot")
+
+	removed, err := s.collectGarbage(backend)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("Expected 1 removed chunk, got %d", removed)
+	}
+
+	// Backups that cannot be read might be snapshots, so no chunks are
+	// removed in case any exist.
+	backend.files["broken.tar.gpg"] = []byte("not decryptable")
+	snapshot("orphaned.snapshot.gz", true, "fourth")
+	delete(backend.files, "orphaned.snapshot.gz")
+	if removed, err := s.collectGarbage(backend); err != nil || removed != 0 {
+		t.Errorf("Expected no chunks to be removed, got %d and %v", removed, err)
+	}
+	delete(backend.files, "broken.tar.gpg")
+
+	var restored []string
+	for _, name := range []string{"with-sidecar.snapshot.gz", "without-sidecar.snapshot.gz"} {
+		if _, err := s.readArchive(backend, name, func(r io.Reader) (int, error) {
+			tr := tar.NewReader(r)
+			for {
+				if _, err := tr.Next(); errors.Is(err, io.EOF) {
+					return 0, nil
+				} else if err != nil {
+					return 0, err
+				}
+				content, err := io.ReadAll(tr)
+				if err != nil {
+					return 0, err
+				}
+				restored = append(restored, string(content))
+			}
+		}); err != nil {
+			t.Errorf("Unexpected error reading %s: %v", name, err)
+		}
+	}
+	if strings.Join(restored, ",") != "first,second" {
+		t.Errorf("Unexpected restored contents %v", restored)
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright 2026 - offen.software <hioffen@posteo.de>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/offen/docker-volume-backup/internal/errwrap"
+	"github.com/offen/docker-volume-backup/internal/storage"
+)
+
+type restoreOpts struct {
+	backend        string
+	target         string
+	stopContainers bool
+}
+
+// runRestore downloads the archive with the given name from one of the
+// configured storage backends, and decrypts, decompresses and extracts it.
+func runRestore(args []string) (err error) {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	source := flags.String("config", "", "the conf.d file to use, can be omitted if only a single configuration exists")
+	backend := flags.String("backend", "", "the storage backend to download the archive from, can be omitted if only a single backend is configured")
+	target := flags.String("target", "/", "the directory the archive is extracted into, entries are restored at their original path relative to this directory")
+	stopContainers := flags.Bool("stop-containers", false, "stop and restart labeled containers and services around the restore")
+	if err := flags.Parse(args); err != nil {
+		return errwrap.Wrap(err, "error parsing flags")
+	}
+	if flags.NArg() != 1 {
+		return errwrap.Wrap(nil, "expected the name of the archive to restore as the only argument")
+	}
+
+	config, err := selectConfiguration(*source)
+	if err != nil {
+		return errwrap.Wrap(err, "error selecting configuration")
+	}
+
+	s := newScript(config)
+
+	unlock, lockErr := s.lock("/var/lock/dockervolumebackup.lock")
+	if lockErr != nil {
+		return errwrap.Wrap(lockErr, "error acquiring file lock")
+	}
+	defer func() {
+		if derr := unlock(); derr != nil {
+			err = errors.Join(err, errwrap.Wrap(derr, "error releasing file lock"))
+		}
+	}()
+
+	restoreErr := s.runSubcommand(func() error {
+		return s.restoreArchive(flags.Arg(0), restoreOpts{
+			backend:        *backend,
+			target:         *target,
+			stopContainers: *stopContainers,
+		})
+	}, false)
+	if restoreErr != nil {
+		return errwrap.Wrap(restoreErr, "error restoring archive")
+	}
+	return nil
+}
+
+// restoreArchive streams the archive of the given name from the selected
+// storage backend and extracts it into the target directory.
+func (s *script) restoreArchive(name string, opts restoreOpts) (err error) {
+	backend, err := s.storageByName(opts.backend)
+	if err != nil {
+		return errwrap.Wrap(err, "error selecting storage backend")
+	}
+
+	if opts.stopContainers {
+		restartContainersAndServices, stopErr := s.stopContainersAndServices()
+		defer func() {
+			if derr := restartContainersAndServices(); derr != nil {
+				err = errors.Join(err, errwrap.Wrap(derr, "error restarting containers and services"))
+			}
+		}()
+		if stopErr != nil {
+			return stopErr
+		}
+	}
+
+	numEntries, err := s.readArchive(backend, name, func(r io.Reader) (int, error) {
+		return extractArchive(r, opts.target)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info(
+		fmt.Sprintf("Restored %d entries from backup `%s` stored in %s into `%s`.", numEntries, name, backend.Name(), opts.target),
+	)
+	return nil
+}
+
+// readArchive streams the archive of the given name from the given storage
+// backend, decrypts and decompresses it and passes the resulting tar stream
+// to consume. Snapshots are passed as a tar stream assembled from their
+// chunks. It returns the number of entries consume has processed.
+func (s *script) readArchive(backend storage.Backend, name string, consume func(io.Reader) (int, error)) (_ int, returnErr error) {
+	pr, pw := io.Pipe()
+	downloadErr := make(chan error, 1)
+	go func() {
+		err := backend.Download(name, pw)
+		_ = pw.CloseWithError(err)
+		downloadErr <- err
+	}()
+	defer func() {
+		_ = pr.Close()
+	}()
+
+	plaintext, err := s.decryptArchive(name, pr)
+	if err != nil {
+		return 0, errwrap.Wrap(err, "error decrypting archive")
+	}
+	decompressed, err := getDecompressionReader(plaintext)
+	if err != nil {
+		return 0, errwrap.Wrap(err, "error decompressing archive")
+	}
+	defer func() {
+		if derr := decompressed.Close(); derr != nil {
+			returnErr = errors.Join(returnErr, errwrap.Wrap(derr, "error closing decompression reader"))
+		}
+	}()
+
+	contents := bufio.NewReader(decompressed)
+	ok, err := isSnapshot(contents)
+	if err != nil {
+		return 0, errwrap.Wrap(err, "error reading archive")
+	}
+	var tarStream io.Reader = contents
+	if ok {
+		snapshot, err := s.openSnapshot(backend, contents)
+		if err != nil {
+			return 0, errwrap.Wrap(err, "error opening snapshot")
+		}
+		defer func() {
+			_ = snapshot.Close()
+		}()
+		tarStream = snapshot
+	}
+
+	numEntries, err := consume(tarStream)
+	if err != nil {
+		return numEntries, errwrap.Wrap(err, "error reading archive")
+	}
+
+	// Integrity checks of encrypted archives only happen when the ciphertext
+	// has been read completely, so any trailing data needs to be consumed.
+	if _, err := io.Copy(io.Discard, contents); err != nil {
+		return numEntries, errwrap.Wrap(err, "error reading trailing data of archive")
+	}
+	if _, err := io.Copy(io.Discard, plaintext); err != nil {
+		return numEntries, errwrap.Wrap(err, "error reading trailing data of archive")
+	}
+	if err := <-downloadErr; err != nil {
+		return numEntries, errwrap.Wrap(err, fmt.Sprintf("error downloading archive from %s", backend.Name()))
+	}
+	return numEntries, nil
+}
+
+// storageByName returns the configured storage backend with the given name.
+// In case no name is given, a backend is only returned if it is the only one
+// that is configured.
+func (s *script) storageByName(name string) (storage.Backend, error) {
+	if name == "" {
+		switch len(s.storages) {
+		case 0:
+			return nil, errwrap.Wrap(nil, "no storage backends are configured")
+		case 1:
+			return s.storages[0], nil
+		default:
+			return nil, errwrap.Wrap(nil, fmt.Sprintf("%d storage backends are configured, please choose one", len(s.storages)))
+		}
+	}
+	for _, b := range s.storages {
+		if strings.EqualFold(b.Name(), name) {
+			return b, nil
+		}
+	}
+	return nil, errwrap.Wrap(nil, fmt.Sprintf("storage backend %s is not configured", name))
+}
+
+// selectConfiguration returns the configuration loaded from the given source.
+// In case no source is given, a configuration is only returned if it is the
+// only one available.
+func selectConfiguration(source string) (*Config, error) {
+	configurations, err := sourceConfiguration(configStrategyConfd)
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error sourcing configuration")
+	}
+	if source == "" {
+		if len(configurations) != 1 {
+			return nil, errwrap.Wrap(nil, fmt.Sprintf("%d configurations are available, please choose one", len(configurations)))
+		}
+		return configurations[0], nil
+	}
+	for _, c := range configurations {
+		if c.source == source {
+			return c, nil
+		}
+	}
+	return nil, errwrap.Wrap(nil, fmt.Sprintf("no configuration found for %s", source))
+}
+
+// runSubcommand resolves the script's configuration and instantiates the
+// script before calling fn. Subcommands only send out notifications in case
+// notify is set, but resources that have been acquired during instantiation
+// are always released afterwards.
+func (s *script) runSubcommand(fn func() error, notify bool) (err error) {
+	unset, warnings, err := s.c.resolve()
+	if err != nil {
+		return errwrap.Wrap(err, "error applying env")
+	}
+	defer func() {
+		if derr := unset(); derr != nil {
+			err = errors.Join(err, errwrap.Wrap(derr, "error unsetting environment variables"))
+		}
+	}()
+	for _, w := range warnings {
+		s.logger.Warn(w)
+	}
+
+	cmdErr := func() error {
+		if err := s.init(); err != nil {
+			return errwrap.Wrap(err, "error instantiating script")
+		}
+		return fn()
+	}()
+
+	if !notify {
+		s.hookLevel = hookLevelPlumbing
+	}
+	if hookErr := s.runHooks(cmdErr); hookErr != nil {
+		return errors.Join(cmdErr, errwrap.Wrap(hookErr, "error calling the registered hooks"))
+	}
+	return cmdErr
+}
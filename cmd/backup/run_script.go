@@ -6,6 +6,7 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"runtime/debug"
 	"time"
@@ -16,8 +17,9 @@ import (
 // runScript instantiates a new script object and orchestrates a backup run.
 // To ensure it runs mutually exclusive a global file lock is acquired before
 // it starts running. Any panic within the script will be recovered and returned
-// as an error.
-func runScript(c *Config) (err error) {
+// as an error. The stats of the run are returned in any case. Log output is
+// additionally written to the given writers.
+func runScript(c *Config, logOutput ...io.Writer) (stats *Stats, err error) {
 	defer func() {
 		if derr := recover(); derr != nil {
 			fmt.Printf("%s: %s\n", derr, debug.Stack())
@@ -30,7 +32,8 @@ func runScript(c *Config) (err error) {
 		}
 	}()
 
-	s := newScript(c)
+	s := newScript(c, logOutput...)
+	stats = s.stats
 
 	unlock, lockErr := s.lock("/var/lock/dockervolumebackup.lock")
 	if lockErr != nil {
@@ -45,7 +48,8 @@ func runScript(c *Config) (err error) {
 
 	unset, warnings, err := s.c.resolve()
 	if err != nil {
-		return errwrap.Wrap(err, "error applying env")
+		err = errwrap.Wrap(err, "error applying env")
+		return
 	}
 	defer func() {
 		if derr := unset(); derr != nil {
@@ -55,6 +59,15 @@ func runScript(c *Config) (err error) {
 	for _, w := range warnings {
 		s.logger.Warn(w)
 	}
+	defer func() {
+		if derr := s.exportMetrics(err); derr != nil {
+			s.logger.Error(
+				fmt.Sprintf("Failed to export metrics: %v", errwrap.Unwrap(derr)),
+				"error",
+				derr,
+			)
+		}
+	}()
 
 	if s.c != nil && s.c.BackupJitter > 0 {
 		max := s.c.BackupJitter
@@ -83,6 +96,16 @@ func runScript(c *Config) (err error) {
 
 	err = func() (err error) {
 		scriptErr := func() error {
+			archive := s.forEachSource(s.createArchive)
+			if s.c.BackupStreaming {
+				// When streaming, the archive is encrypted and uploaded while it
+				// is being created, so all of these phases happen while
+				// containers are stopped.
+				archive = s.withLabeledCommands(
+					lifecyclePhaseProcess,
+					s.withLabeledCommands(lifecyclePhaseCopy, s.forEachSource(s.streamArchive)),
+				)
+			}
 			if err := s.withLabeledCommands(lifecyclePhaseArchive, func() (err error) {
 				restartContainersAndServices, err := s.stopContainersAndServices()
 				// The mechanism for restarting containers is not using hooks as it
@@ -96,17 +119,23 @@ func runScript(c *Config) (err error) {
 				if err != nil {
 					return
 				}
-				err = s.createArchive()
+				if err = s.copyDiscoveredVolumes(); err != nil {
+					err = errwrap.Wrap(err, "error copying discovered volumes")
+					return
+				}
+				err = archive()
 				return
 			})(); err != nil {
 				return err
 			}
 
-			if err := s.withLabeledCommands(lifecyclePhaseProcess, s.encryptArchive)(); err != nil {
-				return err
-			}
-			if err := s.withLabeledCommands(lifecyclePhaseCopy, s.copyArchive)(); err != nil {
-				return err
+			if !s.c.BackupStreaming {
+				if err := s.withLabeledCommands(lifecyclePhaseProcess, s.forEachSource(s.encryptArchive))(); err != nil {
+					return err
+				}
+				if err := s.withLabeledCommands(lifecyclePhaseCopy, s.forEachSource(s.copyArchive))(); err != nil {
+					return err
+				}
 			}
 			if err := s.withLabeledCommands(lifecyclePhasePrune, s.pruneBackups)(); err != nil {
 				return err
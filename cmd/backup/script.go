@@ -5,6 +5,7 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"path"
@@ -38,9 +39,30 @@ type script struct {
 	template  *template.Template
 	hooks     []hook
 	hookLevel hookLevel
+	// notificationScope selects the set of notification templates that is
+	// used, e.g. `verify` selects `title_verify_success` and so on. The
+	// templates for backup runs are used in case it is empty.
+	notificationScope string
 
-	file  string
-	stats *Stats
+	// backupSources is the location that is backed up into the current
+	// archive. It points to a directory within BACKUP_SOURCES in case
+	// backups are split by directory.
+	backupSources  string
+	sourceArchives []*sourceArchive
+	// volumeCopies lists the locations discovered volumes have been copied
+	// to. They are archived as if they were located in BACKUP_SOURCES.
+	volumeCopies []string
+
+	file          string
+	archivedFiles []archivedFile
+	deletedFiles  []string
+	stats         *Stats
+	// incrementalBase is the name of the full backup the current backup is
+	// based on in case it is an incremental backup.
+	incrementalBase string
+	// snapshotChunks lists the names of all chunks the current snapshot
+	// references in case repository mode is enabled.
+	snapshotChunks []string
 
 	encounteredLock bool
 
@@ -50,9 +72,9 @@ type script struct {
 // newScript creates all resources needed for the script to perform actions against
 // remote resources like the Docker engine or remote storage locations. All
 // reading from env vars or other configuration sources is expected to happen
-// in this method.
-func newScript(c *Config) *script {
-	stdOut, logBuffer := buffer(os.Stdout)
+// in this method. Log output is additionally written to the given writers.
+func newScript(c *Config, logOutput ...io.Writer) *script {
+	stdOut, logBuffer := buffer(io.MultiWriter(append([]io.Writer{os.Stdout}, logOutput...)...))
 	return &script{
 		c:      c,
 		logger: slog.New(slog.NewTextHandler(stdOut, nil)),
@@ -68,6 +90,7 @@ func newScript(c *Config) *script {
 				"Dropbox":     {},
 				"GoogleDrive": {},
 			},
+			Sources: map[string]SourceStats{},
 		},
 	}
 }
@@ -119,6 +142,7 @@ func (s *script) init() error {
 		})
 	}
 
+	s.backupSources = s.c.BackupSources
 	s.file = path.Join("/tmp", s.c.BackupFilename)
 	s.file = timeutil.Strftime(&s.stats.StartTime, s.file)
 
@@ -0,0 +1,167 @@
+// Copyright 2026 - offen.software <hioffen@posteo.de>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/offen/docker-volume-backup/internal/errwrap"
+)
+
+// sourcePlaceholder is replaced with the name of the directory an archive
+// has been created for in case backups are split by directory.
+const sourcePlaceholder = "{{ .Source }}"
+
+// sourceArchive holds the state of the archive that is created for a single
+// top level directory in case backups are split by directory.
+type sourceArchive struct {
+	name           string
+	path           string
+	file           string
+	archivedFiles  []archivedFile
+	snapshotChunks []string
+}
+
+// forEachSource returns a function that calls fn once for each top level
+// directory in BACKUP_SOURCES in case backups are split by directory. Before
+// each call, the script is pointed at the archive of the respective
+// directory. In case backups are not split, fn is returned as is.
+func (s *script) forEachSource(fn func() error) func() error {
+	if !s.c.BackupSplitByDirectory {
+		return fn
+	}
+	return func() error {
+		if s.sourceArchives == nil {
+			sources, err := s.splitSources()
+			if err != nil {
+				return errwrap.Wrap(err, "error listing backup sources")
+			}
+			s.sourceArchives = sources
+		}
+		for _, a := range s.sourceArchives {
+			s.backupSources, s.file, s.archivedFiles, s.snapshotChunks = a.path, a.file, a.archivedFiles, a.snapshotChunks
+			err := fn()
+			a.file, a.archivedFiles, a.snapshotChunks = s.file, s.archivedFiles, s.snapshotChunks
+			if err != nil {
+				return errwrap.Wrap(err, fmt.Sprintf("error backing up `%s`", a.path))
+			}
+		}
+		return nil
+	}
+}
+
+// splitSources returns an archive for each top level directory in
+// BACKUP_SOURCES that is not excluded and for each discovered volume. Files
+// that are not contained in any directory are skipped.
+func (s *script) splitSources() ([]*sourceArchive, error) {
+	entries, err := os.ReadDir(s.c.BackupSources)
+	if err != nil {
+		return nil, errwrap.Wrap(err, fmt.Sprintf("error reading `%s`", s.c.BackupSources))
+	}
+
+	var sources []*sourceArchive
+	for _, entry := range entries {
+		location := filepath.Join(s.c.BackupSources, entry.Name())
+		if s.c.BackupExcludeRegexp.Re != nil && s.c.BackupExcludeRegexp.Re.MatchString(location) {
+			continue
+		}
+		if !entry.IsDir() {
+			s.logger.Warn(
+				fmt.Sprintf("Skipping `%s` as it is not a directory.", location),
+			)
+			continue
+		}
+		sources = append(sources, &sourceArchive{
+			name: entry.Name(),
+			path: location,
+			file: strings.ReplaceAll(s.file, sourcePlaceholder, entry.Name()),
+		})
+	}
+	for _, location := range s.volumeCopies {
+		name := filepath.Base(location)
+		sources = append(sources, &sourceArchive{
+			name: name,
+			path: location,
+			file: strings.ReplaceAll(s.file, sourcePlaceholder, name),
+		})
+	}
+	if len(sources) == 0 {
+		return nil, errwrap.Wrap(nil, fmt.Sprintf("no directories found in `%s`", s.c.BackupSources))
+	}
+	return sources, nil
+}
+
+// setBackupFile records the stats of the backup file that has been created.
+// In case backups are split by directory, the stats are recorded for the
+// current directory too.
+func (s *script) setBackupFile(stats BackupFileStats) {
+	s.stats.Lock()
+	defer s.stats.Unlock()
+	s.stats.BackupFile = stats
+	if s.c.BackupSplitByDirectory {
+		source := s.stats.Sources[filepath.Base(s.backupSources)]
+		source.BackupFile = stats
+		s.stats.Sources[filepath.Base(s.backupSources)] = source
+	}
+}
+
+// pruningTarget is a set of backups that is pruned separately.
+type pruningTarget struct {
+	source string
+	prefix string
+}
+
+// pruningTargets returns the sets of backups that are pruned separately. In
+// case backups are split by directory, the backups of each directory are
+// pruned separately.
+func (s *script) pruningTargets() []pruningTarget {
+	if !s.c.BackupSplitByDirectory {
+		return []pruningTarget{{prefix: s.c.BackupPruningPrefix}}
+	}
+	var targets []pruningTarget
+	for _, a := range s.sourceArchives {
+		targets = append(targets, pruningTarget{
+			source: a.name,
+			prefix: strings.ReplaceAll(s.c.BackupPruningPrefix, sourcePlaceholder, a.name),
+		})
+	}
+	return targets
+}
+
+// commonPruningPrefix returns the part of the pruning prefix that is shared
+// by the backups of all directories in case backups are split by directory.
+func (c *Config) commonPruningPrefix() string {
+	prefix, _, _ := strings.Cut(c.BackupPruningPrefix, sourcePlaceholder)
+	return prefix
+}
+
+// sourcePattern returns a pattern matching the names of the archives that
+// are created in case backups are split by directory, capturing the name of
+// the directory.
+func (c *Config) sourcePattern() *regexp.Regexp {
+	before, after, _ := strings.Cut(c.BackupFilename, sourcePlaceholder)
+	return regexp.MustCompile("^" + strftimePattern(before) + "(.+)" + strftimePattern(after))
+}
+
+// strftimePattern returns a pattern matching the given strftime format.
+func strftimePattern(format string) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] == '%' && i+1 < len(format) {
+			i++
+			if format[i] == '%' {
+				b.WriteString("%")
+			} else {
+				b.WriteString("[0-9A-Za-z:+]+")
+			}
+			continue
+		}
+		b.WriteString(regexp.QuoteMeta(format[i : i+1]))
+	}
+	return b.String()
+}
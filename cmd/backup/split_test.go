@@ -0,0 +1,176 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/offen/docker-volume-backup/internal/storage"
+	"github.com/offen/docker-volume-backup/internal/storage/local"
+)
+
+func TestForEachSource(t *testing.T) {
+	sources := t.TempDir()
+	for _, dir := range []string{"app", "db", "excluded"} {
+		if err := os.Mkdir(filepath.Join(sources, dir), 0755); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	writeFile(t, filepath.Join(sources, "file.txt"), "skipped")
+
+	s := &script{
+		c: &Config{
+			BackupSources:          sources,
+			BackupSplitByDirectory: true,
+			BackupExcludeRegexp:    RegexpDecoder{Re: regexp.MustCompile("excluded$")},
+			BackupPruningPrefix:    "backup-" + sourcePlaceholder + "-",
+		},
+		file:   "/tmp/backup-" + sourcePlaceholder + ".tar.gz",
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	var files []string
+	if err := s.forEachSource(func() error {
+		files = append(files, s.backupSources+":"+s.file)
+		// Encrypting an archive changes the name of the file, which needs
+		// to be kept for later phases.
+		s.file = s.file + ".gpg"
+		return nil
+	})(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := s.forEachSource(func() error {
+		files = append(files, s.backupSources+":"+s.file)
+		return nil
+	})(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	expectedFiles := []string{
+		filepath.Join(sources, "app") + ":/tmp/backup-app.tar.gz",
+		filepath.Join(sources, "db") + ":/tmp/backup-db.tar.gz",
+		filepath.Join(sources, "app") + ":/tmp/backup-app.tar.gz.gpg",
+		filepath.Join(sources, "db") + ":/tmp/backup-db.tar.gz.gpg",
+	}
+	if !reflect.DeepEqual(expectedFiles, files) {
+		t.Errorf("Expected %v, got %v", expectedFiles, files)
+	}
+
+	expectedTargets := []pruningTarget{
+		{source: "app", prefix: "backup-app-"},
+		{source: "db", prefix: "backup-db-"},
+	}
+	if targets := s.pruningTargets(); !reflect.DeepEqual(expectedTargets, targets) {
+		t.Errorf("Expected %v, got %v", expectedTargets, targets)
+	}
+	if prefix := s.c.commonPruningPrefix(); prefix != "backup-" {
+		t.Errorf("Unexpected common pruning prefix %s", prefix)
+	}
+}
+
+func TestSplitPruning(t *testing.T) {
+	c := &Config{
+		NotificationLevel:       "error",
+		BackupFilename:          "backup-{{ .Source }}-%Y-%m-%dT%H-%M-%S.{{ .Extension }}",
+		BackupCompression:       "gz",
+		BackupPruningPrefix:     "backup-",
+		BackupSplitByDirectory:  true,
+		BackupRetentionDays:     -1,
+		BackupRetentionKeepLast: 1,
+	}
+	reset, _, err := c.resolve()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer func() { _ = reset() }()
+
+	archive := t.TempDir()
+	backend := local.NewStorageBackend(local.Config{ArchivePath: archive}, func(storage.LogLevel, string, string, ...any) {})
+	s := &script{
+		c:              c,
+		storages:       []storage.Backend{backend},
+		stats:          &Stats{Storages: map[string]StorageStats{}, Sources: map[string]SourceStats{}},
+		logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+		sourceArchives: []*sourceArchive{{name: "app"}, {name: "db"}},
+	}
+
+	names := []string{
+		"backup-app-2026-10-14T04-00-00.tar.gz",
+		"backup-app-2026-10-15T04-00-00.tar.gz",
+		"backup-db-2026-10-13T04-00-00.tar.gz",
+	}
+	for i, name := range names {
+		location := filepath.Join(archive, name)
+		writeFile(t, location, name)
+		mtime := time.Now().Add(time.Duration(i-len(names)) * time.Hour)
+		if err := os.Chtimes(location, mtime, mtime); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	latest, err := s.latestBackups(backend)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	expectedLatest := []string{"backup-app-2026-10-15T04-00-00.tar.gz", "backup-db-2026-10-13T04-00-00.tar.gz"}
+	if !reflect.DeepEqual(expectedLatest, latest) {
+		t.Errorf("Expected latest backups %v, got %v", expectedLatest, latest)
+	}
+
+	if err := s.pruneBackups(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	entries, err := os.ReadDir(archive)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	var remaining []string
+	for _, entry := range entries {
+		remaining = append(remaining, entry.Name())
+	}
+	if !reflect.DeepEqual(expectedLatest, remaining) {
+		t.Errorf("Expected %v to remain, got %v", expectedLatest, remaining)
+	}
+}
+
+func TestSplitPruningPrefix(t *testing.T) {
+	tests := []struct {
+		name        string
+		filename    string
+		prefix      string
+		expected    string
+		expectError bool
+	}{
+		{"derived", "backup-{{ .Source }}-%Y.tar.gz", "", "backup-{{ .Source }}-", false},
+		{"derived from given prefix", "backup-{{ .Source }}-%Y.tar.gz", "backup-", "backup-{{ .Source }}-", false},
+		{"explicit", "backup-{{ .Source }}-%Y.tar.gz", "backup-{{ .Source }}", "backup-{{ .Source }}", false},
+		{"not derivable", "%Y-{{ .Source }}.tar.gz", "", "", true},
+		{"mismatching prefix", "backup-{{ .Source }}-%Y.tar.gz", "other-", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &Config{
+				NotificationLevel:      "error",
+				BackupFilename:         test.filename,
+				BackupPruningPrefix:    test.prefix,
+				BackupSplitByDirectory: true,
+			}
+			reset, _, err := c.resolve()
+			if (err != nil) != test.expectError {
+				t.Fatalf("Unexpected error value %v", err)
+			}
+			if err != nil {
+				return
+			}
+			defer func() { _ = reset() }()
+			if c.BackupPruningPrefix != test.expected {
+				t.Errorf("Expected prefix %s, got %s", test.expected, c.BackupPruningPrefix)
+			}
+		})
+	}
+}
@@ -11,10 +11,15 @@ import (
 
 // ContainersStats stats about the docker containers
 type ContainersStats struct {
-	All        uint
-	ToStop     uint
-	Stopped    uint
-	StopErrors uint
+	All         uint
+	ToStop      uint
+	ToStopNames []string
+	Stopped     uint
+	StopErrors  uint
+	ToPause     uint
+	Paused      uint
+	PauseErrors uint
+	Unhealthy   []string
 }
 
 // ServicesStats contains info about Swarm services that have been
@@ -33,11 +38,30 @@ type BackupFileStats struct {
 	Size     uint64
 }
 
+// SourceStats stats about the archive of a single directory in case backups
+// are split by directory
+type SourceStats struct {
+	BackupFile BackupFileStats
+	Storages   map[string]StorageStats
+}
+
 // StorageStats stats about the status of an archival directory
 type StorageStats struct {
-	Total       uint
-	Pruned      uint
-	PruneErrors uint
+	Total          uint
+	Pruned         uint
+	PruneErrors    uint
+	UploadedBytes  uint64
+	UploadDuration time.Duration
+}
+
+// VerifyStats stats about the verification of a backup in a storage backend
+type VerifyStats struct {
+	Name          string
+	Backend       string
+	Entries       uint
+	ComparedFiles uint
+	ManifestFound bool
+	Error         string
 }
 
 // Stats global stats regarding script execution
@@ -47,9 +71,11 @@ type Stats struct {
 	EndTime    time.Time
 	TookTime   time.Duration
 	LockedTime time.Duration
-	LogOutput  *bytes.Buffer
+	LogOutput  *bytes.Buffer `json:"-"`
 	Containers ContainersStats
 	Services   ServicesStats
 	BackupFile BackupFileStats
 	Storages   map[string]StorageStats
+	Sources    map[string]SourceStats
+	Verify     []VerifyStats
 }
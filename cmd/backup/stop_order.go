@@ -0,0 +1,248 @@
+// Copyright 2026 - offen.software <hioffen@posteo.de>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/cli/cli/command/service/progress"
+	ctr "github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/api/types/swarm"
+	"github.com/moby/moby/client"
+	"github.com/offen/docker-volume-backup/internal/errwrap"
+)
+
+// stopGroups sorts the given containers into groups of equal priority,
+// ordered by descending priority, which is the order containers are stopped
+// in. Containers are restarted in reverse order.
+//
+// The priority of a container is read from the
+// `docker-volume-backup.stop-priority` label. Containers that do not define
+// a priority are stopped before the containers they depend on as per the
+// `depends_on` setting of Docker Compose.
+func stopGroups(containers []handledContainer) ([][]handledContainer, error) {
+	priorities, err := stopPriorities(containers)
+	if err != nil {
+		return nil, err
+	}
+
+	var levels []int
+	for _, priority := range priorities {
+		levels = append(levels, priority)
+	}
+	slices.Sort(levels)
+	levels = slices.Compact(levels)
+	slices.Reverse(levels)
+
+	var groups [][]handledContainer
+	for _, level := range levels {
+		var group []handledContainer
+		for _, c := range containers {
+			if priorities[c.summary.ID] == level {
+				group = append(group, c)
+			}
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// stopPriorities returns the priority of each of the given containers,
+// keyed by id.
+func stopPriorities(containers []handledContainer) (map[string]int, error) {
+	services := map[string][]string{}
+	for _, c := range containers {
+		key := composeService(c.summary.Labels["com.docker.compose.project"], c.summary.Labels["com.docker.compose.service"])
+		services[key] = append(services[key], c.summary.ID)
+	}
+
+	byID := map[string]ctr.Summary{}
+	for _, c := range containers {
+		byID[c.summary.ID] = c.summary
+	}
+
+	priorities := map[string]int{}
+	visiting := map[string]bool{}
+	var priorityOf func(id string) (int, error)
+	priorityOf = func(id string) (int, error) {
+		if priority, ok := priorities[id]; ok {
+			return priority, nil
+		}
+		c := byID[id]
+		if value, ok := c.Labels["docker-volume-backup.stop-priority"]; ok {
+			priority, err := strconv.Atoi(value)
+			if err != nil {
+				return 0, errwrap.Wrap(err, fmt.Sprintf("error parsing stop priority of container %s", containerName(c)))
+			}
+			priorities[id] = priority
+			return priority, nil
+		}
+
+		if visiting[id] {
+			return 0, errwrap.Wrap(nil, fmt.Sprintf("container %s has a circular dependency", containerName(c)))
+		}
+		visiting[id] = true
+		defer delete(visiting, id)
+
+		// Containers are stopped before the ones they depend on, so their
+		// priority is higher than the one of all of their dependencies.
+		priority := 0
+		for _, dependency := range composeDependencies(c.Labels) {
+			for _, dependencyID := range services[composeService(c.Labels["com.docker.compose.project"], dependency)] {
+				dependencyPriority, err := priorityOf(dependencyID)
+				if err != nil {
+					return 0, err
+				}
+				priority = max(priority, dependencyPriority+1)
+			}
+		}
+		priorities[id] = priority
+		return priority, nil
+	}
+
+	for _, c := range containers {
+		if _, err := priorityOf(c.summary.ID); err != nil {
+			return nil, err
+		}
+	}
+	return priorities, nil
+}
+
+// composeService returns a key identifying the given Docker Compose service.
+// Containers that have not been created by Docker Compose return an empty
+// key.
+func composeService(project, service string) string {
+	if service == "" {
+		return ""
+	}
+	return project + "/" + service
+}
+
+// composeDependencies returns the names of the services the container with
+// the given labels depends on. Docker Compose stores dependencies in the
+// format `service:condition:restart`, separated by commas.
+func composeDependencies(labels map[string]string) []string {
+	value := labels["com.docker.compose.depends_on"]
+	if value == "" {
+		return nil
+	}
+	var services []string
+	for _, dependency := range strings.Split(value, ",") {
+		service, _, _ := strings.Cut(dependency, ":")
+		if service != "" {
+			services = append(services, service)
+		}
+	}
+	return services
+}
+
+// awaitHealthy waits for the containers of the given ids that define a
+// healthcheck to report being healthy. Containers without a healthcheck are
+// not waited for, as they might exit on purpose, e.g. when running one-off
+// jobs. It returns the ids of all containers that have stopped or have not
+// become healthy before the timeout.
+func awaitHealthy(c interface {
+	ContainerInspect(context.Context, string, client.ContainerInspectOptions) (client.ContainerInspectResult, error)
+}, ids []string, timeoutAfter, pollInterval time.Duration) ([]string, error) {
+	poll := time.NewTicker(pollInterval)
+	timeout := time.NewTimer(timeoutAfter)
+	defer timeout.Stop()
+	defer poll.Stop()
+
+	var failed []string
+	pending := slices.Clone(ids)
+	for {
+		var stillPending []string
+		for _, id := range pending {
+			result, err := c.ContainerInspect(context.Background(), id, client.ContainerInspectOptions{})
+			if err != nil {
+				return nil, errwrap.Wrap(err, fmt.Sprintf("error inspecting container %s", id))
+			}
+			state := result.Container.State
+			switch {
+			case !hasHealthcheck(result.Container):
+			case state == nil || !state.Running:
+				failed = append(failed, id)
+			case state.Health == nil || state.Health.Status != ctr.Healthy:
+				stillPending = append(stillPending, id)
+			}
+		}
+		pending = stillPending
+		if len(pending) == 0 {
+			return failed, nil
+		}
+
+		select {
+		case <-timeout.C:
+			return append(failed, pending...), nil
+		case <-poll.C:
+		}
+	}
+}
+
+// hasHealthcheck returns whether the given container defines a healthcheck,
+// either in its image or in its configuration.
+func hasHealthcheck(c ctr.InspectResponse) bool {
+	if c.State != nil && c.State.Health != nil {
+		return true
+	}
+	if c.Config == nil || c.Config.Healthcheck == nil {
+		return false
+	}
+	test := c.Config.Healthcheck.Test
+	return len(test) != 0 && test[0] != "NONE"
+}
+
+// awaitRestarted waits for the given containers to become healthy after
+// having been restarted or unpaused, so containers that depend on them can
+// be restarted safely. Containers that do not become healthy are recorded in
+// the stats.
+func (s *script) awaitRestarted(containers []handledContainer) error {
+	var ids []string
+	names := map[string]string{}
+	for _, c := range containers {
+		ids = append(ids, c.summary.ID)
+		names[c.summary.ID] = containerName(c.summary)
+	}
+	pending, err := awaitHealthy(s.cli, ids, s.c.BackupHealthcheckTimeout, time.Second)
+	if err != nil {
+		return errwrap.Wrap(err, "error waiting for containers to become healthy")
+	}
+	if len(pending) != 0 {
+		var unhealthy []string
+		for _, id := range pending {
+			unhealthy = append(unhealthy, names[id])
+		}
+		s.stats.Lock()
+		s.stats.Containers.Unhealthy = append(s.stats.Containers.Unhealthy, unhealthy...)
+		s.stats.Unlock()
+		return errwrap.Wrap(nil, fmt.Sprintf("container(s) %v did not become healthy within %s", unhealthy, s.c.BackupHealthcheckTimeout))
+	}
+	return nil
+}
+
+// awaitService waits for the update of the given service to converge. Swarm
+// only considers tasks to be running once they have passed their healthcheck,
+// so services that do not become healthy are recorded in the stats.
+func (s *script) awaitService(service swarm.Service) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.c.BackupHealthcheckTimeout)
+	defer cancel()
+	if err := progress.ServiceProgress(ctx, s.cli, service.ID, &noopWriteCloser{io.Discard}); err != nil {
+		s.stats.Lock()
+		s.stats.Containers.Unhealthy = append(s.stats.Containers.Unhealthy, service.Spec.Name)
+		s.stats.Unlock()
+		if errors.Is(err, context.DeadlineExceeded) {
+			return errwrap.Wrap(nil, fmt.Sprintf("service %s did not become healthy within %s", service.Spec.Name, s.c.BackupHealthcheckTimeout))
+		}
+		return errwrap.Wrap(err, fmt.Sprintf("error waiting for service %s to become healthy", service.Spec.Name))
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	ctr "github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/client"
+)
+
+func composeContainer(id, service, dependsOn string, labels ...string) handledContainer {
+	c := handledContainer{summary: ctr.Summary{
+		ID: id,
+		Labels: map[string]string{
+			"com.docker.compose.project":    "test",
+			"com.docker.compose.service":    service,
+			"com.docker.compose.depends_on": dependsOn,
+		},
+	}}
+	for i := 0; i+1 < len(labels); i += 2 {
+		c.summary.Labels[labels[i]] = labels[i+1]
+	}
+	return c
+}
+
+func TestStopGroups(t *testing.T) {
+	tests := []struct {
+		name        string
+		containers  []handledContainer
+		expected    [][]string
+		expectError bool
+	}{
+		{
+			"no dependencies",
+			[]handledContainer{
+				{summary: ctr.Summary{ID: "a"}},
+				{summary: ctr.Summary{ID: "b"}},
+			},
+			[][]string{{"a", "b"}},
+			false,
+		},
+		{
+			"compose dependencies",
+			[]handledContainer{
+				composeContainer("db", "db", ""),
+				composeContainer("app", "app", "db:service_healthy:false,cache:service_started:false"),
+				composeContainer("cache", "cache", "db:service_started:false"),
+				composeContainer("proxy", "proxy", "app:service_started:false,other:service_started:false"),
+			},
+			[][]string{{"proxy"}, {"app"}, {"cache"}, {"db"}},
+			false,
+		},
+		{
+			"explicit priority",
+			[]handledContainer{
+				composeContainer("db", "db", "", "docker-volume-backup.stop-priority", "5"),
+				composeContainer("app", "app", "db:service_healthy:false"),
+				{summary: ctr.Summary{ID: "other", Labels: map[string]string{"docker-volume-backup.stop-priority": "-1"}}},
+			},
+			[][]string{{"app"}, {"db"}, {"other"}},
+			false,
+		},
+		{
+			"invalid priority",
+			[]handledContainer{
+				{summary: ctr.Summary{ID: "a", Labels: map[string]string{"docker-volume-backup.stop-priority": "high"}}},
+			},
+			nil,
+			true,
+		},
+		{
+			"circular dependency",
+			[]handledContainer{
+				composeContainer("a", "a", "b:service_started:false"),
+				composeContainer("b", "b", "a:service_started:false"),
+			},
+			nil,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			groups, err := stopGroups(test.containers)
+			if (err != nil) != test.expectError {
+				t.Fatalf("Unexpected error value %v", err)
+			}
+			var ids [][]string
+			for _, group := range groups {
+				var groupIDs []string
+				for _, c := range group {
+					groupIDs = append(groupIDs, c.summary.ID)
+				}
+				ids = append(ids, groupIDs)
+			}
+			if !reflect.DeepEqual(test.expected, ids) {
+				t.Errorf("Expected %v, got %v", test.expected, ids)
+			}
+		})
+	}
+}
+
+type mockInspectClient struct {
+	states map[string]*ctr.State
+}
+
+func (m *mockInspectClient) ContainerInspect(_ context.Context, id string, _ client.ContainerInspectOptions) (client.ContainerInspectResult, error) {
+	return client.ContainerInspectResult{Container: ctr.InspectResponse{State: m.states[id]}}, nil
+}
+
+func TestAwaitHealthy(t *testing.T) {
+	c := &mockInspectClient{states: map[string]*ctr.State{
+		"running":   {Running: true},
+		"stopped":   {Running: false},
+		"starting":  {Running: true, Health: &ctr.Health{Status: ctr.Starting}},
+		"healthy":   {Running: true, Health: &ctr.Health{Status: ctr.Healthy}},
+		"unhealthy": {Running: true, Health: &ctr.Health{Status: ctr.Unhealthy}},
+		"exited":    {Running: false, Health: &ctr.Health{Status: ctr.Unhealthy}},
+	}}
+
+	// Containers without a healthcheck are not waited for, even if they
+	// have exited.
+	pending, err := awaitHealthy(c, []string{"running", "stopped", "healthy"}, time.Second, time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("Expected no pending containers, got %v", pending)
+	}
+
+	pending, err = awaitHealthy(c, []string{"running", "starting", "unhealthy", "exited"}, 10*time.Millisecond, time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if expected := []string{"exited", "starting", "unhealthy"}; !reflect.DeepEqual(expected, pending) {
+		t.Errorf("Expected %v, got %v", expected, pending)
+	}
+}
+
+func TestHasHealthcheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		container ctr.InspectResponse
+		expected  bool
+	}{
+		{"no config", ctr.InspectResponse{}, false},
+		{"no healthcheck", ctr.InspectResponse{Config: &ctr.Config{}}, false},
+		{"healthcheck", ctr.InspectResponse{Config: &ctr.Config{Healthcheck: &ctr.HealthConfig{Test: []string{"CMD", "true"}}}}, true},
+		{"disabled healthcheck", ctr.InspectResponse{Config: &ctr.Config{Healthcheck: &ctr.HealthConfig{Test: []string{"NONE"}}}}, false},
+		{"health state", ctr.InspectResponse{State: &ctr.State{Health: &ctr.Health{Status: ctr.Starting}}}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := hasHealthcheck(test.container); result != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
@@ -127,13 +127,33 @@ func (s *script) stopContainersAndServices() (func() error, error) {
 		return noop, errwrap.Wrap(err, "error querying for containers")
 	}
 
+	pauseDuringBackupLabel := fmt.Sprintf(
+		"docker-volume-backup.pause-during-backup=%s",
+		s.c.BackupPauseDuringBackupLabel,
+	)
+
 	var containersToStop []handledContainer
+	var containersToPause []handledContainer
 	for _, c := range allContainers.Items {
 		hasStopDuringBackupLabel, hasStopDuringBackupNoRestartLabel, err := checkStopLabels(c.Labels, s.c.BackupStopDuringBackupLabel, s.c.BackupStopDuringBackupNoRestartLabel)
 		if err != nil {
 			return noop, errwrap.Wrap(err, "error querying for containers to stop")
 		}
 
+		if hasLabel(c.Labels, "docker-volume-backup.pause-during-backup", s.c.BackupPauseDuringBackupLabel) {
+			if hasStopDuringBackupLabel || hasStopDuringBackupNoRestartLabel {
+				return noop, errwrap.Wrap(
+					nil,
+					fmt.Sprintf(
+						"container %s is labeled to be both stopped and paused during backup, cannot continue",
+						containerName(c),
+					),
+				)
+			}
+			containersToPause = append(containersToPause, handledContainer{summary: c})
+			continue
+		}
+
 		if !hasStopDuringBackupLabel && !hasStopDuringBackupNoRestartLabel {
 			continue
 		}
@@ -144,6 +164,19 @@ func (s *script) stopContainersAndServices() (func() error, error) {
 		})
 	}
 
+	if s.c.BackupStopDuringBackupMatchMounts && len(containersToStop) != 0 {
+		containersToStop, err = s.filterByMounts(containersToStop)
+		if err != nil {
+			return noop, errwrap.Wrap(err, "error matching containers to stop against backup sources")
+		}
+	}
+	if s.c.BackupStopDuringBackupMatchMounts && len(containersToPause) != 0 {
+		containersToPause, err = s.filterByMounts(containersToPause)
+		if err != nil {
+			return noop, errwrap.Wrap(err, "error matching containers to pause against backup sources")
+		}
+	}
+
 	var allServices []swarm.Service
 	var servicesToScaleDown []handledSwarmService
 	if isDockerSwarm {
@@ -178,10 +211,15 @@ func (s *script) stopContainersAndServices() (func() error, error) {
 		}
 	}
 
-	if len(containersToStop) == 0 && len(servicesToScaleDown) == 0 {
+	if len(containersToStop) == 0 && len(containersToPause) == 0 && len(servicesToScaleDown) == 0 {
 		return noop, nil
 	}
 
+	groups, err := stopGroups(containersToStop)
+	if err != nil {
+		return noop, errwrap.Wrap(err, "error determining order of containers to stop")
+	}
+
 	if isDockerSwarm {
 		for _, container := range containersToStop {
 			if swarmServiceID, ok := container.summary.Labels["com.docker.swarm.service.id"]; ok {
@@ -214,6 +252,21 @@ func (s *script) stopContainersAndServices() (func() error, error) {
 			stopDuringBackupNoRestartLabel,
 		),
 	)
+	if len(groups) > 1 {
+		s.logger.Info(
+			fmt.Sprintf("Stopping containers in %d groups ordered by priority.", len(groups)),
+		)
+	}
+	if len(containersToPause) != 0 {
+		s.logger.Info(
+			fmt.Sprintf(
+				"Pausing %d out of %d running container(s) as they were labeled %s.",
+				len(containersToPause),
+				len(allContainers.Items),
+				pauseDuringBackupLabel,
+			),
+		)
+	}
 	if isDockerSwarm {
 		s.logger.Info(
 			fmt.Sprintf(
@@ -227,12 +280,30 @@ func (s *script) stopContainersAndServices() (func() error, error) {
 	}
 
 	var stoppedContainers []handledContainer
+	var stoppedGroups [][]handledContainer
 	var stopErrors []error
-	for _, container := range containersToStop {
-		if _, err := s.cli.ContainerStop(context.Background(), container.summary.ID, client.ContainerStopOptions{}); err != nil {
-			stopErrors = append(stopErrors, err)
+	for _, group := range groups {
+		var stoppedGroup []handledContainer
+		for _, container := range group {
+			if _, err := s.cli.ContainerStop(context.Background(), container.summary.ID, client.ContainerStopOptions{}); err != nil {
+				stopErrors = append(stopErrors, err)
+			} else {
+				stoppedGroup = append(stoppedGroup, container)
+			}
+		}
+		stoppedContainers = append(stoppedContainers, stoppedGroup...)
+		stoppedGroups = append(stoppedGroups, stoppedGroup)
+	}
+
+	// Containers are paused after stopping all others, so stopping containers
+	// that depend on paused ones does not block.
+	var pausedContainers []handledContainer
+	var pauseErrors []error
+	for _, container := range containersToPause {
+		if _, err := s.cli.ContainerPause(context.Background(), container.summary.ID, client.ContainerPauseOptions{}); err != nil {
+			pauseErrors = append(pauseErrors, err)
 		} else {
-			stoppedContainers = append(stoppedContainers, container)
+			pausedContainers = append(pausedContainers, container)
 		}
 	}
 
@@ -265,11 +336,19 @@ func (s *script) stopContainersAndServices() (func() error, error) {
 		wg.Wait()
 	}
 
+	var toStopNames []string
+	for _, container := range containersToStop {
+		toStopNames = append(toStopNames, containerName(container.summary))
+	}
 	s.stats.Containers = ContainersStats{
-		All:        uint(len(allContainers.Items)),
-		ToStop:     uint(len(containersToStop)),
-		Stopped:    uint(len(stoppedContainers)),
-		StopErrors: uint(len(stopErrors)),
+		All:         uint(len(allContainers.Items)),
+		ToStop:      uint(len(containersToStop)),
+		ToStopNames: toStopNames,
+		Stopped:     uint(len(stoppedContainers)),
+		StopErrors:  uint(len(stopErrors)),
+		ToPause:     uint(len(containersToPause)),
+		Paused:      uint(len(pausedContainers)),
+		PauseErrors: uint(len(pauseErrors)),
 	}
 
 	s.stats.Services = ServicesStats{
@@ -280,12 +359,13 @@ func (s *script) stopContainersAndServices() (func() error, error) {
 	}
 
 	var initialErr error
-	allErrors := append(stopErrors, scaleDownErrors.value()...)
+	allErrors := append(stopErrors, pauseErrors...)
+	allErrors = append(allErrors, scaleDownErrors.value()...)
 	if len(allErrors) != 0 {
 		initialErr = errwrap.Wrap(
 			errors.Join(allErrors...),
 			fmt.Sprintf(
-				"%d error(s) stopping containers",
+				"%d error(s) stopping or pausing containers",
 				len(allErrors),
 			),
 		)
@@ -293,44 +373,78 @@ func (s *script) stopContainersAndServices() (func() error, error) {
 
 	return func() error {
 		var restartErrors []error
-		var restartedContainers []handledContainer
-		matchedServices := map[string]bool{}
-		for _, container := range stoppedContainers {
-			if !container.restart {
-				continue
+		// Paused containers are unpaused first, so restarted containers
+		// can connect to them right away.
+		var unpausedContainers []handledContainer
+		for _, container := range pausedContainers {
+			if _, err := s.cli.ContainerUnpause(context.Background(), container.summary.ID, client.ContainerUnpauseOptions{}); err != nil {
+				restartErrors = append(restartErrors, err)
+			} else {
+				unpausedContainers = append(unpausedContainers, container)
+			}
+		}
+		if len(unpausedContainers) != 0 {
+			if err := s.awaitRestarted(unpausedContainers); err != nil {
+				restartErrors = append(restartErrors, err)
 			}
+		}
 
-			if swarmServiceID, ok := container.summary.Labels["com.docker.swarm.service.id"]; ok && isDockerSwarm {
-				if _, ok := matchedServices[swarmServiceID]; ok {
+		var restartedContainers []handledContainer
+		matchedServices := map[string]bool{}
+		for i := len(stoppedGroups) - 1; i >= 0; i-- {
+			var restartedGroup []handledContainer
+			for _, container := range stoppedGroups[i] {
+				if !container.restart {
 					continue
 				}
-				matchedServices[swarmServiceID] = true
-				// in case a container was part of a swarm service, the service requires to
-				// be force updated instead of restarting the container as it would otherwise
-				// remain in a "completed" state
-				result, err := s.cli.ServiceInspect(context.Background(), swarmServiceID, client.ServiceInspectOptions{})
-				service := result.Service
-				if err != nil {
-					restartErrors = append(
-						restartErrors,
-						errwrap.Wrap(err, "error looking up parent service"),
-					)
+
+				if swarmServiceID, ok := container.summary.Labels["com.docker.swarm.service.id"]; ok && isDockerSwarm {
+					if _, ok := matchedServices[swarmServiceID]; ok {
+						continue
+					}
+					matchedServices[swarmServiceID] = true
+					// in case a container was part of a swarm service, the service requires to
+					// be force updated instead of restarting the container as it would otherwise
+					// remain in a "completed" state
+					result, err := s.cli.ServiceInspect(context.Background(), swarmServiceID, client.ServiceInspectOptions{})
+					service := result.Service
+					if err != nil {
+						restartErrors = append(
+							restartErrors,
+							errwrap.Wrap(err, "error looking up parent service"),
+						)
+						continue
+					}
+					service.Spec.TaskTemplate.ForceUpdate += 1
+					if _, err := s.cli.ServiceUpdate(
+						context.Background(), service.ID,
+						client.ServiceUpdateOptions{Spec: service.Spec, Version: service.Version},
+					); err != nil {
+						restartErrors = append(restartErrors, err)
+						continue
+					}
+					if err := s.awaitService(service); err != nil {
+						restartErrors = append(restartErrors, err)
+					}
 					continue
 				}
-				service.Spec.TaskTemplate.ForceUpdate += 1
-				if _, err := s.cli.ServiceUpdate(
-					context.Background(), service.ID,
-					client.ServiceUpdateOptions{Spec: service.Spec, Version: service.Version},
-				); err != nil {
+
+				if _, err := s.cli.ContainerStart(context.Background(), container.summary.ID, client.ContainerStartOptions{}); err != nil {
 					restartErrors = append(restartErrors, err)
+				} else {
+					restartedGroup = append(restartedGroup, container)
 				}
-				continue
 			}
+			restartedContainers = append(restartedContainers, restartedGroup...)
 
-			if _, err := s.cli.ContainerStart(context.Background(), container.summary.ID, client.ContainerStartOptions{}); err != nil {
+			// Containers of the following groups might depend on the ones
+			// that have just been restarted, and the run is considered failed
+			// in case any restarted container does not become healthy again.
+			if len(restartedGroup) == 0 {
+				continue
+			}
+			if err := s.awaitRestarted(restartedGroup); err != nil {
 				restartErrors = append(restartErrors, err)
-			} else {
-				restartedContainers = append(restartedContainers, container)
 			}
 		}
 
@@ -382,6 +496,15 @@ func (s *script) stopContainersAndServices() (func() error, error) {
 				len(stoppedContainers),
 			),
 		)
+		if len(pausedContainers) != 0 {
+			s.logger.Info(
+				fmt.Sprintf(
+					"Unpaused %d out of %d paused container(s).",
+					len(unpausedContainers),
+					len(pausedContainers),
+				),
+			)
+		}
 		if isDockerSwarm {
 			s.logger.Info(
 				fmt.Sprintf(
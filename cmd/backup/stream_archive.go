@@ -0,0 +1,153 @@
+// Copyright 2026 - offen.software <hioffen@posteo.de>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/offen/docker-volume-backup/internal/errwrap"
+	"github.com/offen/docker-volume-backup/internal/storage"
+	"golang.org/x/sync/errgroup"
+)
+
+// streamArchive creates a compressed and optionally encrypted tar archive of
+// the configured backup location and uploads it to all configured storage
+// backends concurrently. In contrast to running createArchive, encryptArchive
+// and copyArchive in sequence, the archive is never staged on disk.
+func (s *script) streamArchive() error {
+	if len(s.storages) == 0 {
+		return errwrap.Wrap(nil, "streaming backups requires at least one storage backend to be configured")
+	}
+
+	outputContainers, err := s.outputContainers()
+	if err != nil {
+		return errwrap.Wrap(err, "error looking up containers to capture output of")
+	}
+
+	backupSources, filesEligibleForBackup, err := s.collectFilesForBackup()
+	if err != nil {
+		return errwrap.Wrap(err, "error collecting files for backup")
+	}
+
+	filesEligibleForBackup, dumpDirs, err := s.selectIncrementalFiles(backupSources, filesEligibleForBackup)
+	if err != nil {
+		return errwrap.Wrap(err, "error selecting files for incremental backup")
+	}
+
+	outputs, err := s.captureOutputs(outputContainers, backupSources)
+	if err != nil {
+		return errwrap.Wrap(err, "error capturing command output")
+	}
+
+	extension, encrypt, err := s.getEncryptor()
+	if err != nil {
+		return errwrap.Wrap(err, "error selecting encryption method")
+	}
+
+	// Archive entries are named the same way as they are when creating the
+	// archive on disk, i.e. relative to the directory of the backup file.
+	absFile, err := filepath.Abs(s.file)
+	if err != nil {
+		return errwrap.Wrap(err, "error getting absolute path")
+	}
+	prefix := path.Dir(absFile)
+
+	if encrypt != nil {
+		s.file = fmt.Sprintf("%s.%s", s.file, extension)
+	}
+	_, name := path.Split(s.file)
+
+	eg := errgroup.Group{}
+	durations := make([]time.Duration, len(s.storages))
+	writers := make([]io.Writer, len(s.storages))
+	pipeWriters := make([]*io.PipeWriter, len(s.storages))
+	for i, backend := range s.storages {
+		pr, pw := io.Pipe()
+		writers[i], pipeWriters[i] = pw, pw
+		b, index := backend, i
+		eg.Go(func() error {
+			start := time.Now()
+			err := storage.UploadArchive(b, name, pr)
+			durations[index] = time.Since(start)
+			// In case the upload stopped before consuming the entire stream,
+			// writing the archive needs to be aborted.
+			_ = pr.CloseWithError(errors.Join(err, io.ErrClosedPipe))
+			return err
+		})
+	}
+
+	checksums := storage.NewChecksumWriter()
+	counter := &countingWriter{w: io.MultiWriter(append(writers, checksums)...)}
+	archiveErr := func() (err error) {
+		var dst io.WriteCloser = noopWriteCloser{counter}
+		if encrypt != nil {
+			dst, err = encrypt(counter)
+			if err != nil {
+				return errwrap.Wrap(err, "error encrypting backup file")
+			}
+		}
+		defer func() {
+			if derr := dst.Close(); derr != nil {
+				err = errors.Join(err, errwrap.Wrap(derr, "error closing encrypted backup file"))
+			}
+		}()
+		s.archivedFiles, err = writeArchive(filesEligibleForBackup, dumpDirs, outputs, prefix, dst, s.c.BackupCompression.String(), s.c.GzipParallelism.Int())
+		return err
+	}()
+	for _, pw := range pipeWriters {
+		_ = pw.CloseWithError(archiveErr)
+	}
+
+	if err := eg.Wait(); err != nil {
+		return errors.Join(archiveErr, errwrap.Wrap(err, "error uploading archive"))
+	}
+	if archiveErr != nil {
+		return errwrap.Wrap(archiveErr, "error creating archive")
+	}
+
+	s.setBackupFile(BackupFileStats{
+		Size: counter.n,
+		Name: name,
+	})
+	for i, backend := range s.storages {
+		s.recordUpload(backend.Name(), counter.n, durations[i])
+	}
+
+	sums := checksums.Sum()
+	for _, backend := range s.storages {
+		b := backend
+		eg.Go(func() error {
+			return s.verifyUpload(b, name, sums)
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return errwrap.Wrap(err, "error verifying archive")
+	}
+
+	s.logger.Info(
+		fmt.Sprintf("Streamed backup of `%s` as `%s` to %d storage backend(s).", backupSources, name, len(s.storages)),
+	)
+	if err := s.uploadManifest(); err != nil {
+		return errwrap.Wrap(err, "error uploading manifest")
+	}
+	return nil
+}
+
+// countingWriter keeps track of the number of bytes written to the wrapped
+// writer.
+type countingWriter struct {
+	w io.Writer
+	n uint64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += uint64(n)
+	return n, err
+}
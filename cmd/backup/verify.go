@@ -0,0 +1,413 @@
+// Copyright 2026 - offen.software <hioffen@posteo.de>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"sort"
+	"strings"
+
+	"github.com/offen/docker-volume-backup/internal/errwrap"
+	"github.com/offen/docker-volume-backup/internal/storage"
+)
+
+type verifyOpts struct {
+	backend    string
+	latest     bool
+	scratchDir string
+	// discard skips extracting the archive, reading its contents only.
+	discard bool
+}
+
+// runVerify test-restores an archive from one of the configured storage
+// backends into a scratch directory and reports the result using the
+// configured notifications.
+func runVerify(args []string) (err error) {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	source := flags.String("config", "", "the conf.d file to use, can be omitted if only a single configuration exists")
+	backend := flags.String("backend", "", "the storage backend to download the archive from, can be omitted if only a single backend is configured")
+	latest := flags.Bool("latest", false, "verify the most recent backup instead of passing its name")
+	scratchDir := flags.String("scratch-dir", "", "the directory in which the archive is extracted temporarily, defaults to the system's temporary directory")
+	if err := flags.Parse(args); err != nil {
+		return errwrap.Wrap(err, "error parsing flags")
+	}
+	if *latest == (flags.NArg() == 1) || flags.NArg() > 1 {
+		return errwrap.Wrap(nil, "expected either -latest or the name of the archive to verify as the only argument")
+	}
+
+	config, err := selectConfiguration(*source)
+	if err != nil {
+		return errwrap.Wrap(err, "error selecting configuration")
+	}
+
+	s := newScript(config)
+	s.notificationScope = "verify"
+
+	unlock, lockErr := s.lock("/var/lock/dockervolumebackup.lock")
+	if lockErr != nil {
+		return errwrap.Wrap(lockErr, "error acquiring file lock")
+	}
+	defer func() {
+		if derr := unlock(); derr != nil {
+			err = errors.Join(err, errwrap.Wrap(derr, "error releasing file lock"))
+		}
+	}()
+
+	verifyErr := s.runSubcommand(func() error {
+		return s.verifyArchive(flags.Arg(0), verifyOpts{
+			backend:    *backend,
+			latest:     *latest,
+			scratchDir: *scratchDir,
+		})
+	}, true)
+	if verifyErr != nil {
+		return errwrap.Wrap(verifyErr, "error verifying archive")
+	}
+	return nil
+}
+
+// verifyArchive extracts the archive of the given name from the selected
+// storage backend into a scratch directory, or only reads it in case discard
+// is set. In case a manifest is stored next to the archive, the archived files
+// are compared against it. The result is appended to the verify stats.
+func (s *script) verifyArchive(name string, opts verifyOpts) (err error) {
+	if opts.latest {
+		return s.verifyLatest(opts)
+	}
+
+	result := VerifyStats{Name: name, Backend: opts.backend}
+	defer func() {
+		if err != nil {
+			result.Error = err.Error()
+		}
+		s.stats.Lock()
+		s.stats.Verify = append(s.stats.Verify, result)
+		s.stats.Unlock()
+	}()
+
+	backend, err := s.storageByName(opts.backend)
+	if err != nil {
+		return errwrap.Wrap(err, "error selecting storage backend")
+	}
+	result.Backend = backend.Name()
+
+	m, err := s.downloadManifest(backend, name)
+	if err != nil {
+		return errwrap.Wrap(err, "error downloading manifest")
+	}
+
+	if m == nil {
+		s.logger.Warn(
+			fmt.Sprintf("No manifest found for backup `%s`, skipping comparison of archived files.", name),
+		)
+	} else {
+		result.ManifestFound = true
+	}
+
+	var numEntries int
+	if opts.discard {
+		numEntries, err = s.readArchive(backend, name, func(r io.Reader) (int, error) {
+			return checkArchive(r, m, &result)
+		})
+	} else {
+		numEntries, err = s.extractAndCompare(backend, name, opts.scratchDir, m, &result)
+	}
+	result.Entries = uint(numEntries)
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info(
+		fmt.Sprintf("Verified backup `%s` stored in %s by reading %d entries.", name, backend.Name(), numEntries),
+	)
+	return nil
+}
+
+// verifyLatest verifies the most recent backup in the selected storage
+// backend, or the most recent backup of each directory in case backups are
+// split by directory.
+func (s *script) verifyLatest(opts verifyOpts) error {
+	names, err := func() ([]string, error) {
+		backend, err := s.storageByName(opts.backend)
+		if err != nil {
+			return nil, errwrap.Wrap(err, "error selecting storage backend")
+		}
+		names, err := s.latestBackups(backend)
+		if err != nil {
+			return nil, errwrap.Wrap(err, "error looking up latest backup")
+		}
+		return names, nil
+	}()
+	if err != nil {
+		s.stats.Lock()
+		s.stats.Verify = append(s.stats.Verify, VerifyStats{Backend: opts.backend, Error: err.Error()})
+		s.stats.Unlock()
+		return err
+	}
+
+	opts.latest = false
+	var errs []error
+	for _, name := range names {
+		if err := s.verifyArchive(name, opts); err != nil {
+			errs = append(errs, errwrap.Wrap(err, fmt.Sprintf("error verifying `%s`", name)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// extractAndCompare extracts the archive of the given name into a scratch
+// directory that is created in the given directory and compares the
+// extracted files against the given manifest, if any.
+func (s *script) extractAndCompare(backend storage.Backend, name, scratchDir string, m *manifest, result *VerifyStats) (_ int, err error) {
+	scratch, err := os.MkdirTemp(scratchDir, "verify-")
+	if err != nil {
+		return 0, errwrap.Wrap(err, "error creating scratch directory")
+	}
+	defer func() {
+		if derr := os.RemoveAll(scratch); derr != nil {
+			err = errors.Join(err, errwrap.Wrap(derr, "error removing scratch directory"))
+		}
+	}()
+
+	numEntries, err := s.readArchive(backend, name, func(r io.Reader) (int, error) {
+		return extractArchive(r, scratch)
+	})
+	if err != nil || m == nil {
+		return numEntries, err
+	}
+	for _, file := range m.Files {
+		if err := compareWithExtracted(scratch, file); err != nil {
+			return numEntries, errwrap.Wrap(err, fmt.Sprintf("error verifying %s", file.Path))
+		}
+		result.ComparedFiles++
+	}
+	return numEntries, nil
+}
+
+// checkArchive reads all entries of the tar archive from r without writing
+// them anywhere. In case a manifest is given, the contents of all regular
+// files are compared against it.
+func checkArchive(r io.Reader, m *manifest, result *VerifyStats) (int, error) {
+	expected := map[string]archivedFile{}
+	if m != nil {
+		for _, file := range m.Files {
+			if file.SHA256 != "" {
+				expected[file.Path] = file
+			}
+		}
+	}
+
+	var numEntries int
+	tarReader := tar.NewReader(r)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return numEntries, errwrap.Wrap(err, "error reading tar header")
+		}
+		numEntries++
+
+		h := sha256.New()
+		size, err := io.Copy(h, tarReader)
+		if err != nil {
+			return numEntries, errwrap.Wrap(err, fmt.Sprintf("error reading contents of %s", header.Name))
+		}
+		file, ok := expected[header.Name]
+		if !ok || header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if actual := hex.EncodeToString(h.Sum(nil)); size != file.Size || !strings.EqualFold(actual, file.SHA256) {
+			return numEntries, errwrap.Wrap(
+				nil,
+				fmt.Sprintf("contents of %s do not match manifest: expected sha256 %s of %d bytes, got %s of %d bytes", header.Name, file.SHA256, file.Size, actual, size),
+			)
+		}
+		delete(expected, header.Name)
+		result.ComparedFiles++
+	}
+
+	for name := range expected {
+		return numEntries, errwrap.Wrap(nil, fmt.Sprintf("%s is listed in manifest but missing from archive", name))
+	}
+	return numEntries, nil
+}
+
+// runVerification verifies the most recent backup in each storage backend of
+// the given configuration without writing the archive contents to disk. The
+// result is reported using the configured notifications. Any panic will be
+// recovered and returned as an error.
+func runVerification(c *Config) (err error) {
+	defer func() {
+		if derr := recover(); derr != nil {
+			fmt.Printf("%s: %s\n", derr, debug.Stack())
+			asErr, ok := derr.(error)
+			if ok {
+				err = errwrap.Wrap(asErr, "unexpected panic verifying backups")
+			} else {
+				err = errwrap.Wrap(nil, fmt.Sprintf("%v", derr))
+			}
+		}
+	}()
+
+	s := newScript(c)
+	s.notificationScope = "verify"
+
+	unlock, lockErr := s.lock("/var/lock/dockervolumebackup.lock")
+	if lockErr != nil {
+		return errwrap.Wrap(lockErr, "error acquiring file lock")
+	}
+	defer func() {
+		if derr := unlock(); derr != nil {
+			err = errors.Join(err, errwrap.Wrap(derr, "error releasing file lock"))
+		}
+	}()
+
+	return s.runSubcommand(func() error {
+		if len(s.storages) == 0 {
+			return errwrap.Wrap(nil, "no storage backends are configured")
+		}
+		var errs []error
+		for _, backend := range s.storages {
+			if err := s.verifyArchive("", verifyOpts{
+				backend: backend.Name(),
+				latest:  true,
+				discard: true,
+			}); err != nil {
+				errs = append(errs, errwrap.Wrap(err, fmt.Sprintf("error verifying latest backup in %s", backend.Name())))
+			}
+		}
+		return errors.Join(errs...)
+	}, true)
+}
+
+// latestBackups returns the name of the most recent backup that is stored in
+// the given backend. In case backups are split by directory, the name of the
+// most recent backup of each directory is returned.
+func (s *script) latestBackups(backend storage.Backend) ([]string, error) {
+	backups, err := backend.List(s.c.commonPruningPrefix())
+	if err != nil {
+		return nil, errwrap.Wrap(err, fmt.Sprintf("error listing backups in %s", backend.Name()))
+	}
+	var pattern *regexp.Regexp
+	if s.c.BackupSplitByDirectory {
+		pattern = s.c.sourcePattern()
+	}
+	latest := map[string]*storage.BackupInfo{}
+	for i, b := range backups {
+		if storage.IsSidecar(b.Name) || storage.IsChunk(b.Name) {
+			continue
+		}
+		var source string
+		if pattern != nil {
+			match := pattern.FindStringSubmatch(b.Name)
+			if match == nil {
+				continue
+			}
+			source = match[1]
+		}
+		if current, ok := latest[source]; !ok || b.LastModified.After(current.LastModified) {
+			latest[source] = &backups[i]
+		}
+	}
+	if len(latest) == 0 {
+		return nil, errwrap.Wrap(nil, fmt.Sprintf("no backups found in %s", backend.Name()))
+	}
+	var names []string
+	for _, b := range latest {
+		names = append(names, b.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// downloadManifest returns the manifest that is stored next to the archive
+// of the given name, or nil in case no manifest exists. Manifests of encrypted
+// archives are encrypted too and are decrypted using the configured keys.
+func (s *script) downloadManifest(backend storage.Backend, name string) (*manifest, error) {
+	manifestName := name + manifestSuffix
+	if ext := path.Ext(name); ext == ".gpg" || ext == ".age" {
+		manifestName += ext
+	}
+	candidates, err := backend.List(manifestName)
+	if err != nil {
+		return nil, errwrap.Wrap(err, fmt.Sprintf("error listing files in %s", backend.Name()))
+	}
+	found := false
+	for _, c := range candidates {
+		if c.Name == manifestName {
+			found = true
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	if err := backend.Download(manifestName, &buf); err != nil {
+		return nil, errwrap.Wrap(err, "error downloading manifest")
+	}
+	plaintext, err := s.decryptArchive(manifestName, &buf)
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error decrypting manifest")
+	}
+	var m manifest
+	if err := json.NewDecoder(plaintext).Decode(&m); err != nil {
+		return nil, errwrap.Wrap(err, "error unmarshaling manifest")
+	}
+	return &m, nil
+}
+
+// compareWithExtracted checks that the given file that is listed in a
+// manifest has been extracted into the scratch directory with the expected
+// size and contents.
+func compareWithExtracted(scratch string, file archivedFile) (returnErr error) {
+	// Device files and the like are listed in the manifest, but they are
+	// not extracted.
+	if file.SHA256 == "" && !strings.HasPrefix(file.Mode, "d") && !strings.HasPrefix(file.Mode, "L") {
+		return nil
+	}
+
+	dst := filepath.Join(scratch, filepath.Clean("/"+file.Path))
+	fi, err := os.Lstat(dst)
+	if err != nil {
+		return errwrap.Wrap(err, "error looking up extracted file")
+	}
+	if file.SHA256 == "" {
+		return nil
+	}
+	if !fi.Mode().IsRegular() || fi.Size() != file.Size {
+		return errwrap.Wrap(nil, fmt.Sprintf("expected regular file of size %d, got %s of size %d", file.Size, fi.Mode().String(), fi.Size()))
+	}
+
+	f, err := os.Open(dst)
+	if err != nil {
+		return errwrap.Wrap(err, "error opening extracted file")
+	}
+	defer func() {
+		returnErr = errors.Join(returnErr, f.Close())
+	}()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return errwrap.Wrap(err, "error reading extracted file")
+	}
+	if actual := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(actual, file.SHA256) {
+		return errwrap.Wrap(nil, fmt.Sprintf("checksum mismatch: expected sha256 %s, got %s", file.SHA256, actual))
+	}
+	return nil
+}
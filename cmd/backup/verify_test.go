@@ -0,0 +1,116 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"log/slog"
+	"path"
+	"testing"
+
+	"github.com/offen/docker-volume-backup/internal/storage"
+)
+
+func TestCheckArchive(t *testing.T) {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	content := []byte("hello")
+	if err := tw.WriteHeader(&tar.Header{Name: "/backup/hello.txt", Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	helloSum := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	tests := []struct {
+		name        string
+		manifest    *manifest
+		expectError bool
+	}{
+		{
+			"no manifest",
+			nil,
+			false,
+		},
+		{
+			"matching manifest",
+			&manifest{Files: []archivedFile{{Path: "/backup/hello.txt", Size: 5, SHA256: helloSum}}},
+			false,
+		},
+		{
+			"checksum mismatch",
+			&manifest{Files: []archivedFile{{Path: "/backup/hello.txt", Size: 5, SHA256: "abc"}}},
+			true,
+		},
+		{
+			"missing file",
+			&manifest{Files: []archivedFile{
+				{Path: "/backup/hello.txt", Size: 5, SHA256: helloSum},
+				{Path: "/backup/other.txt", Size: 5, SHA256: helloSum},
+			}},
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var result VerifyStats
+			numEntries, err := checkArchive(bytes.NewReader(archive.Bytes()), test.manifest, &result)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if numEntries != 1 {
+				t.Errorf("Expected 1 entry, got %d", numEntries)
+			}
+		})
+	}
+}
+
+func TestManifestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       Config
+		file         string
+		expectedName string
+	}{
+		{"plaintext", Config{}, "/tmp/backup.tar.gz", "backup.tar.gz.manifest.json"},
+		{"encrypted", Config{AgePassphrase: "secret"}, "/tmp/backup.tar.gz.age", "backup.tar.gz.age.manifest.json.age"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backend := newMemoryBackend("Memory")
+			s := &script{
+				c:             &test.config,
+				file:          test.file,
+				storages:      []storage.Backend{backend},
+				archivedFiles: []archivedFile{{Path: "/backup/secret-file.txt", Size: 5, SHA256: "abc"}},
+				stats:         &Stats{},
+				logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+			if err := s.uploadManifest(); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			data, ok := backend.files[test.expectedName]
+			if !ok {
+				t.Fatalf("Expected manifest %s to be uploaded, got %v", test.expectedName, backend.files)
+			}
+			if leaks := bytes.Contains(data, []byte("secret-file.txt")); leaks == (test.config.AgePassphrase != "") {
+				t.Errorf("Unexpected manifest content %s", data)
+			}
+
+			_, name := path.Split(test.file)
+			m, err := s.downloadManifest(backend, name)
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if m == nil || len(m.Files) != 1 || m.Files[0].Path != "/backup/secret-file.txt" {
+				t.Errorf("Unexpected manifest %v", m)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2026 - offen.software <hioffen@posteo.de>
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/offen/docker-volume-backup/internal/errwrap"
+)
+
+// webhookPayload is the body that is posted to webhooks.
+type webhookPayload struct {
+	Event   string `json:"event"`
+	Phase   string `json:"phase"`
+	Step    string `json:"step"`
+	Archive string `json:"archive"`
+	Error   string `json:"error,omitempty"`
+	Stats   *Stats `json:"stats"`
+}
+
+// runWebhooks posts the current state of the run to all configured webhooks
+// that are subscribed to the given step of the given phase. Webhooks that do
+// not respond with a 2xx status code fail the run before a phase is entered,
+// and are logged after a phase has finished. The given error is the one the
+// phase has finished with, if any.
+func (s *script) runWebhooks(phase lifecyclePhase, step string, runErr error) error {
+	event := fmt.Sprintf("%s-%s", phase, step)
+	if len(s.c.WebhookURLs) == 0 || (len(s.c.WebhookEvents) != 0 && !slices.Contains(s.c.WebhookEvents, event)) {
+		return nil
+	}
+
+	payload := webhookPayload{
+		Event:   event,
+		Phase:   string(phase),
+		Step:    step,
+		Archive: s.file,
+		Stats:   s.stats,
+	}
+	if runErr != nil {
+		payload.Error = runErr.Error()
+	}
+	s.stats.Lock()
+	body, err := json.Marshal(payload)
+	s.stats.Unlock()
+	if err != nil {
+		return errwrap.Wrap(err, "error marshaling payload")
+	}
+
+	var errs []error
+	for _, url := range s.c.WebhookURLs {
+		if err := s.postWebhook(url, body); err != nil {
+			errs = append(errs, errwrap.Wrap(err, fmt.Sprintf("error calling webhook for %s", event)))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	if step == "pre" {
+		return errors.Join(errs...)
+	}
+	for _, err := range errs {
+		s.logger.Warn(err.Error())
+	}
+	return nil
+}
+
+// postWebhook posts the given body to the given URL, retrying on failure.
+func (s *script) postWebhook(url string, body []byte) error {
+	var err error
+	for attempt := 0; attempt <= s.c.WebhookRetries; attempt++ {
+		if attempt != 0 {
+			s.logger.Warn(
+				fmt.Sprintf("Calling webhook failed, retrying in %s: %v", s.c.WebhookRetryInterval, err),
+			)
+			time.Sleep(s.c.WebhookRetryInterval)
+		}
+		if err = s.doPostWebhook(url, body); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (s *script) doPostWebhook(url string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.c.WebhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return errwrap.Wrap(err, "error creating request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range s.c.WebhookHeaders {
+		req.Header.Set(key, value)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errwrap.Wrap(err, "error sending request")
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return errwrap.Wrap(nil, fmt.Sprintf("received unexpected status code %d", res.StatusCode))
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRunWebhooks(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		events        []string
+		step          string
+		runErr        error
+		expectedCalls int
+		expectError   bool
+	}{
+		{"success", http.StatusNoContent, nil, "pre", nil, 1, false},
+		{"pre failure", http.StatusInternalServerError, nil, "pre", nil, 3, true},
+		{"post failure", http.StatusInternalServerError, nil, "post", errors.New("failed"), 3, false},
+		{"not subscribed", http.StatusInternalServerError, []string{"prune-post"}, "pre", nil, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var calls int
+			var payload map[string]any
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if r.Header.Get("Authorization") != "Bearer token" {
+					t.Errorf("Unexpected authorization header %s", r.Header.Get("Authorization"))
+				}
+				if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+					t.Errorf("Unexpected error %v", err)
+				}
+				w.WriteHeader(test.status)
+			}))
+			defer server.Close()
+
+			s := &script{
+				c: &Config{
+					WebhookURLs:    []string{server.URL},
+					WebhookEvents:  test.events,
+					WebhookHeaders: HeaderMap{"Authorization": "Bearer token"},
+					WebhookTimeout: time.Second,
+					WebhookRetries: 2,
+				},
+				file:   "/tmp/backup.tar.gz",
+				stats:  &Stats{},
+				logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+			err := s.runWebhooks(lifecyclePhaseArchive, test.step, test.runErr)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if calls != test.expectedCalls {
+				t.Errorf("Expected %d calls, got %d", test.expectedCalls, calls)
+			}
+			if calls == 0 {
+				return
+			}
+			if payload["event"] != "archive-"+test.step || payload["archive"] != "/tmp/backup.tar.gz" {
+				t.Errorf("Unexpected payload %v", payload)
+			}
+			if _, ok := payload["stats"].(map[string]any); !ok {
+				t.Errorf("Expected stats in payload, got %v", payload)
+			}
+			if test.runErr != nil && payload["error"] != test.runErr.Error() {
+				t.Errorf("Expected error in payload, got %v", payload)
+			}
+		})
+	}
+}
+
+func TestHeaderMap(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expected    HeaderMap
+		expectError bool
+	}{
+		{
+			"single header",
+			"Authorization: Bearer token",
+			HeaderMap{"Authorization": "Bearer token"},
+			false,
+		},
+		{
+			"multiple headers",
+			"Authorization: Bearer token\nX-Source:backup\n",
+			HeaderMap{"Authorization": "Bearer token", "X-Source": "backup"},
+			false,
+		},
+		{
+			"values containing commas",
+			"Accept: application/json, text/plain\r\nCookie: a=1, b=2",
+			HeaderMap{"Accept": "application/json, text/plain", "Cookie": "a=1, b=2"},
+			false,
+		},
+		{
+			"values containing colons",
+			"X-Time: 12:00",
+			HeaderMap{"X-Time": "12:00"},
+			false,
+		},
+		{
+			"invalid",
+			"invalid",
+			nil,
+			true,
+		},
+		{
+			"missing name",
+			": value",
+			nil,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var h HeaderMap
+			err := h.Decode(test.input)
+			if (err != nil) != test.expectError {
+				t.Fatalf("Unexpected error value %v", err)
+			}
+			if !test.expectError && !reflect.DeepEqual(test.expected, h) {
+				t.Errorf("Expected %v, got %v", test.expected, h)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2026 - offen.software <hioffen@posteo.de>
+// SPDX-License-Identifier: MPL-2.0
+
+// Package chunker splits data into content defined chunks, so that inserting
+// or removing data only affects the chunks around the modified region.
+package chunker
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+const (
+	// MinSize is the minimum size of a chunk, unless the data ends early.
+	MinSize = 512 * 1024
+	// MaxSize is the maximum size of a chunk.
+	MaxSize = 8 * 1024 * 1024
+	// averageBits determines the average chunk size of roughly 1MiB, as a
+	// boundary is found in one out of 2^averageBits positions after MinSize.
+	averageBits = 20
+)
+
+// gear maps each byte to a pseudo random value. It is generated using a
+// fixed seed as chunk boundaries must not change between runs.
+var gear = func() (table [256]uint64) {
+	// splitmix64
+	state := uint64(0x6f6666656e)
+	for i := range table {
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return
+}()
+
+// Chunker reads data and splits it into chunks using a gear based rolling
+// hash. Chunk boundaries only depend on the 64 bytes preceding them.
+type Chunker struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+// New creates a Chunker that splits the data read from r.
+func New(r io.Reader) *Chunker {
+	return &Chunker{
+		r:   bufio.NewReaderSize(r, 1024*1024),
+		buf: make([]byte, 0, MaxSize),
+	}
+}
+
+// Next returns the next chunk. The returned slice is only valid until Next is
+// called again. io.EOF is returned once all data has been read.
+func (c *Chunker) Next() ([]byte, error) {
+	c.buf = c.buf[:0]
+	var h uint64
+	for {
+		b, err := c.r.ReadByte()
+		if errors.Is(err, io.EOF) {
+			if len(c.buf) == 0 {
+				return nil, io.EOF
+			}
+			return c.buf, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		c.buf = append(c.buf, b)
+		h = (h << 1) + gear[b]
+		if len(c.buf) >= MaxSize || (len(c.buf) >= MinSize && h>>(64-averageBits) == 0) {
+			return c.buf, nil
+		}
+	}
+}
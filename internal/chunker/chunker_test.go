@@ -0,0 +1,91 @@
+package chunker
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func chunks(t *testing.T, data []byte) [][32]byte {
+	t.Helper()
+	var result [][32]byte
+	var joined []byte
+	c := New(bytes.NewReader(data))
+	for {
+		chunk, err := c.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if len(chunk) > MaxSize {
+			t.Errorf("chunk of %d bytes exceeds maximum size", len(chunk))
+		}
+		joined = append(joined, chunk...)
+		if len(joined) < len(data) && len(chunk) < MinSize {
+			t.Errorf("chunk of %d bytes is below minimum size", len(chunk))
+		}
+		result = append(result, sha256.Sum256(chunk))
+	}
+	if !bytes.Equal(joined, data) {
+		t.Errorf("chunks do not add up to the input")
+	}
+	return result
+}
+
+func TestChunker(t *testing.T) {
+	data := make([]byte, 32*1024*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	tests := []struct {
+		name       string
+		modified   []byte
+		maxChanged int
+	}{
+		{
+			"identical data",
+			data,
+			0,
+		},
+		{
+			"prepended byte",
+			append([]byte{0}, data...),
+			1,
+		},
+		{
+			"modified byte in the middle",
+			func() []byte {
+				d := bytes.Clone(data)
+				d[len(d)/2]++
+				return d
+			}(),
+			2,
+		},
+	}
+
+	original := chunks(t, data)
+	if len(original) < 8 {
+		t.Fatalf("expected data to be split into multiple chunks, got %d", len(original))
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			known := map[[32]byte]bool{}
+			for _, c := range original {
+				known[c] = true
+			}
+			var shared int
+			for _, c := range chunks(t, test.modified) {
+				if known[c] {
+					shared++
+				}
+			}
+			if changed := len(original) - shared; changed > test.maxChanged {
+				t.Errorf("expected at most %d changed chunks, got %d of %d", test.maxChanged, changed, len(original))
+			}
+		})
+	}
+}
@@ -4,14 +4,16 @@
 package azure
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"sync"
-	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
@@ -108,73 +110,152 @@ func (b *azureBlobStorage) Name() string {
 }
 
 // Copy copies the given file to the storage backend.
-func (b *azureBlobStorage) Copy(file string) error {
+func (b *azureBlobStorage) Copy(file string) (returnErr error) {
 	fileReader, err := os.Open(file)
 	if err != nil {
 		return errwrap.Wrap(err, fmt.Sprintf("error opening file %s", file))
 	}
+	defer func() {
+		returnErr = errors.Join(returnErr, fileReader.Close())
+	}()
 
-	_, err = b.client.UploadStream(
+	return b.Upload(filepath.Base(file), fileReader)
+}
+
+// Upload uploads the contents of r to a blob of the given name in the
+// storage backend.
+func (b *azureBlobStorage) Upload(name string, r io.Reader) error {
+	_, err := b.client.UploadStream(
 		context.Background(),
 		b.containerName,
-		path.Join(b.DestinationPath, filepath.Base(file)),
-		fileReader,
+		path.Join(b.DestinationPath, name),
+		r,
 		b.uploadStreamOptions,
 	)
 	if err != nil {
-		return errwrap.Wrap(err, fmt.Sprintf("error uploading file %s", file))
+		return errwrap.Wrap(err, fmt.Sprintf("error uploading file %s", name))
 	}
 	return nil
 }
 
-// Prune rotates away backups according to the configuration and provided
-// deadline for the Azure Blob storage backend.
-func (b *azureBlobStorage) Prune(deadline time.Time, pruningPrefix string) (*storage.PruneStats, error) {
-	lookupPrefix := path.Join(b.DestinationPath, pruningPrefix)
+// Verify compares the Content-MD5 property of the blob of the given name with
+// the MD5 checksum of the uploaded data. Blobs that have been uploaded in
+// blocks do not have this property set unless it has been set explicitly.
+func (b *azureBlobStorage) Verify(name string, sums storage.Checksums) (storage.VerifyResult, error) {
+	props, err := b.client.ServiceClient().
+		NewContainerClient(b.containerName).
+		NewBlobClient(path.Join(b.DestinationPath, name)).
+		GetProperties(context.Background(), nil)
+	if err != nil {
+		return storage.ChecksumUnavailable, errwrap.Wrap(err, fmt.Sprintf("error getting properties of blob %s", name))
+	}
+	if len(props.ContentMD5) == 0 {
+		return storage.ChecksumUnavailable, nil
+	}
+	if !bytes.Equal(props.ContentMD5, sums.MD5) {
+		return storage.ChecksumMismatch, nil
+	}
+	return storage.ChecksumMatch, nil
+}
+
+// List returns information about all backups in the Azure Blob storage
+// backend whose name starts with the given prefix.
+func (b *azureBlobStorage) List(prefix string) ([]storage.BackupInfo, error) {
+	lookupPrefix := path.Join(b.DestinationPath, prefix)
 	pager := b.client.NewListBlobsFlatPager(b.containerName, &container.ListBlobsFlatOptions{
 		Prefix: &lookupPrefix,
 	})
-	var matches []string
-	var totalCount uint
+	var backups []storage.BackupInfo
 	for pager.More() {
 		resp, err := pager.NextPage(context.Background())
 		if err != nil {
 			return nil, errwrap.Wrap(err, "error paging over blobs")
 		}
 		for _, v := range resp.Segment.BlobItems {
-			totalCount++
-			if v.Properties.LastModified.Before(deadline) {
-				matches = append(matches, *v.Name)
+			info := storage.BackupInfo{
+				Name:         b.relativeName(*v.Name),
+				LastModified: *v.Properties.LastModified,
 			}
+			if v.Properties.ContentLength != nil {
+				info.Size = *v.Properties.ContentLength
+			}
+			backups = append(backups, info)
 		}
 	}
+	return backups, nil
+}
 
-	stats := &storage.PruneStats{
-		Total:  totalCount,
-		Pruned: uint(len(matches)),
+// Prune rotates away backups according to the configuration and provided
+// retention policy for the Azure Blob storage backend.
+func (b *azureBlobStorage) Prune(policy storage.RetentionPolicy, pruningPrefix string) (*storage.PruneStats, error) {
+	candidates, err := b.List(pruningPrefix)
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error listing backups")
 	}
 
-	pruneErr := b.DoPrune(b.Name(), len(matches), int(totalCount), deadline, func() error {
-		wg := sync.WaitGroup{}
-		wg.Add(len(matches))
-		var errs []error
+	bases, err := storage.IncrementalBases(b, candidates)
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error reading incremental bases")
+	}
+	prunable, stats := policy.Prunable(candidates, bases)
+	var matches []string
+	for _, candidate := range prunable {
+		matches = append(matches, candidate.Name)
+	}
 
-		for _, match := range matches {
-			name := match
-			go func() {
-				_, err := b.client.DeleteBlob(context.Background(), b.containerName, name, nil)
-				if err != nil {
-					errs = append(errs, err)
-				}
-				wg.Done()
-			}()
-		}
-		wg.Wait()
-		if len(errs) != 0 {
-			return errors.Join(errs...)
-		}
-		return nil
+	pruneErr := b.DoPrune(b.Name(), int(stats.Pruned), int(stats.Total), policy, func() error {
+		return b.Remove(matches)
 	})
 
 	return stats, pruneErr
 }
+
+// Remove deletes the blobs of the given names.
+func (b *azureBlobStorage) Remove(names []string) error {
+	wg := sync.WaitGroup{}
+	wg.Add(len(names))
+	var errs []error
+	var mu sync.Mutex
+
+	for _, name := range names {
+		blobName := path.Join(b.DestinationPath, name)
+		go func() {
+			_, err := b.client.DeleteBlob(context.Background(), b.containerName, blobName, nil)
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// relativeName strips the remote path from the given blob name.
+func (b *azureBlobStorage) relativeName(name string) string {
+	if b.DestinationPath == "" {
+		return name
+	}
+	return strings.TrimPrefix(name, path.Clean(b.DestinationPath)+"/")
+}
+
+// Download writes the contents of the backup with the given name to w.
+func (b *azureBlobStorage) Download(name string, w io.Writer) (returnErr error) {
+	resp, err := b.client.DownloadStream(context.Background(), b.containerName, path.Join(b.DestinationPath, name), nil)
+	if err != nil {
+		return errwrap.Wrap(err, fmt.Sprintf("error requesting blob %s", name))
+	}
+	defer func() {
+		returnErr = errors.Join(returnErr, resp.Body.Close())
+	}()
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return errwrap.Wrap(err, fmt.Sprintf("error downloading blob %s", name))
+	}
+	return nil
+}
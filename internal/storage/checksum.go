@@ -0,0 +1,142 @@
+// Copyright 2026 - offen.software <hioffen@posteo.de>
+// SPDX-License-Identifier: MPL-2.0
+
+package storage
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+
+	"github.com/offen/docker-volume-backup/internal/errwrap"
+)
+
+// ChecksumSuffix is appended to the name of an archive for naming the sidecar
+// file containing its SHA-256 checksum.
+const ChecksumSuffix = ".sha256"
+
+// Checksums holds the digests of a file in all formats that are needed for
+// verifying it against checksums reported by the supported storage backends.
+type Checksums struct {
+	SHA256 []byte
+	MD5    []byte
+	// ContentHash is the hash used by Dropbox, i.e. the SHA-256 of the
+	// concatenated SHA-256 hashes of all 4MiB blocks of the file.
+	ContentHash []byte
+}
+
+// Sidecar returns the contents of the checksum sidecar file for the file of
+// the given name, using the format of sha256sum.
+func (c Checksums) Sidecar(name string) []byte {
+	return fmt.Appendf(nil, "%x  %s\n", c.SHA256, name)
+}
+
+const contentHashBlockSize = 4 * 1024 * 1024
+
+// ChecksumWriter computes Checksums for all data that is written to it.
+type ChecksumWriter struct {
+	sha256    hash.Hash
+	md5       hash.Hash
+	block     hash.Hash
+	blockSize int
+	blockSums []byte
+}
+
+// NewChecksumWriter creates a new ChecksumWriter.
+func NewChecksumWriter() *ChecksumWriter {
+	return &ChecksumWriter{
+		sha256: sha256.New(),
+		md5:    md5.New(),
+		block:  sha256.New(),
+	}
+}
+
+func (c *ChecksumWriter) Write(p []byte) (int, error) {
+	c.sha256.Write(p)
+	c.md5.Write(p)
+	for rest := p; len(rest) > 0; {
+		n := min(len(rest), contentHashBlockSize-c.blockSize)
+		c.block.Write(rest[:n])
+		c.blockSize += n
+		rest = rest[n:]
+		if c.blockSize == contentHashBlockSize {
+			c.blockSums = c.block.Sum(c.blockSums)
+			c.block.Reset()
+			c.blockSize = 0
+		}
+	}
+	return len(p), nil
+}
+
+// Sum returns the checksums of all data written so far.
+func (c *ChecksumWriter) Sum() Checksums {
+	blockSums := c.blockSums
+	if c.blockSize > 0 {
+		blockSums = c.block.Sum(bytes.Clone(blockSums))
+	}
+	contentHash := sha256.Sum256(blockSums)
+	return Checksums{
+		SHA256:      c.sha256.Sum(nil),
+		MD5:         c.md5.Sum(nil),
+		ContentHash: contentHash[:],
+	}
+}
+
+// VerifyResult is the result of comparing a server side checksum.
+type VerifyResult int
+
+const (
+	// ChecksumUnavailable means the server does not provide a checksum that
+	// can be compared, e.g. because it has been computed in a way that cannot
+	// be reproduced locally.
+	ChecksumUnavailable VerifyResult = iota
+	// ChecksumMatch means the server side checksum matches.
+	ChecksumMatch
+	// ChecksumMismatch means the server side checksum does not match.
+	ChecksumMismatch
+)
+
+// Verifier is implemented by storage backends that can look up checksums of
+// stored files that have been computed by the remote server.
+type Verifier interface {
+	// Verify compares the server side checksum of the file of the given name
+	// with the given checksums.
+	Verify(name string, sums Checksums) (VerifyResult, error)
+}
+
+// VerifyUpload ensures the file of the given name that is stored in b matches
+// the given checksums. In case b does not implement Verifier or no server
+// side checksum is available, the file is downloaded and hashed instead if
+// allowDownload is true. An error is returned in case the checksums do not
+// match. The returned bool reports whether the file could be verified at all.
+func VerifyUpload(b Backend, name string, sums Checksums, allowDownload bool) (bool, error) {
+	if v, ok := b.(Verifier); ok {
+		result, err := v.Verify(name, sums)
+		if err != nil {
+			return false, errwrap.Wrap(err, fmt.Sprintf("error looking up checksum of %s", name))
+		}
+		switch result {
+		case ChecksumMatch:
+			return true, nil
+		case ChecksumMismatch:
+			return false, errwrap.Wrap(nil, fmt.Sprintf("server side checksum mismatch for %s", name))
+		}
+	}
+	if !allowDownload {
+		return false, nil
+	}
+
+	h := sha256.New()
+	if err := b.Download(name, h); err != nil {
+		return false, errwrap.Wrap(err, fmt.Sprintf("error downloading %s for verification", name))
+	}
+	if actual := h.Sum(nil); !bytes.Equal(actual, sums.SHA256) {
+		return false, errwrap.Wrap(
+			nil,
+			fmt.Sprintf("checksum mismatch for %s: expected sha256 %x, got %x", name, sums.SHA256, actual),
+		)
+	}
+	return true, nil
+}
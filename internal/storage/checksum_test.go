@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"testing"
+)
+
+func TestChecksumWriterContentHash(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), contentHashBlockSize+10)
+	first := sha256.Sum256(data[:contentHashBlockSize])
+	second := sha256.Sum256(data[contentHashBlockSize:])
+	expected := sha256.Sum256(append(first[:], second[:]...))
+
+	w := NewChecksumWriter()
+	for _, chunk := range [][]byte{data[:100], data[100 : contentHashBlockSize+5], data[contentHashBlockSize+5:]} {
+		if _, err := w.Write(chunk); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	sums := w.Sum()
+	if !bytes.Equal(expected[:], sums.ContentHash) {
+		t.Errorf("Expected content hash %x, got %x", expected, sums.ContentHash)
+	}
+	if full := sha256.Sum256(data); !bytes.Equal(full[:], sums.SHA256) {
+		t.Errorf("Expected sha256 %x, got %x", full, sums.SHA256)
+	}
+	if again := w.Sum(); !bytes.Equal(again.ContentHash, sums.ContentHash) {
+		t.Errorf("Expected Sum to be idempotent")
+	}
+}
+
+type verifyBackend struct {
+	Backend
+	content []byte
+	result  VerifyResult
+}
+
+func (b *verifyBackend) Verify(name string, sums Checksums) (VerifyResult, error) {
+	return b.result, nil
+}
+
+func (b *verifyBackend) Download(name string, w io.Writer) error {
+	_, err := w.Write(b.content)
+	return err
+}
+
+func TestVerifyUpload(t *testing.T) {
+	w := NewChecksumWriter()
+	w.Write([]byte("content"))
+	sums := w.Sum()
+
+	tests := []struct {
+		name          string
+		backend       *verifyBackend
+		allowDownload bool
+		expected      bool
+		expectError   bool
+	}{
+		{"server side checksum", &verifyBackend{result: ChecksumMatch}, false, true, false},
+		{"server side mismatch", &verifyBackend{result: ChecksumMismatch, content: []byte("content")}, true, false, true},
+		{"server side mismatch without download", &verifyBackend{result: ChecksumMismatch}, false, false, true},
+		{"download fallback", &verifyBackend{content: []byte("content")}, true, true, false},
+		{"download fallback mismatch", &verifyBackend{content: []byte("other")}, true, false, true},
+		{"download fallback disabled", &verifyBackend{content: []byte("other")}, false, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verified, err := VerifyUpload(test.backend, "test.tar.gz", sums, test.allowDownload)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if verified != test.expected {
+				t.Errorf("Expected verified to be %v, got %v", test.expected, verified)
+			}
+		})
+	}
+}
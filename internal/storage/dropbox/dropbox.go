@@ -3,14 +3,15 @@ package dropbox
 import (
 	"bytes"
 	"context"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"path"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/dropbox/dropbox-sdk-go-unofficial/v6/dropbox"
 	"github.com/dropbox/dropbox-sdk-go-unofficial/v6/dropbox/files"
@@ -89,41 +90,43 @@ func (b *dropboxStorage) Name() string {
 
 // Copy copies the given file to the WebDav storage backend.
 func (b *dropboxStorage) Copy(file string) (returnErr error) {
+	r, err := os.Open(file)
+	if err != nil {
+		returnErr = errwrap.Wrap(err, "error opening the file to be uploaded")
+		return
+	}
+	defer func() {
+		returnErr = errors.Join(returnErr, r.Close())
+	}()
+
 	_, name := path.Split(file)
+	return b.Upload(name, r)
+}
 
+// Upload uploads the contents of r to a file of the given name in the
+// Dropbox storage backend.
+func (b *dropboxStorage) Upload(name string, r io.Reader) error {
 	folderArg := files.NewCreateFolderArg(b.DestinationPath)
 	if _, err := b.client.CreateFolderV2(folderArg); err != nil {
 		switch err := err.(type) {
 		case files.CreateFolderV2APIError:
 			if err.EndpointError.Path.Tag != files.WriteErrorConflict {
-				returnErr = errwrap.Wrap(err, fmt.Sprintf("error creating directory '%s'", b.DestinationPath))
-				return
+				return errwrap.Wrap(err, fmt.Sprintf("error creating directory '%s'", b.DestinationPath))
 			}
 			b.Log(storage.LogLevelInfo, b.Name(), "Destination path '%s' already exists, no new directory required.", b.DestinationPath)
 		default:
-			returnErr = errwrap.Wrap(err, fmt.Sprintf("error creating directory '%s'", b.DestinationPath))
-			return
+			return errwrap.Wrap(err, fmt.Sprintf("error creating directory '%s'", b.DestinationPath))
 		}
 	}
 
-	r, err := os.Open(file)
-	if err != nil {
-		returnErr = errwrap.Wrap(err, "error opening the file to be uploaded")
-		return
-	}
-	defer func() {
-		returnErr = errors.Join(returnErr, r.Close())
-	}()
-
 	// Start new upload session and get session id
-	b.Log(storage.LogLevelInfo, b.Name(), "Starting upload session for backup '%s' at path '%s'.", file, b.DestinationPath)
+	b.Log(storage.LogLevelInfo, b.Name(), "Starting upload session for backup '%s' at path '%s'.", name, b.DestinationPath)
 
 	var sessionId string
 	uploadSessionStartArg := files.NewUploadSessionStartArg()
 	uploadSessionStartArg.SessionType = &files.UploadSessionType{Tagged: dropbox.Tagged{Tag: files.UploadSessionTypeConcurrent}}
 	if res, err := b.client.UploadSessionStart(uploadSessionStartArg, nil); err != nil {
-		returnErr = errwrap.Wrap(err, "error starting the upload session")
-		return
+		return errwrap.Wrap(err, "error starting the upload session")
 	} else {
 		sessionId = res.SessionId
 	}
@@ -169,8 +172,10 @@ loop:
 			default:
 			}
 
-			bytesRead, err := r.Read(chunk)
-			if err != nil {
+			// Reading from a stream might return less than a full chunk
+			// before reaching its end, so reads need to be repeated.
+			bytesRead, err := io.ReadFull(r, chunk)
+			if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
 				errorChn <- errwrap.Wrap(err, "error reading the file to be uploaded")
 				mu.Unlock()
 				return
@@ -198,23 +203,43 @@ loop:
 
 	// Finish the upload session, commit the file (no new data added)
 
-	_, err = b.client.UploadSessionFinish(
+	_, err := b.client.UploadSessionFinish(
 		files.NewUploadSessionFinishArg(
 			files.NewUploadSessionCursor(sessionId, 0),
 			files.NewCommitInfo(path.Join(b.DestinationPath, name)),
 		), nil)
 	if err != nil {
-		returnErr = errwrap.Wrap(err, "error finishing the upload session")
-		return
+		return errwrap.Wrap(err, "error finishing the upload session")
 	}
 
-	b.Log(storage.LogLevelInfo, b.Name(), "Uploaded a copy of backup '%s' at path '%s'.", file, b.DestinationPath)
+	b.Log(storage.LogLevelInfo, b.Name(), "Uploaded a copy of backup '%s' at path '%s'.", name, b.DestinationPath)
 
 	return nil
 }
 
-// Prune rotates away backups according to the configuration and provided deadline for the Dropbox storage backend.
-func (b *dropboxStorage) Prune(deadline time.Time, pruningPrefix string) (*storage.PruneStats, error) {
+// Verify compares the content hash Dropbox computed for the file of the
+// given name with the content hash of the uploaded data.
+func (b *dropboxStorage) Verify(name string, sums storage.Checksums) (storage.VerifyResult, error) {
+	metadata, err := b.client.GetMetadata(files.NewGetMetadataArg(path.Join(b.DestinationPath, name)))
+	if err != nil {
+		return storage.ChecksumUnavailable, errwrap.Wrap(err, fmt.Sprintf("error looking up metadata of %s in Dropbox storage", name))
+	}
+	file, ok := metadata.(*files.FileMetadata)
+	if !ok {
+		return storage.ChecksumUnavailable, errwrap.Wrap(nil, fmt.Sprintf("%s is not a file", name))
+	}
+	if file.ContentHash == "" {
+		return storage.ChecksumUnavailable, nil
+	}
+	if file.ContentHash != hex.EncodeToString(sums.ContentHash) {
+		return storage.ChecksumMismatch, nil
+	}
+	return storage.ChecksumMatch, nil
+}
+
+// List returns information about all backups in the Dropbox storage backend
+// whose name starts with the given prefix.
+func (b *dropboxStorage) List(prefix string) ([]storage.BackupInfo, error) {
 	var entries []files.IsMetadata
 	res, err := b.client.ListFolder(files.NewListFolderArg(b.DestinationPath))
 	if err != nil {
@@ -230,36 +255,71 @@ func (b *dropboxStorage) Prune(deadline time.Time, pruningPrefix string) (*stora
 		entries = append(entries, res.Entries...)
 	}
 
-	var matches []*files.FileMetadata
-	var lenCandidates int
+	var backups []storage.BackupInfo
 	for _, candidate := range entries {
 		switch candidate := candidate.(type) {
 		case *files.FileMetadata:
-			if !strings.HasPrefix(candidate.Name, pruningPrefix) {
+			if !strings.HasPrefix(candidate.Name, prefix) {
 				continue
 			}
-			lenCandidates++
-			if candidate.ServerModified.Before(deadline) {
-				matches = append(matches, candidate)
-			}
+			backups = append(backups, storage.BackupInfo{
+				Name:         candidate.Name,
+				Size:         int64(candidate.Size),
+				LastModified: candidate.ServerModified,
+			})
 		default:
 			continue
 		}
 	}
+	return backups, nil
+}
 
-	stats := &storage.PruneStats{
-		Total:  uint(lenCandidates),
-		Pruned: uint(len(matches)),
+// Prune rotates away backups according to the configuration and provided retention policy for the Dropbox storage backend.
+func (b *dropboxStorage) Prune(policy storage.RetentionPolicy, pruningPrefix string) (*storage.PruneStats, error) {
+	candidates, err := b.List(pruningPrefix)
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error listing backups")
 	}
 
-	pruneErr := b.DoPrune(b.Name(), len(matches), lenCandidates, deadline, func() error {
-		for _, match := range matches {
-			if _, err := b.client.DeleteV2(files.NewDeleteArg(path.Join(b.DestinationPath, match.Name))); err != nil {
-				return errwrap.Wrap(err, "error removing file from Dropbox storage")
-			}
-		}
-		return nil
+	bases, err := storage.IncrementalBases(b, candidates)
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error reading incremental bases")
+	}
+	prunable, stats := policy.Prunable(candidates, bases)
+	var matches []string
+	for _, candidate := range prunable {
+		matches = append(matches, candidate.Name)
+	}
+
+	pruneErr := b.DoPrune(b.Name(), int(stats.Pruned), int(stats.Total), policy, func() error {
+		return b.Remove(matches)
 	})
 
 	return stats, pruneErr
 }
+
+// Remove deletes the files of the given names.
+func (b *dropboxStorage) Remove(names []string) error {
+	for _, name := range names {
+		if _, err := b.client.DeleteV2(files.NewDeleteArg(path.Join(b.DestinationPath, name))); err != nil {
+			return errwrap.Wrap(err, "error removing file from Dropbox storage")
+		}
+	}
+	return nil
+}
+
+// Download writes the contents of the backup with the given name to w.
+func (b *dropboxStorage) Download(name string, w io.Writer) (returnErr error) {
+	_, content, err := b.client.Download(files.NewDownloadArg(path.Join(b.DestinationPath, name)))
+	if err != nil {
+		return errwrap.Wrap(err, fmt.Sprintf("error requesting %s from Dropbox storage", name))
+	}
+	defer func() {
+		returnErr = errors.Join(returnErr, content.Close())
+	}()
+
+	if _, err := io.Copy(w, content); err != nil {
+		return errwrap.Wrap(err, fmt.Sprintf("error downloading %s from Dropbox storage", name))
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -92,9 +93,6 @@ func (b *googleDriveStorage) Name() string {
 
 // Copy copies the given file to the Google Drive storage backend.
 func (b *googleDriveStorage) Copy(file string) (returnErr error) {
-	_, name := filepath.Split(file)
-	b.Log(storage.LogLevelInfo, b.Name(), "Starting upload for backup '%s'.", name)
-
 	f, err := os.Open(file)
 	if err != nil {
 		returnErr = errwrap.Wrap(err, fmt.Sprintf("failed to open file %s", file))
@@ -104,40 +102,136 @@ func (b *googleDriveStorage) Copy(file string) (returnErr error) {
 		returnErr = errors.Join(returnErr, f.Close())
 	}()
 
-	driveFile := &drive.File{Name: name}
-	if b.DestinationPath != "" {
-		driveFile.Parents = []string{b.DestinationPath}
-	} else {
-		driveFile.Parents = []string{"root"}
-	}
+	_, name := filepath.Split(file)
+	return b.Upload(name, f)
+}
+
+// Upload uploads the contents of r to a file of the given name in the Google
+// Drive storage backend.
+func (b *googleDriveStorage) Upload(name string, r io.Reader) error {
+	b.Log(storage.LogLevelInfo, b.Name(), "Starting upload for backup '%s'.", name)
+
+	driveFile := &drive.File{Name: name, Parents: []string{b.parentID()}}
 
 	createCall := b.client.Files.Create(driveFile).SupportsAllDrives(true).Fields("id")
-	created, err := createCall.Media(f).Do()
+	created, err := createCall.Media(r).Do()
 	if err != nil {
-		returnErr = errwrap.Wrap(err, fmt.Sprintf("failed to upload %s", name))
-		return
+		return errwrap.Wrap(err, fmt.Sprintf("failed to upload %s", name))
 	}
 
 	b.Log(storage.LogLevelInfo, b.Name(), "Finished upload for %s. File ID: %s", name, created.Id)
 	return nil
 }
 
-// Prune rotates away backups according to the configuration and provided deadline for the Google Drive storage backend.
-func (b *googleDriveStorage) Prune(deadline time.Time, pruningPrefix string) (*storage.PruneStats, error) {
-	parentID := b.DestinationPath
-	if parentID == "" {
-		parentID = "root"
+// List returns information about all backups in the Google Drive storage
+// backend whose name starts with the given prefix.
+func (b *googleDriveStorage) List(prefix string) ([]storage.BackupInfo, error) {
+	driveFiles, err := b.listFiles(prefix)
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error listing files")
 	}
+	var backups []storage.BackupInfo
+	for _, f := range driveFiles {
+		backups = append(backups, storage.BackupInfo{
+			Name:         f.Name,
+			Size:         f.Size,
+			LastModified: f.created,
+		})
+	}
+	return backups, nil
+}
 
-	query := fmt.Sprintf("name contains '%s' and trashed = false", pruningPrefix)
-	if parentID != "root" {
-		query = fmt.Sprintf("'%s' in parents and (%s)", parentID, query)
+// Prune rotates away backups according to the configuration and provided retention policy for the Google Drive storage backend.
+func (b *googleDriveStorage) Prune(policy storage.RetentionPolicy, pruningPrefix string) (*storage.PruneStats, error) {
+	candidates, err := b.listFiles(pruningPrefix)
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error listing files")
 	}
 
+	infoOf := func(f driveFile) storage.BackupInfo {
+		return storage.BackupInfo{Name: f.Name, LastModified: f.created}
+	}
+	infos := make([]storage.BackupInfo, len(candidates))
+	for i, f := range candidates {
+		infos[i] = infoOf(f)
+	}
+	bases, err := storage.IncrementalBases(b, infos)
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error reading incremental bases")
+	}
+	matches, stats := storage.SelectPrunable(policy, candidates, bases, infoOf)
+
+	pruneErr := b.DoPrune(b.Name(), int(stats.Pruned), int(stats.Total), policy, func() error {
+		b.deleteFiles(matches)
+		return nil
+	})
+
+	return stats, pruneErr
+}
+
+// Remove deletes the files of the given names. As files are identified by
+// their id, the destination folder is listed for looking them up.
+func (b *googleDriveStorage) Remove(names []string) error {
+	driveFiles, err := b.listFiles("")
+	if err != nil {
+		return errwrap.Wrap(err, "error listing files")
+	}
+	remove := make(map[string]bool, len(names))
+	for _, name := range names {
+		remove[name] = true
+	}
+	var matches []driveFile
+	for _, file := range driveFiles {
+		if remove[file.Name] {
+			matches = append(matches, file)
+		}
+	}
+	b.deleteFiles(matches)
+	return nil
+}
+
+// deleteFiles deletes the given files, logging a warning for each file that
+// could not be deleted.
+func (b *googleDriveStorage) deleteFiles(files []driveFile) {
+	for _, file := range files {
+		b.Log(storage.LogLevelInfo, b.Name(), "Deleting file: %s", file.Name)
+		if err := b.client.Files.Delete(file.Id).SupportsAllDrives(true).Do(); err != nil {
+			b.Log(storage.LogLevelWarning, b.Name(), "Error deleting %s: %v", file.Name, err)
+		}
+	}
+}
+
+// parentID returns the id of the folder backups are stored in. All queries
+// are restricted to this folder, so files stored elsewhere in the drive are
+// never listed or deleted.
+func (b *googleDriveStorage) parentID() string {
+	if b.DestinationPath == "" {
+		return "root"
+	}
+	return b.DestinationPath
+}
+
+// escapeQuery escapes the given value for use as a string in a query.
+func escapeQuery(value string) string {
+	return strings.ReplaceAll(value, "'", "\\'")
+}
+
+// driveFile is a file stored in Google Drive alongside its parsed creation
+// time.
+type driveFile struct {
+	*drive.File
+	created time.Time
+}
+
+// listFiles returns all files in the destination folder whose name starts
+// with the given prefix. Files with an unparseable creation time are skipped.
+func (b *googleDriveStorage) listFiles(prefix string) ([]driveFile, error) {
+	query := fmt.Sprintf("'%s' in parents and name contains '%s' and trashed = false", b.parentID(), escapeQuery(prefix))
+
 	var allFiles []*drive.File
 	pageToken := ""
 	for {
-		req := b.client.Files.List().Q(query).SupportsAllDrives(true).Fields("files(id, name, createdTime, parents)").PageToken(pageToken)
+		req := b.client.Files.List().Q(query).SupportsAllDrives(true).Fields("nextPageToken, files(id, name, size, createdTime, parents)").PageToken(pageToken)
 		if b.teamDriveID != "" {
 			req = req.DriveId(b.teamDriveID).IncludeItemsFromAllDrives(true).Corpora("drive")
 		}
@@ -152,37 +246,46 @@ func (b *googleDriveStorage) Prune(deadline time.Time, pruningPrefix string) (*s
 		}
 	}
 
-	var matches []*drive.File
-	var lenCandidates int
+	var result []driveFile
 	for _, f := range allFiles {
-		if !strings.HasPrefix(f.Name, pruningPrefix) {
+		if !strings.HasPrefix(f.Name, prefix) {
 			continue
 		}
-		lenCandidates++
 		created, err := time.Parse(time.RFC3339, f.CreatedTime)
 		if err != nil {
 			b.Log(storage.LogLevelWarning, b.Name(), "Could not parse time for backup %s: %v", f.Name, err)
 			continue
 		}
-		if created.Before(deadline) {
-			matches = append(matches, f)
-		}
+		result = append(result, driveFile{File: f, created: created})
 	}
+	return result, nil
+}
 
-	stats := &storage.PruneStats{
-		Total:  uint(lenCandidates),
-		Pruned: uint(len(matches)),
+// Download writes the contents of the backup with the given name to w.
+func (b *googleDriveStorage) Download(name string, w io.Writer) (returnErr error) {
+	query := fmt.Sprintf("'%s' in parents and name = '%s' and trashed = false", b.parentID(), escapeQuery(name))
+	req := b.client.Files.List().Q(query).SupportsAllDrives(true).Fields("files(id, name)")
+	if b.teamDriveID != "" {
+		req = req.DriveId(b.teamDriveID).IncludeItemsFromAllDrives(true).Corpora("drive")
+	}
+	res, err := req.Do()
+	if err != nil {
+		return errwrap.Wrap(err, "listing files")
+	}
+	if len(res.Files) == 0 {
+		return errwrap.Wrap(nil, fmt.Sprintf("no file named %s found", name))
 	}
 
-	pruneErr := b.DoPrune(b.Name(), len(matches), lenCandidates, deadline, func() error {
-		for _, file := range matches {
-			b.Log(storage.LogLevelInfo, b.Name(), "Deleting old backup file: %s", file.Name)
-			if err := b.client.Files.Delete(file.Id).SupportsAllDrives(true).Do(); err != nil {
-				b.Log(storage.LogLevelWarning, b.Name(), "Error deleting %s: %v", file.Name, err)
-			}
-		}
-		return nil
-	})
+	resp, err := b.client.Files.Get(res.Files[0].Id).SupportsAllDrives(true).Download()
+	if err != nil {
+		return errwrap.Wrap(err, fmt.Sprintf("failed to request %s", name))
+	}
+	defer func() {
+		returnErr = errors.Join(returnErr, resp.Body.Close())
+	}()
 
-	return stats, pruneErr
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return errwrap.Wrap(err, fmt.Sprintf("failed to download %s", name))
+	}
+	return nil
 }
@@ -10,7 +10,6 @@ import (
 	"os"
 	"path"
 	"path/filepath"
-	"time"
 
 	"github.com/offen/docker-volume-backup/internal/errwrap"
 	"github.com/offen/docker-volume-backup/internal/storage"
@@ -44,35 +43,58 @@ func (b *localStorage) Name() string {
 }
 
 // Copy copies the given file to the local storage backend.
-func (b *localStorage) Copy(file string) error {
+func (b *localStorage) Copy(file string) (returnErr error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return errwrap.Wrap(err, "error opening the file to be copied")
+	}
+	defer func() {
+		returnErr = errors.Join(returnErr, f.Close())
+	}()
+
 	_, name := path.Split(file)
+	return b.UploadArchive(name, f)
+}
 
-	if err := copyFile(file, path.Join(b.DestinationPath, name)); err != nil {
+// Upload writes the contents of r to a file of the given name in the local
+// storage backend.
+func (b *localStorage) Upload(name string, r io.Reader) error {
+	if err := writeFile(r, path.Join(b.DestinationPath, name)); err != nil {
 		return errwrap.Wrap(err, "error copying file to archive")
 	}
-	b.Log(storage.LogLevelInfo, b.Name(), "Stored copy of backup `%s` in `%s`.", file, b.DestinationPath)
+	b.Log(storage.LogLevelInfo, b.Name(), "Stored copy of backup `%s` in `%s`.", name, b.DestinationPath)
+	return nil
+}
 
-	if b.latestSymlink != "" {
-		symlink := path.Join(b.DestinationPath, b.latestSymlink)
-		if _, err := os.Lstat(symlink); err == nil {
-			if err := os.Remove(symlink); err != nil {
-				return errwrap.Wrap(err, "error removing existing symlink")
-			}
-		}
-		if err := os.Symlink(name, symlink); err != nil {
-			return errwrap.Wrap(err, "error creating latest symlink")
-		}
-		b.Log(storage.LogLevelInfo, b.Name(), "Created/Updated symlink `%s` for latest backup.", b.latestSymlink)
+// UploadArchive writes the contents of r to a file of the given name and
+// points the latest symlink at it, if configured.
+func (b *localStorage) UploadArchive(name string, r io.Reader) error {
+	if err := b.Upload(name, r); err != nil {
+		return err
+	}
+	if b.latestSymlink == "" {
+		return nil
 	}
 
+	symlink := path.Join(b.DestinationPath, b.latestSymlink)
+	if _, err := os.Lstat(symlink); err == nil {
+		if err := os.Remove(symlink); err != nil {
+			return errwrap.Wrap(err, "error removing existing symlink")
+		}
+	}
+	if err := os.Symlink(name, symlink); err != nil {
+		return errwrap.Wrap(err, "error creating latest symlink")
+	}
+	b.Log(storage.LogLevelInfo, b.Name(), "Created/Updated symlink `%s` for latest backup.", b.latestSymlink)
 	return nil
 }
 
-// Prune rotates away backups according to the configuration and provided deadline for the local storage backend.
-func (b *localStorage) Prune(deadline time.Time, pruningPrefix string) (*storage.PruneStats, error) {
+// List returns information about all backups in the local storage backend
+// whose name starts with the given prefix.
+func (b *localStorage) List(prefix string) ([]storage.BackupInfo, error) {
 	globPattern := path.Join(
 		b.DestinationPath,
-		fmt.Sprintf("%s*", pruningPrefix),
+		fmt.Sprintf("%s*", prefix),
 	)
 	globMatches, err := filepath.Glob(globPattern)
 	if err != nil {
@@ -85,7 +107,7 @@ func (b *localStorage) Prune(deadline time.Time, pruningPrefix string) (*storage
 		)
 	}
 
-	var candidates []string
+	var backups []storage.BackupInfo
 	for _, candidate := range globMatches {
 		fi, err := os.Lstat(candidate)
 		if err != nil {
@@ -98,75 +120,88 @@ func (b *localStorage) Prune(deadline time.Time, pruningPrefix string) (*storage
 			)
 		}
 
-		if !fi.IsDir() && fi.Mode()&os.ModeSymlink != os.ModeSymlink {
-			candidates = append(candidates, candidate)
+		if fi.IsDir() || fi.Mode()&os.ModeSymlink == os.ModeSymlink {
+			continue
 		}
+		backups = append(backups, storage.BackupInfo{
+			Name:         fi.Name(),
+			Size:         fi.Size(),
+			LastModified: fi.ModTime(),
+		})
 	}
+	return backups, nil
+}
 
-	var matches []string
-	for _, candidate := range candidates {
-		fi, err := os.Stat(candidate)
-		if err != nil {
-			return nil, errwrap.Wrap(
-				err,
-				fmt.Sprintf(
-					"error calling stat on file %s",
-					candidate,
-				),
-			)
-		}
-		if fi.ModTime().Before(deadline) {
-			matches = append(matches, candidate)
-		}
+// Prune rotates away backups according to the configuration and provided retention policy for the local storage backend.
+func (b *localStorage) Prune(policy storage.RetentionPolicy, pruningPrefix string) (*storage.PruneStats, error) {
+	candidates, err := b.List(pruningPrefix)
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error listing backups")
 	}
 
-	stats := &storage.PruneStats{
-		Total:  uint(len(candidates)),
-		Pruned: uint(len(matches)),
+	bases, err := storage.IncrementalBases(b, candidates)
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error reading incremental bases")
+	}
+	prunable, stats := policy.Prunable(candidates, bases)
+	var matches []string
+	for _, candidate := range prunable {
+		matches = append(matches, candidate.Name)
 	}
 
-	pruneErr := b.DoPrune(b.Name(), len(matches), len(candidates), deadline, func() error {
-		var removeErrors []error
-		for _, match := range matches {
-			if err := os.Remove(match); err != nil {
-				removeErrors = append(removeErrors, err)
-			}
-		}
-		if len(removeErrors) != 0 {
-			return errwrap.Wrap(
-				errors.Join(removeErrors...),
-				fmt.Sprintf(
-					"%d error(s) deleting files",
-					len(removeErrors),
-				),
-			)
-		}
-		return nil
+	pruneErr := b.DoPrune(b.Name(), int(stats.Pruned), int(stats.Total), policy, func() error {
+		return b.Remove(matches)
 	})
 
 	return stats, pruneErr
 }
 
-// copy creates a copy of the file located at `dst` at `src`.
-func copyFile(src, dst string) (returnErr error) {
-	in, err := os.Open(src)
+// Remove deletes the files of the given names.
+func (b *localStorage) Remove(names []string) error {
+	var removeErrors []error
+	for _, name := range names {
+		if err := os.Remove(path.Join(b.DestinationPath, name)); err != nil {
+			removeErrors = append(removeErrors, err)
+		}
+	}
+	if len(removeErrors) != 0 {
+		return errwrap.Wrap(
+			errors.Join(removeErrors...),
+			fmt.Sprintf(
+				"%d error(s) deleting files",
+				len(removeErrors),
+			),
+		)
+	}
+	return nil
+}
+
+// Download writes the contents of the backup with the given name to w.
+func (b *localStorage) Download(name string, w io.Writer) (returnErr error) {
+	f, err := os.Open(path.Join(b.DestinationPath, name))
 	if err != nil {
-		returnErr = err
-		return
+		return errwrap.Wrap(err, fmt.Sprintf("error opening backup %s", name))
 	}
 	defer func() {
-		returnErr = errors.Join(returnErr, in.Close())
+		returnErr = errors.Join(returnErr, f.Close())
 	}()
 
+	if _, err := io.Copy(w, f); err != nil {
+		return errwrap.Wrap(err, fmt.Sprintf("error reading backup %s", name))
+	}
+	return nil
+}
+
+// writeFile writes the contents of r to a file at `dst`. In case writing
+// fails, the incomplete file is removed.
+func writeFile(r io.Reader, dst string) error {
 	out, err := os.Create(dst)
 	if err != nil {
-		returnErr = err
-		return
+		return err
 	}
 
-	_, err = io.Copy(out, in)
-	if err != nil {
-		return errors.Join(err, out.Close())
+	if _, err := io.Copy(out, r); err != nil {
+		return errors.Join(err, out.Close(), os.Remove(dst))
 	}
 	return out.Close()
 }
@@ -0,0 +1,243 @@
+// Copyright 2026 - offen.software <hioffen@posteo.de>
+// SPDX-License-Identifier: MPL-2.0
+
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/offen/docker-volume-backup/internal/errwrap"
+)
+
+// RetentionPolicy defines which backups are retained when pruning a storage
+// backend. A backup is retained in case any of the configured rules applies
+// to it, all other backups are pruned.
+type RetentionPolicy struct {
+	// Deadline retains all backups that are not older than the given time.
+	// The zero value disables the rule.
+	Deadline time.Time
+	// KeepLast retains the given number of most recent backups.
+	KeepLast int
+	// KeepDaily, KeepWeekly, KeepMonthly and KeepYearly retain the most recent
+	// backup of each of the given number of most recent days, weeks, months
+	// and years that have backups.
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+	KeepYearly  int
+}
+
+// IncrementalSuffix is appended to the name of an incremental archive for
+// naming the sidecar file that marks it as such. The sidecar file contains
+// the name of the full archive the incremental archive depends on.
+const IncrementalSuffix = ".incremental"
+
+// ChunksSuffix is appended to the name of a repository snapshot for naming
+// the sidecar file that lists all chunks the snapshot references.
+const ChunksSuffix = ".chunks"
+
+// ChunkPrefix is prepended to the names of chunks stored in a repository.
+// Chunks are never considered backups, they are garbage collected once no
+// snapshot references them anymore.
+const ChunkPrefix = "chunk-"
+
+// IsChunk checks whether the given name denotes a repository chunk.
+func IsChunk(name string) bool {
+	return strings.HasPrefix(name, ChunkPrefix)
+}
+
+// SidecarSuffixes lists the suffixes of files that are stored next to an
+// archive and describe it. Such files are not considered backups of their
+// own, but are pruned together with the archive they belong to.
+var SidecarSuffixes = []string{
+	ChecksumSuffix, IncrementalSuffix, ChunksSuffix,
+	".manifest.json", ".manifest.json.asc",
+	".manifest.json.gpg", ".manifest.json.gpg.asc",
+	".manifest.json.age", ".manifest.json.age.asc",
+}
+
+// IsSidecar checks whether the given name denotes a sidecar file.
+func IsSidecar(name string) bool {
+	for _, suffix := range SidecarSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// IncrementalBases reads the incremental sidecar files of the given backups
+// from b and returns the name of the full archive each incremental archive
+// depends on, keyed by the name of the incremental archive.
+func IncrementalBases(b Backend, backups []BackupInfo) (map[string]string, error) {
+	names := map[string]bool{}
+	for _, backup := range backups {
+		names[backup.Name] = true
+	}
+
+	bases := map[string]string{}
+	for _, backup := range backups {
+		archive := strings.TrimSuffix(backup.Name, IncrementalSuffix)
+		if archive == backup.Name || !names[archive] {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := b.Download(backup.Name, &buf); err != nil {
+			return nil, errwrap.Wrap(err, fmt.Sprintf("error downloading %s", backup.Name))
+		}
+		bases[archive] = strings.TrimSpace(buf.String())
+	}
+	return bases, nil
+}
+
+// Prunable returns the given backups that are not retained by the policy.
+// bases maps incremental archives to the full archive they depend on, as
+// returned by IncrementalBases.
+func (p RetentionPolicy) Prunable(backups []BackupInfo, bases map[string]string) ([]BackupInfo, *PruneStats) {
+	return SelectPrunable(p, backups, bases, func(b BackupInfo) BackupInfo {
+		return b
+	})
+}
+
+// SelectPrunable returns the candidates that are not retained by the given
+// policy, including the sidecar files of all archives that are pruned.
+// Full archives are retained as long as any incremental archive that depends
+// on them according to bases is retained. Repository chunks are never
+// selected. Information about a candidate is read using infoOf.
+// The returned stats do not count sidecar files.
+func SelectPrunable[T any](p RetentionPolicy, candidates []T, bases map[string]string, infoOf func(T) BackupInfo) ([]T, *PruneStats) {
+	names := map[string]bool{}
+	for _, candidate := range candidates {
+		names[infoOf(candidate).Name] = true
+	}
+
+	var archives []T
+	sidecars := map[string][]T{}
+outer:
+	for _, candidate := range candidates {
+		name := infoOf(candidate).Name
+		if IsChunk(name) {
+			continue
+		}
+		for _, suffix := range SidecarSuffixes {
+			if archive := strings.TrimSuffix(name, suffix); archive != name && names[archive] {
+				sidecars[archive] = append(sidecars[archive], candidate)
+				continue outer
+			}
+		}
+		archives = append(archives, candidate)
+	}
+
+	sort.SliceStable(archives, func(i, j int) bool {
+		return infoOf(archives[i]).LastModified.After(infoOf(archives[j]).LastModified)
+	})
+
+	buckets := []*retentionBucket{
+		{count: p.KeepDaily, key: func(t time.Time) int {
+			return t.Year()*10000 + int(t.Month())*100 + t.Day()
+		}},
+		{count: p.KeepWeekly, key: func(t time.Time) int {
+			year, week := t.ISOWeek()
+			return year*100 + week
+		}},
+		{count: p.KeepMonthly, key: func(t time.Time) int {
+			return t.Year()*100 + int(t.Month())
+		}},
+		{count: p.KeepYearly, key: func(t time.Time) int {
+			return t.Year()
+		}},
+	}
+
+	keep := make([]bool, len(archives))
+	for i, candidate := range archives {
+		t := infoOf(candidate).LastModified.Local()
+		keep[i] = i < p.KeepLast
+		if !p.Deadline.IsZero() && !t.Before(p.Deadline) {
+			keep[i] = true
+		}
+		for _, b := range buckets {
+			if b.retains(t) {
+				keep[i] = true
+			}
+		}
+	}
+
+	// Each retained incremental archive retains the full archive it
+	// depends on.
+	index := map[string]int{}
+	for i, candidate := range archives {
+		index[infoOf(candidate).Name] = i
+	}
+	for i, candidate := range archives {
+		if base, ok := index[bases[infoOf(candidate).Name]]; ok && keep[i] {
+			keep[base] = true
+		}
+	}
+
+	var prunable []T
+	stats := &PruneStats{Total: uint(len(archives))}
+	for i, candidate := range archives {
+		if !keep[i] {
+			stats.Pruned++
+			prunable = append(prunable, candidate)
+			prunable = append(prunable, sidecars[infoOf(candidate).Name]...)
+		}
+	}
+	return prunable, stats
+}
+
+// retentionBucket retains the most recent backup for each of the first count
+// distinct keys it encounters when being passed backups from newest to oldest.
+type retentionBucket struct {
+	count int
+	key   func(time.Time) int
+	last  *int
+}
+
+func (b *retentionBucket) retains(t time.Time) bool {
+	if b.count <= 0 {
+		return false
+	}
+	key := b.key(t)
+	if b.last != nil && *b.last == key {
+		return false
+	}
+	b.last = &key
+	b.count--
+	return true
+}
+
+// describe returns a human readable description of the reason why backups
+// are pruned by the policy.
+func (p RetentionPolicy) describe() (string, error) {
+	var rules []string
+	if !p.Deadline.IsZero() {
+		formattedDeadline, err := p.Deadline.Local().MarshalText()
+		if err != nil {
+			return "", errwrap.Wrap(err, "error marshaling deadline")
+		}
+		if p == (RetentionPolicy{Deadline: p.Deadline}) {
+			return fmt.Sprintf("were older than the given deadline of %s", formattedDeadline), nil
+		}
+		rules = append(rules, fmt.Sprintf("keep within deadline of %s", formattedDeadline))
+	}
+	for _, rule := range []struct {
+		name  string
+		count int
+	}{
+		{"last", p.KeepLast},
+		{"daily", p.KeepDaily},
+		{"weekly", p.KeepWeekly},
+		{"monthly", p.KeepMonthly},
+		{"yearly", p.KeepYearly},
+	} {
+		if rule.count > 0 {
+			rules = append(rules, fmt.Sprintf("keep %s %d", rule.name, rule.count))
+		}
+	}
+	return fmt.Sprintf("were not retained by the given policy (%s)", strings.Join(rules, ", ")), nil
+}
@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicyPrunable(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.Local)
+	daysAgo := func(days int) time.Time {
+		return now.AddDate(0, 0, -days)
+	}
+	// one backup per day for the last 100 days, newest first
+	var backups []BackupInfo
+	for i := 0; i < 100; i++ {
+		backups = append(backups, BackupInfo{
+			Name:         daysAgo(i).Format("2006-01-02"),
+			LastModified: daysAgo(i),
+		})
+	}
+
+	retained := func(policy RetentionPolicy) []string {
+		pruned := map[string]bool{}
+		prunable, _ := policy.Prunable(backups, nil)
+		for _, b := range prunable {
+			pruned[b.Name] = true
+		}
+		var result []string
+		for _, b := range backups {
+			if !pruned[b.Name] {
+				result = append(result, b.Name)
+			}
+		}
+		return result
+	}
+
+	tests := []struct {
+		name     string
+		policy   RetentionPolicy
+		expected []string
+	}{
+		{
+			"deadline",
+			RetentionPolicy{Deadline: daysAgo(2)},
+			[]string{"2026-10-16", "2026-10-15", "2026-10-14"},
+		},
+		{
+			"keep last",
+			RetentionPolicy{KeepLast: 2},
+			[]string{"2026-10-16", "2026-10-15"},
+		},
+		{
+			"keep weekly",
+			RetentionPolicy{KeepWeekly: 3},
+			[]string{"2026-10-16", "2026-10-11", "2026-10-04"},
+		},
+		{
+			"keep monthly",
+			RetentionPolicy{KeepMonthly: 3},
+			[]string{"2026-10-16", "2026-09-30", "2026-08-31"},
+		},
+		{
+			"keep yearly",
+			RetentionPolicy{KeepYearly: 5},
+			[]string{"2026-10-16"},
+		},
+		{
+			"combined",
+			RetentionPolicy{KeepDaily: 2, KeepMonthly: 2, Deadline: daysAgo(3)},
+			[]string{"2026-10-16", "2026-10-15", "2026-10-14", "2026-10-13", "2026-09-30"},
+		},
+		{
+			"empty policy",
+			RetentionPolicy{},
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := retained(test.policy)
+			if !reflect.DeepEqual(test.expected, result) {
+				t.Errorf("Expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestRetentionPolicyPrunableUnsorted(t *testing.T) {
+	now := time.Now()
+	backups := []BackupInfo{
+		{Name: "middle", LastModified: now.Add(-time.Hour)},
+		{Name: "oldest", LastModified: now.Add(-2 * time.Hour)},
+		{Name: "newest", LastModified: now},
+	}
+	result, _ := RetentionPolicy{KeepLast: 1}.Prunable(backups, nil)
+	if len(result) != 2 || result[0].Name != "middle" || result[1].Name != "oldest" {
+		t.Errorf("Unexpected result %v", result)
+	}
+}
+
+func TestRetentionPolicyPrunableSidecars(t *testing.T) {
+	now := time.Now()
+	backups := []BackupInfo{
+		{Name: "new.tar.gz", LastModified: now},
+		{Name: "new.tar.gz.manifest.json", LastModified: now},
+		{Name: "old.tar.gz", LastModified: now.Add(-time.Hour)},
+		{Name: "old.tar.gz.manifest.json", LastModified: now.Add(-time.Hour)},
+		{Name: "old.tar.gz.manifest.json.asc", LastModified: now.Add(-time.Hour)},
+		{Name: "orphan.tar.gz.manifest.json", LastModified: now.Add(-2 * time.Hour)},
+	}
+	result, stats := RetentionPolicy{KeepLast: 1}.Prunable(backups, nil)
+	var names []string
+	for _, b := range result {
+		names = append(names, b.Name)
+	}
+	expected := []string{"old.tar.gz", "old.tar.gz.manifest.json", "old.tar.gz.manifest.json.asc", "orphan.tar.gz.manifest.json"}
+	if !reflect.DeepEqual(expected, names) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+	if stats.Total != 3 || stats.Pruned != 2 {
+		t.Errorf("Unexpected stats %v", stats)
+	}
+}
+
+func TestRetentionPolicyPrunableIncremental(t *testing.T) {
+	now := time.Now()
+	backups := []BackupInfo{
+		{Name: "full-1", LastModified: now.Add(-5 * time.Hour)},
+		{Name: "incr-1", LastModified: now.Add(-4 * time.Hour)},
+		{Name: "incr-1.incremental", LastModified: now.Add(-4 * time.Hour)},
+		{Name: "full-2", LastModified: now.Add(-3 * time.Hour)},
+		{Name: "incr-2", LastModified: now.Add(-2 * time.Hour)},
+		{Name: "incr-2.incremental", LastModified: now.Add(-2 * time.Hour)},
+		{Name: "incr-3", LastModified: now.Add(-1 * time.Hour)},
+		{Name: "incr-3.incremental", LastModified: now.Add(-1 * time.Hour)},
+	}
+	// incr-3 has been created after full-2, but is still based on full-1,
+	// e.g. because full-2 has been created using a different state file.
+	bases := map[string]string{"incr-1": "full-1", "incr-2": "full-2", "incr-3": "full-1"}
+	result, stats := RetentionPolicy{KeepLast: 1}.Prunable(backups, bases)
+	var names []string
+	for _, b := range result {
+		names = append(names, b.Name)
+	}
+	expected := []string{"incr-2", "incr-2.incremental", "full-2", "incr-1", "incr-1.incremental"}
+	if !reflect.DeepEqual(expected, names) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+	if stats.Total != 5 || stats.Pruned != 3 {
+		t.Errorf("Unexpected stats %v", stats)
+	}
+}
+
+func TestRetentionPolicyPrunableChunks(t *testing.T) {
+	now := time.Now()
+	backups := []BackupInfo{
+		{Name: "chunk-0a1b", LastModified: now.Add(-3 * time.Hour)},
+		{Name: "snapshot-1", LastModified: now.Add(-2 * time.Hour)},
+		{Name: "snapshot-1.chunks", LastModified: now.Add(-2 * time.Hour)},
+		{Name: "snapshot-2", LastModified: now.Add(-1 * time.Hour)},
+		{Name: "snapshot-2.chunks", LastModified: now.Add(-1 * time.Hour)},
+	}
+	result, stats := RetentionPolicy{KeepLast: 1}.Prunable(backups, nil)
+	var names []string
+	for _, b := range result {
+		names = append(names, b.Name)
+	}
+	expected := []string{"snapshot-1", "snapshot-1.chunks"}
+	if !reflect.DeepEqual(expected, names) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+	if stats.Total != 2 || stats.Pruned != 1 {
+		t.Errorf("Unexpected stats %v", stats)
+	}
+}
+
+type downloadBackend struct {
+	Backend
+	files map[string]string
+}
+
+func (b *downloadBackend) Download(name string, w io.Writer) error {
+	_, err := io.WriteString(w, b.files[name])
+	return err
+}
+
+func TestIncrementalBases(t *testing.T) {
+	b := &downloadBackend{files: map[string]string{
+		"incr-1.incremental":   "full-1\n",
+		"orphan-1.incremental": "full-1\n",
+	}}
+	backups := []BackupInfo{
+		{Name: "full-1"},
+		{Name: "incr-1"},
+		{Name: "incr-1.incremental"},
+		{Name: "orphan-1.incremental"},
+	}
+	bases, err := IncrementalBases(b, backups)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if expected := map[string]string{"incr-1": "full-1"}; !reflect.DeepEqual(expected, bases) {
+		t.Errorf("Expected %v, got %v", expected, bases)
+	}
+}
@@ -6,11 +6,13 @@ package s3
 import (
 	"context"
 	"crypto/x509"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path"
-	"time"
+	"strings"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
@@ -102,21 +104,54 @@ func (v *s3Storage) Name() string {
 }
 
 // Copy copies the given file to the S3/Minio storage backend.
-func (b *s3Storage) Copy(file string) error {
+func (b *s3Storage) Copy(file string) (returnErr error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return errwrap.Wrap(err, "error opening the local file")
+	}
+	defer func() {
+		returnErr = errors.Join(returnErr, f.Close())
+	}()
+
+	srcFileInfo, err := f.Stat()
+	if err != nil {
+		return errwrap.Wrap(err, "error reading the local file")
+	}
+
 	_, name := path.Split(file)
+	return b.upload(name, f, srcFileInfo.Size())
+}
+
+// Upload uploads the contents of r to an object of the given name in the
+// S3/Minio storage backend.
+func (b *s3Storage) Upload(name string, r io.Reader) error {
+	// Readers of in-memory data like repository chunks report their size,
+	// which allows uploading them in a single request.
+	if l, ok := r.(interface{ Len() int }); ok {
+		return b.upload(name, r, int64(l.Len()))
+	}
+	return b.upload(name, r, -1)
+}
+
+// defaultStreamingPartSize is used for uploads of unknown size in case no part
+// size has been configured. As S3 allows at most 10.000 parts, this limits the
+// size of streamed backups to roughly 625GiB.
+const defaultStreamingPartSize = 64 * 1024 * 1024
+
+func (b *s3Storage) upload(name string, r io.Reader, size int64) error {
 	putObjectOptions := minio.PutObjectOptions{
 		ContentType:    "application/tar+gzip",
 		StorageClass:   b.storageClass,
 		SendContentMd5: true,
 	}
 
-	if b.partSize > 0 {
-		srcFileInfo, err := os.Stat(file)
-		if err != nil {
-			return errwrap.Wrap(err, "error reading the local file")
-		}
+	configuredPartSize := uint64(b.partSize * 1024 * 1024)
+	if size < 0 && configuredPartSize == 0 {
+		configuredPartSize = defaultStreamingPartSize
+	}
 
-		_, partSize, _, err := minio.OptimalPartInfo(srcFileInfo.Size(), uint64(b.partSize*1024*1024))
+	if configuredPartSize > 0 {
+		_, partSize, _, err := minio.OptimalPartInfo(size, configuredPartSize)
 		if err != nil {
 			return errwrap.Wrap(err, "error computing the optimal s3 part size")
 		}
@@ -124,7 +159,7 @@ func (b *s3Storage) Copy(file string) error {
 		putObjectOptions.PartSize = uint64(partSize)
 	}
 
-	if _, err := b.client.FPutObject(context.Background(), b.bucket, path.Join(b.DestinationPath, name), file, putObjectOptions); err != nil {
+	if _, err := b.client.PutObject(context.Background(), b.bucket, path.Join(b.DestinationPath, name), r, size, putObjectOptions); err != nil {
 		if errResp := minio.ToErrorResponse(err); errResp.Message != "" {
 			return errwrap.Wrap(
 				nil,
@@ -139,58 +174,123 @@ func (b *s3Storage) Copy(file string) error {
 		return errwrap.Wrap(err, "error uploading backup to remote storage")
 	}
 
-	b.Log(storage.LogLevelInfo, b.Name(), "Uploaded a copy of backup `%s` to bucket `%s`.", file, b.bucket)
+	b.Log(storage.LogLevelInfo, b.Name(), "Uploaded a copy of backup `%s` to bucket `%s`.", name, b.bucket)
 
 	return nil
 }
 
-// Prune rotates away backups according to the configuration and provided deadline for the S3/Minio storage backend.
-func (b *s3Storage) Prune(deadline time.Time, pruningPrefix string) (*storage.PruneStats, error) {
+// Verify compares the ETag of the object of the given name with the MD5
+// checksum of the uploaded data. The ETag of objects that have been uploaded
+// in multiple parts or that are encrypted using KMS or customer provided keys
+// is not a plain MD5 checksum and cannot be used.
+func (b *s3Storage) Verify(name string, sums storage.Checksums) (storage.VerifyResult, error) {
+	info, err := b.client.StatObject(context.Background(), b.bucket, path.Join(b.DestinationPath, name), minio.StatObjectOptions{})
+	if err != nil {
+		return storage.ChecksumUnavailable, errwrap.Wrap(err, fmt.Sprintf("error looking up object %s in remote storage", name))
+	}
+	etag := strings.Trim(info.ETag, `"`)
+	if etag == "" || strings.Contains(etag, "-") ||
+		strings.HasPrefix(info.Metadata.Get("X-Amz-Server-Side-Encryption"), "aws:kms") ||
+		info.Metadata.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm") != "" {
+		return storage.ChecksumUnavailable, nil
+	}
+	if !strings.EqualFold(etag, hex.EncodeToString(sums.MD5)) {
+		return storage.ChecksumMismatch, nil
+	}
+	return storage.ChecksumMatch, nil
+}
+
+// List returns information about all backups in the S3/Minio storage backend
+// whose name starts with the given prefix.
+func (b *s3Storage) List(prefix string) ([]storage.BackupInfo, error) {
 	candidates := b.client.ListObjects(context.Background(), b.bucket, minio.ListObjectsOptions{
-		Prefix:    path.Join(b.DestinationPath, pruningPrefix),
+		Prefix:    path.Join(b.DestinationPath, prefix),
 		Recursive: true,
 	})
 
-	var matches []minio.ObjectInfo
-	var lenCandidates int
+	var backups []storage.BackupInfo
 	for candidate := range candidates {
-		lenCandidates++
 		if candidate.Err != nil {
 			return nil, errwrap.Wrap(
 				candidate.Err,
 				"error looking up candidates from remote storage",
 			)
 		}
-		if candidate.LastModified.Before(deadline) {
-			matches = append(matches, candidate)
-		}
+		backups = append(backups, storage.BackupInfo{
+			Name:         b.relativeName(candidate.Key),
+			Size:         candidate.Size,
+			LastModified: candidate.LastModified,
+		})
 	}
+	return backups, nil
+}
 
-	stats := &storage.PruneStats{
-		Total:  uint(lenCandidates),
-		Pruned: uint(len(matches)),
-	}
-
-	pruneErr := b.DoPrune(b.Name(), len(matches), lenCandidates, deadline, func() error {
-		objectsCh := make(chan minio.ObjectInfo)
-		go func() {
-			for _, match := range matches {
-				objectsCh <- match
-			}
-			close(objectsCh)
-		}()
-		errChan := b.client.RemoveObjects(context.Background(), b.bucket, objectsCh, minio.RemoveObjectsOptions{})
-		var removeErrors []error
-		for result := range errChan {
-			if result.Err != nil {
-				removeErrors = append(removeErrors, result.Err)
-			}
-		}
-		if len(removeErrors) != 0 {
-			return errors.Join(removeErrors...)
-		}
-		return nil
+// Prune rotates away backups according to the configuration and provided retention policy for the S3/Minio storage backend.
+func (b *s3Storage) Prune(policy storage.RetentionPolicy, pruningPrefix string) (*storage.PruneStats, error) {
+	candidates, err := b.List(pruningPrefix)
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error listing backups")
+	}
+
+	bases, err := storage.IncrementalBases(b, candidates)
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error reading incremental bases")
+	}
+	prunable, stats := policy.Prunable(candidates, bases)
+	var matches []string
+	for _, candidate := range prunable {
+		matches = append(matches, candidate.Name)
+	}
+
+	pruneErr := b.DoPrune(b.Name(), int(stats.Pruned), int(stats.Total), policy, func() error {
+		return b.Remove(matches)
 	})
 
 	return stats, pruneErr
 }
+
+// Remove deletes the objects of the given names.
+func (b *s3Storage) Remove(names []string) error {
+	objectsCh := make(chan minio.ObjectInfo)
+	go func() {
+		for _, name := range names {
+			objectsCh <- minio.ObjectInfo{Key: path.Join(b.DestinationPath, name)}
+		}
+		close(objectsCh)
+	}()
+	errChan := b.client.RemoveObjects(context.Background(), b.bucket, objectsCh, minio.RemoveObjectsOptions{})
+	var removeErrors []error
+	for result := range errChan {
+		if result.Err != nil {
+			removeErrors = append(removeErrors, result.Err)
+		}
+	}
+	if len(removeErrors) != 0 {
+		return errors.Join(removeErrors...)
+	}
+	return nil
+}
+
+// relativeName strips the remote path from the given object key.
+func (b *s3Storage) relativeName(key string) string {
+	if b.DestinationPath == "" {
+		return key
+	}
+	return strings.TrimPrefix(key, path.Clean(b.DestinationPath)+"/")
+}
+
+// Download writes the contents of the backup with the given name to w.
+func (b *s3Storage) Download(name string, w io.Writer) (returnErr error) {
+	object, err := b.client.GetObject(context.Background(), b.bucket, path.Join(b.DestinationPath, name), minio.GetObjectOptions{})
+	if err != nil {
+		return errwrap.Wrap(err, fmt.Sprintf("error requesting backup %s from remote storage", name))
+	}
+	defer func() {
+		returnErr = errors.Join(returnErr, object.Close())
+	}()
+
+	if _, err := io.Copy(w, object); err != nil {
+		return errwrap.Wrap(err, fmt.Sprintf("error downloading backup %s from remote storage", name))
+	}
+	return nil
+}
@@ -10,7 +10,6 @@ import (
 	"os"
 	"path"
 	"strings"
-	"time"
 
 	"github.com/offen/docker-volume-backup/internal/errwrap"
 	"github.com/offen/docker-volume-backup/internal/storage"
@@ -109,13 +108,7 @@ func (b *sshStorage) Name() string {
 
 // Copy copies the given file to the SSH storage backend.
 func (b *sshStorage) Copy(file string) (returnErr error) {
-	if err := b.sftpClient.MkdirAll(b.DestinationPath); err != nil {
-		returnErr = errwrap.Wrap(err, "error ensuring destination directory")
-		return
-	}
-
 	source, err := os.Open(file)
-	_, name := path.Split(file)
 	if err != nil {
 		returnErr = errwrap.Wrap(err, " error reading the file to be uploaded")
 		return
@@ -130,18 +123,10 @@ func (b *sshStorage) Copy(file string) (returnErr error) {
 		return
 	}
 
-	destination, err := b.sftpClient.Create(path.Join(b.DestinationPath, name))
-	if err != nil {
-		returnErr = errwrap.Wrap(err, "error creating file")
-		return
-	}
-	defer func() {
-		returnErr = errors.Join(returnErr, destination.Close())
-	}()
-
-	written, err := io.Copy(destination, source)
+	_, name := path.Split(file)
+	written, err := b.upload(name, source)
 	if err != nil {
-		returnErr = errwrap.Wrap(err, "error uploading the file")
+		returnErr = err
 		return
 	}
 
@@ -152,53 +137,120 @@ func (b *sshStorage) Copy(file string) (returnErr error) {
 			sourceFileInfo.Size(),
 		)
 
-		returnErr = errwrap.Wrap(err, msg)
+		returnErr = errwrap.Wrap(nil, msg)
 		return
 	}
 
-	b.Log(storage.LogLevelInfo, b.Name(), "Uploaded a copy of backup `%s` to '%s' at path '%s'.", file, b.hostName, b.DestinationPath)
-
 	return nil
 }
 
-// Prune rotates away backups according to the configuration and provided deadline for the SSH storage backend.
-func (b *sshStorage) Prune(deadline time.Time, pruningPrefix string) (*storage.PruneStats, error) {
+// Upload uploads the contents of r to a file of the given name in the SSH
+// storage backend.
+func (b *sshStorage) Upload(name string, r io.Reader) error {
+	_, err := b.upload(name, r)
+	return err
+}
+
+func (b *sshStorage) upload(name string, r io.Reader) (written int64, returnErr error) {
+	if err := b.sftpClient.MkdirAll(b.DestinationPath); err != nil {
+		returnErr = errwrap.Wrap(err, "error ensuring destination directory")
+		return
+	}
+
+	destination, err := b.sftpClient.Create(path.Join(b.DestinationPath, name))
+	if err != nil {
+		returnErr = errwrap.Wrap(err, "error creating file")
+		return
+	}
+	defer func() {
+		returnErr = errors.Join(returnErr, destination.Close())
+	}()
+
+	written, err = io.Copy(destination, r)
+	if err != nil {
+		returnErr = errwrap.Wrap(err, "error uploading the file")
+		return
+	}
+
+	b.Log(storage.LogLevelInfo, b.Name(), "Uploaded a copy of backup `%s` to '%s' at path '%s'.", name, b.hostName, b.DestinationPath)
+
+	return
+}
+
+// List returns information about all backups in the SSH storage backend
+// whose name starts with the given prefix.
+func (b *sshStorage) List(prefix string) ([]storage.BackupInfo, error) {
 	candidates, err := b.sftpClient.ReadDir(b.DestinationPath)
 	if err != nil {
-		// If directory doesn't exist yet, nothing to prune
+		// If directory doesn't exist yet, there are no backups
 		if errors.Is(err, os.ErrNotExist) {
-			return &storage.PruneStats{}, nil
+			return nil, nil
 		}
 		return nil, errwrap.Wrap(err, "error reading directory")
 	}
 
-	var matches []string
-	var numCandidates int
+	var backups []storage.BackupInfo
 	for _, candidate := range candidates {
-		if candidate.IsDir() || !strings.HasPrefix(candidate.Name(), pruningPrefix) {
+		if candidate.IsDir() || !strings.HasPrefix(candidate.Name(), prefix) {
 			continue
 		}
+		backups = append(backups, storage.BackupInfo{
+			Name:         candidate.Name(),
+			Size:         candidate.Size(),
+			LastModified: candidate.ModTime(),
+		})
+	}
+	return backups, nil
+}
 
-		numCandidates++
-		if candidate.ModTime().Before(deadline) {
-			matches = append(matches, candidate.Name())
-		}
+// Prune rotates away backups according to the configuration and provided retention policy for the SSH storage backend.
+func (b *sshStorage) Prune(policy storage.RetentionPolicy, pruningPrefix string) (*storage.PruneStats, error) {
+	candidates, err := b.List(pruningPrefix)
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error listing backups")
 	}
 
-	stats := &storage.PruneStats{
-		Total:  uint(numCandidates),
-		Pruned: uint(len(matches)),
+	bases, err := storage.IncrementalBases(b, candidates)
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error reading incremental bases")
+	}
+	prunable, stats := policy.Prunable(candidates, bases)
+	var matches []string
+	for _, candidate := range prunable {
+		matches = append(matches, candidate.Name)
 	}
 
-	pruneErr := b.DoPrune(b.Name(), len(matches), numCandidates, deadline, func() error {
-		for _, match := range matches {
-			p := path.Join(b.DestinationPath, match)
-			if err := b.sftpClient.Remove(p); err != nil {
-				return errwrap.Wrap(err, fmt.Sprintf("error removing file %s", p))
-			}
-		}
-		return nil
+	pruneErr := b.DoPrune(b.Name(), int(stats.Pruned), int(stats.Total), policy, func() error {
+		return b.Remove(matches)
 	})
 
 	return stats, pruneErr
 }
+
+// Remove deletes the files of the given names.
+func (b *sshStorage) Remove(names []string) error {
+	for _, name := range names {
+		p := path.Join(b.DestinationPath, name)
+		if err := b.sftpClient.Remove(p); err != nil {
+			return errwrap.Wrap(err, fmt.Sprintf("error removing file %s", p))
+		}
+	}
+	return nil
+}
+
+// Download writes the contents of the backup with the given name to w.
+func (b *sshStorage) Download(name string, w io.Writer) (returnErr error) {
+	p := path.Join(b.DestinationPath, name)
+	source, err := b.sftpClient.Open(p)
+	if err != nil {
+		return errwrap.Wrap(err, fmt.Sprintf("error opening file %s", p))
+	}
+	defer func() {
+		returnErr = errors.Join(returnErr, source.Close())
+	}()
+
+	if _, err := io.Copy(w, source); err != nil {
+		return errwrap.Wrap(err, fmt.Sprintf("error downloading file %s", p))
+	}
+	return nil
+}
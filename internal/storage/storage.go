@@ -4,6 +4,7 @@
 package storage
 
 import (
+	"io"
 	"time"
 
 	"github.com/offen/docker-volume-backup/internal/errwrap"
@@ -12,10 +13,38 @@ import (
 // Backend is an interface for defining functions which all storage providers support.
 type Backend interface {
 	Copy(file string) error
-	Prune(deadline time.Time, pruningPrefix string) (*PruneStats, error)
+	Upload(name string, r io.Reader) error
+	Prune(policy RetentionPolicy, pruningPrefix string) (*PruneStats, error)
+	List(prefix string) ([]BackupInfo, error)
+	Download(name string, w io.Writer) error
+	Remove(names []string) error
 	Name() string
 }
 
+// ArchiveUploader is implemented by storage backends that treat uploads of
+// archives differently from uploads of other files like sidecar files.
+type ArchiveUploader interface {
+	UploadArchive(name string, r io.Reader) error
+}
+
+// UploadArchive uploads the archive of the given name to b, using
+// UploadArchive in case b implements ArchiveUploader.
+func UploadArchive(b Backend, name string, r io.Reader) error {
+	if u, ok := b.(ArchiveUploader); ok {
+		return u.UploadArchive(name, r)
+	}
+	return b.Upload(name, r)
+}
+
+// BackupInfo describes a single file that is stored in a backend. Name is
+// relative to the backend's destination path, so it can be passed to
+// Download.
+type BackupInfo struct {
+	Name         string
+	Size         int64
+	LastModified time.Time
+}
+
 // StorageBackend is a generic type of storage. Everything here are common properties of all storage types.
 type StorageBackend struct {
 	DestinationPath string
@@ -39,21 +68,21 @@ type PruneStats struct {
 
 // DoPrune holds general control flow that applies to any kind of storage.
 // Callers can pass in a thunk that performs the actual deletion of files.
-func (b *StorageBackend) DoPrune(context string, lenMatches, lenCandidates int, deadline time.Time, doRemoveFiles func() error) error {
+func (b *StorageBackend) DoPrune(context string, lenMatches, lenCandidates int, policy RetentionPolicy, doRemoveFiles func() error) error {
 	if lenMatches != 0 && lenMatches != lenCandidates {
 		if err := doRemoveFiles(); err != nil {
 			return err
 		}
 
-		formattedDeadline, err := deadline.Local().MarshalText()
+		reason, err := policy.describe()
 		if err != nil {
-			return errwrap.Wrap(err, "error marshaling deadline")
+			return errwrap.Wrap(err, "error describing retention policy")
 		}
 		b.Log(LogLevelInfo, context,
-			"Pruned %d out of %d backups as they were older than the given deadline of %s.",
+			"Pruned %d out of %d backups as they %s.",
 			lenMatches,
 			lenCandidates,
-			string(formattedDeadline),
+			reason,
 		)
 	} else if lenMatches != 0 && lenMatches == lenCandidates {
 		b.Log(LogLevelWarning, context, "The current configuration would delete all %d existing backups.", lenMatches)
@@ -4,13 +4,13 @@
 package webdav
 
 import (
+	"errors"
 	"fmt"
-	"io/fs"
+	"io"
 	"net/http"
 	"os"
 	"path"
 	"strings"
-	"time"
 
 	"github.com/offen/docker-volume-backup/internal/errwrap"
 	"github.com/offen/docker-volume-backup/internal/storage"
@@ -65,56 +65,101 @@ func (b *webDavStorage) Name() string {
 }
 
 // Copy copies the given file to the WebDav storage backend.
-func (b *webDavStorage) Copy(file string) error {
-	_, name := path.Split(file)
-	if err := b.client.MkdirAll(b.DestinationPath, 0644); err != nil {
-		return errwrap.Wrap(err, fmt.Sprintf("error creating directory '%s' on server", b.DestinationPath))
-	}
-
+func (b *webDavStorage) Copy(file string) (returnErr error) {
 	r, err := os.Open(file)
 	if err != nil {
 		return errwrap.Wrap(err, "error opening the file to be uploaded")
 	}
+	defer func() {
+		returnErr = errors.Join(returnErr, r.Close())
+	}()
+
+	_, name := path.Split(file)
+	return b.Upload(name, r)
+}
+
+// Upload uploads the contents of r to a file of the given name in the WebDav
+// storage backend.
+func (b *webDavStorage) Upload(name string, r io.Reader) error {
+	if err := b.client.MkdirAll(b.DestinationPath, 0644); err != nil {
+		return errwrap.Wrap(err, fmt.Sprintf("error creating directory '%s' on server", b.DestinationPath))
+	}
 
 	if err := b.client.WriteStream(path.Join(b.DestinationPath, name), r, 0644); err != nil {
 		return errwrap.Wrap(err, "error uploading the file")
 	}
-	b.Log(storage.LogLevelInfo, b.Name(), "Uploaded a copy of backup '%s' to '%s' at path '%s'.", file, b.url, b.DestinationPath)
+	b.Log(storage.LogLevelInfo, b.Name(), "Uploaded a copy of backup '%s' to '%s' at path '%s'.", name, b.url, b.DestinationPath)
 
 	return nil
 }
 
-// Prune rotates away backups according to the configuration and provided deadline for the WebDav storage backend.
-func (b *webDavStorage) Prune(deadline time.Time, pruningPrefix string) (*storage.PruneStats, error) {
+// List returns information about all backups in the WebDav storage backend
+// whose name starts with the given prefix.
+func (b *webDavStorage) List(prefix string) ([]storage.BackupInfo, error) {
 	candidates, err := b.client.ReadDir(b.DestinationPath)
 	if err != nil {
 		return nil, errwrap.Wrap(err, "error looking up candidates from remote storage")
 	}
 
-	var matches []fs.FileInfo
-	var numCandidates int
+	var backups []storage.BackupInfo
 	for _, candidate := range candidates {
-		if candidate.IsDir() || !strings.HasPrefix(candidate.Name(), pruningPrefix) {
+		if candidate.IsDir() || !strings.HasPrefix(candidate.Name(), prefix) {
 			continue
 		}
-		numCandidates++
-		if candidate.ModTime().Before(deadline) {
-			matches = append(matches, candidate)
-		}
+		backups = append(backups, storage.BackupInfo{
+			Name:         candidate.Name(),
+			Size:         candidate.Size(),
+			LastModified: candidate.ModTime(),
+		})
 	}
+	return backups, nil
+}
 
-	stats := &storage.PruneStats{
-		Total:  uint(numCandidates),
-		Pruned: uint(len(matches)),
+// Prune rotates away backups according to the configuration and provided retention policy for the WebDav storage backend.
+func (b *webDavStorage) Prune(policy storage.RetentionPolicy, pruningPrefix string) (*storage.PruneStats, error) {
+	candidates, err := b.List(pruningPrefix)
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error listing backups")
 	}
 
-	pruneErr := b.DoPrune(b.Name(), len(matches), numCandidates, deadline, func() error {
-		for _, match := range matches {
-			if err := b.client.Remove(path.Join(b.DestinationPath, match.Name())); err != nil {
-				return errwrap.Wrap(err, "error removing file")
-			}
-		}
-		return nil
+	bases, err := storage.IncrementalBases(b, candidates)
+	if err != nil {
+		return nil, errwrap.Wrap(err, "error reading incremental bases")
+	}
+	prunable, stats := policy.Prunable(candidates, bases)
+	var matches []string
+	for _, candidate := range prunable {
+		matches = append(matches, candidate.Name)
+	}
+
+	pruneErr := b.DoPrune(b.Name(), int(stats.Pruned), int(stats.Total), policy, func() error {
+		return b.Remove(matches)
 	})
 	return stats, pruneErr
 }
+
+// Remove deletes the files of the given names.
+func (b *webDavStorage) Remove(names []string) error {
+	for _, name := range names {
+		if err := b.client.Remove(path.Join(b.DestinationPath, name)); err != nil {
+			return errwrap.Wrap(err, "error removing file")
+		}
+	}
+	return nil
+}
+
+// Download writes the contents of the backup with the given name to w.
+func (b *webDavStorage) Download(name string, w io.Writer) (returnErr error) {
+	r, err := b.client.ReadStream(path.Join(b.DestinationPath, name))
+	if err != nil {
+		return errwrap.Wrap(err, fmt.Sprintf("error requesting backup %s from server", name))
+	}
+	defer func() {
+		returnErr = errors.Join(returnErr, r.Close())
+	}()
+
+	if _, err := io.Copy(w, r); err != nil {
+		return errwrap.Wrap(err, fmt.Sprintf("error downloading backup %s from server", name))
+	}
+	return nil
+}
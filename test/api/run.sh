@@ -0,0 +1,69 @@
+#!/bin/sh
+
+set -e
+
+cd "$(dirname "$0")"
+. ../util.sh
+current_test=$(basename $(pwd))
+
+export LOCAL_DIR=$(mktemp -d)
+
+docker compose up -d --quiet-pull
+sleep 5
+
+api () {
+  docker compose exec -T backup wget -qO- --header "Authorization: Bearer test-token" "$@"
+}
+
+if docker compose exec -T backup wget -qO- http://localhost:8080/schedules; then
+  fail "Expected request without token to be rejected."
+fi
+pass "Request without token has been rejected."
+
+schedules=$(api http://localhost:8080/schedules)
+if ! echo "$schedules" | grep -q '"source":"01backup.env"'; then
+  fail "Could not find schedule: $schedules"
+fi
+pass "Schedules have been listed."
+
+api --post-data "" http://localhost:8080/backups/01backup.env
+sleep 5
+
+if [ ! -f "$LOCAL_DIR/api.tar.gz" ]; then
+  fail "Could not find archive created by triggered backup."
+fi
+pass "Triggered backup has created archive."
+
+job=$(api http://localhost:8080/jobs/latest)
+if ! echo "$job" | grep -q '"status":"succeeded"'; then
+  fail "Unexpected status of latest job: $job"
+fi
+if ! api http://localhost:8080/jobs/latest/log | grep -q "Created backup of"; then
+  fail "Could not find log output of latest job."
+fi
+pass "Status and log of latest job have been reported."
+
+cat > ./02backup.env <<EOT
+BACKUP_CRON_EXPRESSION="invalid"
+EOT
+docker compose cp ./02backup.env backup:/etc/dockervolumebackup/conf.d/02backup.env
+if api --post-data "" http://localhost:8080/reload; then
+  fail "Expected reloading an invalid configuration to fail."
+fi
+expect_running_containers "2"
+if ! api http://localhost:8080/schedules | grep -q '"source":"01backup.env"'; then
+  fail "Previous schedules have not been kept."
+fi
+pass "Previous schedules have been kept after reloading an invalid configuration."
+
+cat > ./02backup.env <<EOT
+BACKUP_CRON_EXPRESSION="0 0 5 31 2 ?"
+EOT
+docker compose cp ./02backup.env backup:/etc/dockervolumebackup/conf.d/02backup.env
+rm ./02backup.env
+api --post-data "" http://localhost:8080/reload
+
+if ! api http://localhost:8080/schedules | grep -q '"source":"02backup.env"'; then
+  fail "Configuration has not been reloaded."
+fi
+pass "Configuration has been reloaded."
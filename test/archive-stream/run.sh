@@ -0,0 +1,28 @@
+#!/bin/sh
+
+set -e
+
+cd "$(dirname "$0")"
+. ../util.sh
+current_test=$(basename $(pwd))
+
+export LOCAL_DIR=$(mktemp -d)
+
+docker compose up -d --quiet-pull
+sleep 5
+
+docker compose exec -T backup backup
+
+expect_running_containers "2"
+
+TMP_DIR=$(mktemp -d)
+tar -xf "$LOCAL_DIR/test.tar.gz" -C $TMP_DIR
+if [ "$(wc -c < "$TMP_DIR/backup/exports/random.bin")" != "268435456" ]; then
+  fail "Could not find streamed output in untared archive."
+fi
+pass "Found streamed output in untared archive."
+
+if [ -n "$(docker compose exec -T backup find /spool -name 'docker-volume-backup-output-*')" ]; then
+  fail "Temporary file has not been removed."
+fi
+pass "Temporary file has been removed."
@@ -0,0 +1,44 @@
+#!/bin/sh
+
+set -e
+
+cd "$(dirname "$0")"
+. ../util.sh
+current_test=$(basename $(pwd))
+
+export LOCAL_DIR=$(mktemp -d)
+
+docker compose up -d --quiet-pull
+sleep 5
+
+docker run --rm -v discover_other_data:/data alpine:3 ash -c 'echo "other" > /data/other.txt'
+
+docker compose exec backup backup
+
+expect_running_containers "2"
+
+TMP_DIR=$(mktemp -d)
+tar -xf "$LOCAL_DIR/test.tar.gz" -C $TMP_DIR
+
+if [ ! -f "$TMP_DIR/backup/discover_app_data/offen.db" ]; then
+  fail "Could not find volume of labeled container in archive."
+fi
+pass "Found volume of labeled container in archive."
+
+if [ "$(cat "$TMP_DIR/backup/discover_other_data/other.txt")" != "other" ]; then
+  fail "Could not find labeled volume in archive."
+fi
+pass "Found labeled volume in archive."
+
+if [ "$(docker ps -a -q --filter volume=discover_other_data | wc -l)" != "0" ]; then
+  fail "Helper container has not been removed."
+fi
+pass "Helper container has been removed."
+
+if [ "$(docker compose exec backup ls -A /backup)" != "" ]; then
+  fail "Volumes have been copied to /backup."
+fi
+if docker compose exec backup test -e /tmp/backup; then
+  fail "Copies of volumes have not been removed."
+fi
+pass "Copies of volumes have been removed."
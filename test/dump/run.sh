@@ -0,0 +1,40 @@
+#!/bin/sh
+
+set -e
+
+cd "$(dirname "$0")"
+. ../util.sh
+current_test=$(basename $(pwd))
+
+export LOCAL_DIR=$(mktemp -d)
+
+docker compose up -d --quiet-pull
+sleep 10
+
+docker compose exec -T db psql -U postgres -c "CREATE TABLE dumped (id int); INSERT INTO dumped VALUES (42);"
+
+docker compose exec -T -e EXEC_LABEL=db backup backup
+
+expect_running_containers "3"
+
+TMP_DIR=$(mktemp -d)
+tar -xf "$LOCAL_DIR/test.tar.gz" -C $TMP_DIR
+if ! grep -q "CREATE TABLE public.dumped" "$TMP_DIR/backup/dump-db-1.sql"; then
+  fail "Could not find dump in untared archive."
+fi
+pass "Found dump in untared archive."
+
+if [ -f "$TMP_DIR/backup/dump-broken-1.sql" ]; then
+  fail "Found dump of container that is not eligible."
+fi
+pass "Dump respects exec label."
+
+exit_code=0
+output=$(docker compose exec -T -e EXEC_LABEL=broken backup backup 2>&1) || exit_code=$?
+if [ "$exit_code" = "0" ]; then
+  fail "Backup succeeded although dump command failed."
+fi
+if ! echo "$output" | grep -q "error capturing postgres database of container dump-broken-1"; then
+  fail "Failing dump has not been reported: $output"
+fi
+pass "Failing dump command failed the backup."
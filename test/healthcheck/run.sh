@@ -0,0 +1,35 @@
+#!/bin/sh
+
+set -e
+
+cd "$(dirname "$0")"
+. ../util.sh
+current_test=$(basename $(pwd))
+
+export LOCAL_DIR=$(mktemp -d)
+
+docker compose up -d --quiet-pull
+sleep 5
+
+exit_code=0
+output=$(docker compose exec -T backup backup 2>&1) || exit_code=$?
+if [ "$exit_code" = "0" ]; then
+  fail "Backup succeeded although container did not become healthy."
+fi
+
+expect_running_containers "2"
+
+if ! echo "$output" | grep -q "did not become healthy within 15s"; then
+  fail "Unhealthy container has not been reported: $output"
+fi
+pass "Unhealthy container has been reported and the run failed."
+
+if echo "$output" | grep "did not become healthy" | grep -q "job"; then
+  fail "Container without healthcheck has been reported: $output"
+fi
+pass "Container without healthcheck has not been waited for."
+
+if [ ! -f "$LOCAL_DIR/test.tar.gz" ]; then
+  fail "Could not find archive."
+fi
+pass "Archive has been created."
@@ -0,0 +1,67 @@
+#!/bin/sh
+
+set -e
+
+cd "$(dirname "$0")"
+. ../util.sh
+current_test=$(basename $(pwd))
+
+export LOCAL_DIR=$(mktemp -d)
+export DATA_DIR=$(mktemp -d)
+
+echo "unchanged" > "$DATA_DIR/unchanged.txt"
+echo "original" > "$DATA_DIR/changed.txt"
+echo "deleted" > "$DATA_DIR/deleted.txt"
+
+docker compose up -d --quiet-pull
+sleep 5
+
+docker compose exec backup backup
+
+sleep 1
+echo "changed" > "$DATA_DIR/changed.txt"
+rm "$DATA_DIR/deleted.txt"
+
+docker compose exec backup backup
+
+if [ "$(find "$LOCAL_DIR" -name '*.incremental' | wc -l)" != "1" ]; then
+  fail "Expected exactly one incremental backup."
+fi
+incremental=$(find "$LOCAL_DIR" -name '*.incremental')
+archive=$(basename "${incremental%.incremental}")
+full=$(cat "$incremental")
+pass "Found incremental backup $archive based on $full."
+
+contents=$(tar -tzf "$LOCAL_DIR/$archive")
+if ! echo "$contents" | grep -q "changed.txt"; then
+  fail "Incremental backup does not contain changed file."
+fi
+if echo "$contents" | grep -q "unchanged.txt"; then
+  fail "Incremental backup contains unchanged file."
+fi
+pass "Incremental backup only contains changed files."
+
+docker compose exec backup backup restore -target /tmp/restore "$full"
+docker compose exec backup backup restore -target /tmp/restore "$archive"
+
+if [ "$(docker compose exec -T backup cat /tmp/restore/backup/data/changed.txt)" != "changed" ]; then
+  fail "Changed file has not been restored."
+fi
+if docker compose exec -T backup test -e /tmp/restore/backup/data/deleted.txt; then
+  fail "Deleted file has been restored."
+fi
+if [ "$(docker compose exec -T backup cat /tmp/restore/backup/data/unchanged.txt)" != "unchanged" ]; then
+  fail "Unchanged file has not been restored."
+fi
+pass "Restoring full and incremental backup yields the current state."
+
+tar_dir=$(mktemp -d)
+tar --listed-incremental=/dev/null -xzf "$LOCAL_DIR/$full" -C "$tar_dir"
+tar --listed-incremental=/dev/null -xzf "$LOCAL_DIR/$archive" -C "$tar_dir"
+if [ -e "$tar_dir/backup/data/deleted.txt" ]; then
+  fail "Deleted file has been restored using GNU tar."
+fi
+if [ "$(cat "$tar_dir/backup/data/unchanged.txt")" != "unchanged" ]; then
+  fail "Unchanged file has not been restored using GNU tar."
+fi
+pass "Restoring full and incremental backup using GNU tar yields the current state."
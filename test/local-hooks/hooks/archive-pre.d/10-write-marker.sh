@@ -0,0 +1,4 @@
+#!/bin/sh
+
+echo "$COMMAND_RUNTIME_EVENT" > /backup/app_data/marker.txt
+echo "Wrote marker for $COMMAND_RUNTIME_ARCHIVE_FILEPATH"
@@ -0,0 +1,3 @@
+#!/bin/sh
+
+test -f /backup/app_data/marker.txt
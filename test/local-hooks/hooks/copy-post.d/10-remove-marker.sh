@@ -0,0 +1,3 @@
+#!/bin/sh
+
+rm /backup/app_data/marker.txt
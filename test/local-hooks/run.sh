@@ -0,0 +1,31 @@
+#!/bin/sh
+
+set -e
+
+cd "$(dirname "$0")"
+. ../util.sh
+current_test=$(basename $(pwd))
+
+export LOCAL_DIR=$(mktemp -d)
+
+docker compose up -d --quiet-pull
+sleep 5
+
+output=$(docker compose exec -T backup backup 2>&1)
+
+if ! echo "$output" | grep -q "Wrote marker for /tmp/test.tar.gz"; then
+  fail "Output of hook has not been logged: $output"
+fi
+pass "Output of hook has been logged."
+
+TMP_DIR=$(mktemp -d)
+tar -xf "$LOCAL_DIR/test.tar.gz" -C $TMP_DIR
+if [ "$(cat "$TMP_DIR/backup/app_data/marker.txt")" != "archive-pre" ]; then
+  fail "Could not find file written by hook in untared archive."
+fi
+pass "Found file written by hook in untared archive."
+
+if docker compose exec -T backup test -f /backup/app_data/marker.txt; then
+  fail "Post hook has not been run."
+fi
+pass "Post hook has been run."
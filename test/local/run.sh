@@ -36,6 +36,10 @@ pass "Found relevant files in decrypted and untared local backup."
 if [ ! -L "$LOCAL_DIR/test-hostnametoken.latest.tar.gz.gpg" ]; then
   fail "Could not find symlink to latest version."
 fi
+latest=$(readlink "$LOCAL_DIR/test-hostnametoken.latest.tar.gz.gpg")
+if [ "$latest" != "test-hostnametoken.tar.gz" ]; then
+  fail "Symlink to latest version points to $latest."
+fi
 
 pass "Found symlink to latest version in local backup."
 
@@ -46,7 +50,7 @@ sleep 5
 
 docker compose exec backup backup
 
-if [ "$(find "$LOCAL_DIR" -type f | wc -l)" != "1" ]; then
+if [ "$(find "$LOCAL_DIR" -type f -name "*.tar.gz" | wc -l)" != "1" ]; then
   fail "Backups should not have been deleted, instead seen: "$(find "$local_dir" -type f)""
 fi
 pass "Local backups have not been deleted."
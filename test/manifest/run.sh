@@ -0,0 +1,62 @@
+#!/bin/sh
+
+set -e
+
+cd "$(dirname "$0")"
+. ../util.sh
+current_test=$(basename $(pwd))
+
+export LOCAL_DIR=$(mktemp -d)
+
+export KEY_DIR=$(mktemp -d)
+
+export PASSPHRASE="test"
+
+export GNUPGHOME=$(mktemp -d)
+
+gpg --batch --gen-key <<EOK
+Key-Type: RSA
+Key-Length: 4096
+Name-Real: offen
+Name-Email: docker-volume-backup@local
+Expire-Date: 0
+Passphrase: $PASSPHRASE
+%commit
+EOK
+
+gpg --export-secret-keys --armor --batch --yes --pinentry-mode loopback --passphrase $PASSPHRASE --output $KEY_DIR/private_key.asc
+
+docker compose up -d --quiet-pull
+sleep 5
+
+docker compose exec backup backup
+
+expect_running_containers "2"
+
+if [ ! -f "$LOCAL_DIR/test.tar.gz.manifest.json" ]; then
+  fail "Could not find manifest next to archive."
+fi
+pass "Found manifest next to archive."
+
+if [ "$(jq -r '.archive' "$LOCAL_DIR/test.tar.gz.manifest.json")" != "test.tar.gz" ]; then
+  fail "Manifest does not reference the archive."
+fi
+
+TMP_DIR=$(mktemp -d)
+tar -xf "$LOCAL_DIR/test.tar.gz" -C $TMP_DIR
+
+expected_sum=$(sha256sum "$TMP_DIR/backup/app_data/offen.db" | cut -d ' ' -f 1)
+manifest_sum=$(jq -r '.files[] | select(.path == "/backup/app_data/offen.db") | .sha256' "$LOCAL_DIR/test.tar.gz.manifest.json")
+if [ "$expected_sum" != "$manifest_sum" ]; then
+  fail "Manifest hash $manifest_sum does not match archived file hash $expected_sum."
+fi
+pass "Manifest lists hashes of archived files."
+
+gpg --verify "$LOCAL_DIR/test.tar.gz.manifest.json.asc" "$LOCAL_DIR/test.tar.gz.manifest.json"
+pass "Manifest signature is valid."
+
+(cd "$LOCAL_DIR" && sha256sum -c test.tar.gz.sha256)
+pass "Checksum sidecar matches archive."
+
+docker compose exec backup backup verify -latest
+pass "Latest backup could be verified against its manifest."
@@ -0,0 +1,31 @@
+#!/bin/sh
+
+set -e
+
+cd "$(dirname "$0")"
+. ../util.sh
+current_test=$(basename $(pwd))
+
+export LOCAL_DIR=$(mktemp -d)
+
+docker compose up -d --quiet-pull
+sleep 5
+
+other_started=$(docker inspect --format '{{ .State.StartedAt }}' "$(docker compose ps -q other)")
+offen_started=$(docker inspect --format '{{ .State.StartedAt }}' "$(docker compose ps -q offen)")
+
+output=$(docker compose exec -T backup backup 2>&1)
+
+expect_running_containers "3"
+
+if ! echo "$output" | grep -q "1 out of 2 labeled container(s)"; then
+  fail "Unexpected set of containers to stop: $output"
+fi
+
+if [ "$(docker inspect --format '{{ .State.StartedAt }}' "$(docker compose ps -q offen)")" = "$offen_started" ]; then
+  fail "Container using the backed up volume has not been restarted."
+fi
+if [ "$(docker inspect --format '{{ .State.StartedAt }}' "$(docker compose ps -q other)")" != "$other_started" ]; then
+  fail "Container not using the backed up volume has been restarted."
+fi
+pass "Only the container using the backed up volume has been stopped."
@@ -0,0 +1,25 @@
+#!/bin/sh
+
+set -e
+
+cd "$(dirname "$0")"
+. ../util.sh
+current_test=$(basename $(pwd))
+
+export LOCAL_DIR=$(mktemp -d)
+
+docker compose up -d --quiet-pull
+sleep 15
+
+metrics=$(docker compose exec -T backup wget -qO- http://localhost:9090/metrics)
+
+if ! echo "$metrics" | grep -q 'docker_volume_backup_last_run_success{source="env"} 1'; then
+  fail "Could not find successful run in metrics: $metrics"
+fi
+if echo "$metrics" | grep -q 'docker_volume_backup_runs_total{source="env"} 0'; then
+  fail "Runs have not been counted: $metrics"
+fi
+if echo "$metrics" | grep -q 'docker_volume_backup_last_run_archive_size_bytes{source="env"} 0'; then
+  fail "Archive size has not been reported: $metrics"
+fi
+pass "Metrics have been exposed."
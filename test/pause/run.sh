@@ -0,0 +1,36 @@
+#!/bin/sh
+
+set -e
+
+cd "$(dirname "$0")"
+. ../util.sh
+current_test=$(basename $(pwd))
+
+export LOCAL_DIR=$(mktemp -d)
+
+docker compose up -d --quiet-pull
+sleep 5
+
+offen_started=$(docker inspect --format '{{ .State.StartedAt }}' "$(docker compose ps -q offen)")
+
+output=$(docker compose exec -T backup backup 2>&1)
+
+expect_running_containers "2"
+
+if ! echo "$output" | grep -q "Unpaused 1 out of 1 paused container(s)"; then
+  fail "Container has not been paused and unpaused: $output"
+fi
+if [ "$(docker inspect --format '{{ .State.StartedAt }}' "$(docker compose ps -q offen)")" != "$offen_started" ]; then
+  fail "Paused container has been restarted."
+fi
+if [ "$(docker inspect --format '{{ .State.Status }}' "$(docker compose ps -q offen)")" != "running" ]; then
+  fail "Paused container is not running."
+fi
+pass "Container has been paused instead of stopped."
+
+TMP_DIR=$(mktemp -d)
+tar -xf "$LOCAL_DIR/test.tar.gz" -C $TMP_DIR
+if [ ! -f "$TMP_DIR/backup/app_data/offen.db" ]; then
+  fail "Could not find expected file in untared archive."
+fi
+pass "Found relevant files in untared archive."
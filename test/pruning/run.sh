@@ -70,3 +70,23 @@ docker run --rm \
   ash -c 'test -f /minio_data/backup/test-hostnametoken-old.tar.gz'
 
 pass "Skipped all backends while pruning."
+
+# Keep the most recent backups regardless of their age
+
+touch -r "$LOCAL_DIR/test-hostnametoken.tar.gz" -d "14 days ago" "$LOCAL_DIR/test-hostnametoken-old.tar.gz"
+touch -r "$LOCAL_DIR/test-hostnametoken.tar.gz" -d "21 days ago" "$LOCAL_DIR/test-hostnametoken-older.tar.gz"
+
+info "Create backup keeping the two most recent backups"
+docker compose exec -e BACKUP_RETENTION_COUNT="2" backup backup
+
+info "Check if the most recent expired backup has NOT been pruned (local)"
+if [ ! -f "$LOCAL_DIR/test-hostnametoken-old.tar.gz" ]; then
+  fail "Most recent expired backup has been pruned."
+fi
+
+info "Check if older expired backup has been pruned (local)"
+if [ -f "$LOCAL_DIR/test-hostnametoken-older.tar.gz" ]; then
+  fail "Older expired backup has not been pruned."
+fi
+
+pass "Kept the most recent backups regardless of their age."
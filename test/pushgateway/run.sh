@@ -0,0 +1,29 @@
+#!/bin/sh
+
+set -e
+
+cd "$(dirname "$0")"
+. ../util.sh
+current_test=$(basename $(pwd))
+
+export LOCAL_DIR=$(mktemp -d)
+export TEXTFILE_DIR=$(mktemp -d)
+
+docker compose up -d --quiet-pull
+sleep 5
+
+docker compose exec -T backup backup
+
+metrics=$(docker compose exec -T backup wget -qO- http://pushgateway:9091/metrics)
+if ! echo "$metrics" | grep -q 'docker_volume_backup_last_run_success{instance="",job="docker-volume-backup",source="env"} 1'; then
+  fail "Could not find pushed metrics: $metrics"
+fi
+if ! echo "$metrics" | grep -q 'docker_volume_backup_last_run_uploaded_bytes{backend="Local"'; then
+  fail "Could not find upload metrics: $metrics"
+fi
+pass "Metrics have been pushed."
+
+if ! grep -q 'docker_volume_backup_last_run_success{source="env"} 1' "$TEXTFILE_DIR/docker_volume_backup_env.prom"; then
+  fail "Could not find metrics in textfile."
+fi
+pass "Metrics have been written to textfile."
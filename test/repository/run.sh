@@ -0,0 +1,67 @@
+#!/bin/sh
+
+set -e
+
+cd "$(dirname "$0")"
+. ../util.sh
+current_test=$(basename $(pwd))
+
+export LOCAL_DIR=$(mktemp -d)
+export DATA_DIR=$(mktemp -d)
+
+head -c 4194304 /dev/urandom > "$DATA_DIR/large.bin"
+echo "small" > "$DATA_DIR/small.txt"
+
+docker compose up -d --quiet-pull
+sleep 5
+
+docker compose exec backup backup
+
+chunks=$(find "$LOCAL_DIR" -name 'chunk-*' | wc -l)
+if [ "$chunks" = "0" ]; then
+  fail "Expected chunks to be stored."
+fi
+pass "Found $chunks chunks after first run."
+
+docker compose exec backup backup
+
+if [ "$(find "$LOCAL_DIR" -name '*.snapshot.gz' | wc -l)" != "2" ]; then
+  fail "Expected two snapshots."
+fi
+if [ "$(find "$LOCAL_DIR" -name 'chunk-*' | wc -l)" != "$chunks" ]; then
+  fail "Expected unchanged data not to store any additional chunks."
+fi
+pass "Unchanged data has been deduplicated."
+
+# Backdating the existing snapshots makes the next run prune them, so the
+# chunks of the replaced file are not referenced anymore.
+for snapshot in $(find "$LOCAL_DIR" -name '*.snapshot.gz'); do
+  touch -d "14 days ago" "$snapshot"
+done
+head -c 4194304 /dev/urandom > "$DATA_DIR/large.bin"
+
+docker compose exec backup backup
+
+if [ "$(find "$LOCAL_DIR" -name '*.snapshot.gz' | wc -l)" != "1" ]; then
+  fail "Expected outdated snapshots to be pruned."
+fi
+snapshot=$(basename "$(find "$LOCAL_DIR" -name '*.snapshot.gz')")
+if [ "$(find "$LOCAL_DIR" -name 'chunk-*' | wc -l)" != "$(wc -l < "$LOCAL_DIR/$snapshot.chunks")" ]; then
+  fail "Expected unreferenced chunks to be removed."
+fi
+pass "Unreferenced chunks have been removed."
+
+docker compose exec backup backup restore -target /tmp/restore "$snapshot"
+
+expected=$(sha256sum "$DATA_DIR/large.bin" | cut -d ' ' -f 1)
+actual=$(docker compose exec -T backup sha256sum /tmp/restore/backup/data/large.bin | cut -d ' ' -f 1)
+if [ "$expected" != "$actual" ]; then
+  fail "Restored file does not match: expected $expected, got $actual."
+fi
+if [ "$(docker compose exec -T backup cat /tmp/restore/backup/data/small.txt)" != "small" ]; then
+  fail "Small file has not been restored."
+fi
+pass "Restoring the snapshot yields the current state."
+
+docker compose exec backup backup verify -latest
+pass "Snapshot has been verified."
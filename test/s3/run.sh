@@ -32,7 +32,7 @@ docker compose exec backup backup
 docker run --rm \
   -v minio_backup_data:/minio_data \
   alpine \
-  ash -c '[ $(find /minio_data/backup/ -type f | wc -l) = "1" ]'
+  ash -c '[ $(find /minio_data/backup/ -type f -name "*.tar.gz" | wc -l) = "1" ]'
 
 pass "Remote backups have not been deleted."
 
@@ -0,0 +1,42 @@
+#!/bin/sh
+
+set -e
+
+cd "$(dirname "$0")"
+. ../util.sh
+current_test=$(basename $(pwd))
+
+export LOCAL_DIR=$(mktemp -d)
+
+docker compose up -d --quiet-pull
+sleep 5
+
+docker compose exec backup backup
+
+expect_running_containers "3"
+
+if [ "$(find "$LOCAL_DIR" -name 'backup-app_data-*.tar.gz' | wc -l)" != "1" ]; then
+  fail "Could not find archive of app_data."
+fi
+if [ "$(find "$LOCAL_DIR" -name 'backup-other_data-*.tar.gz' | wc -l)" != "1" ]; then
+  fail "Could not find archive of other_data."
+fi
+pass "Found one archive per directory."
+
+TMP_DIR=$(mktemp -d)
+tar -xf "$LOCAL_DIR"/backup-other_data-*.tar.gz -C $TMP_DIR
+if [ ! -f "$TMP_DIR/backup/other_data/other.txt" ]; then
+  fail "Could not find expected file in archive of other_data."
+fi
+if [ -d "$TMP_DIR/backup/app_data" ]; then
+  fail "Archive of other_data contains app_data."
+fi
+pass "Archive only contains files of its directory."
+
+sleep 2
+docker compose exec backup backup
+
+if [ "$(find "$LOCAL_DIR" -name 'backup-*-*.tar.gz' | wc -l)" != "2" ]; then
+  fail "Expected the last archive of each directory to be retained, found: $(ls $LOCAL_DIR)"
+fi
+pass "Pruned archives of each directory separately."
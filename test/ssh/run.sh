@@ -36,7 +36,7 @@ docker compose exec backup backup
 docker run --rm \
   -v ssh_backup_data:/ssh_data \
   alpine \
-  ash -c '[ $(find /ssh_data/ -type f | wc -l) = "1" ]'
+  ash -c '[ $(find /ssh_data/ -type f -name "*.tar.gz" | wc -l) = "1" ]'
 
 pass "Remote backups have not been deleted."
 
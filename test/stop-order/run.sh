@@ -0,0 +1,38 @@
+#!/bin/sh
+
+set -e
+
+cd "$(dirname "$0")"
+. ../util.sh
+current_test=$(basename $(pwd))
+
+export LOCAL_DIR=$(mktemp -d)
+
+docker compose up -d --quiet-pull
+sleep 10
+
+output=$(docker compose exec -T backup backup 2>&1)
+
+expect_running_containers "3"
+
+if ! echo "$output" | grep -q "Stopping containers in 2 groups ordered by priority"; then
+  fail "Containers have not been stopped in order: $output"
+fi
+pass "Containers have been stopped in order."
+
+offen_started=$(docker inspect --format '{{ .State.StartedAt }}' "$(docker compose ps -q offen)")
+db_started=$(docker inspect --format '{{ .State.StartedAt }}' "$(docker compose ps -q db)")
+if [ "$(date -d "$offen_started" +%s%N)" -le "$(date -d "$db_started" +%s%N)" ]; then
+  fail "Dependent container has been restarted before its dependency: $offen_started, $db_started"
+fi
+if [ "$(docker inspect --format '{{ .State.Health.Status }}' "$(docker compose ps -q db)")" != "healthy" ]; then
+  fail "Dependency is not healthy."
+fi
+pass "Containers have been restarted in reverse order."
+
+TMP_DIR=$(mktemp -d)
+tar -xf "$LOCAL_DIR/test.tar.gz" -C $TMP_DIR
+if [ ! -f "$TMP_DIR/backup/app_data/offen.db" ]; then
+  fail "Could not find expected file in untared archive."
+fi
+pass "Found relevant files in untared archive."
@@ -0,0 +1,51 @@
+#!/bin/sh
+
+set -e
+
+cd "$(dirname "$0")"
+. ../util.sh
+current_test=$(basename $(pwd))
+
+export LOCAL_DIR=$(mktemp -d)
+
+docker compose up -d --quiet-pull
+sleep 5
+
+output=$(docker compose exec -T backup backup 2>&1)
+
+sleep 5
+
+expect_running_containers "3"
+
+# Staged files are removed once the run has finished, so the log output is
+# checked for the steps that create or remove them instead.
+if ! echo "$output" | grep -q "Streamed backup of"; then
+  fail "Archive has not been streamed: $output"
+fi
+if echo "$output" | grep -q -e "Removed tar file" -e "Removed encrypted file"; then
+  fail "Archive has been staged on disk: $output"
+fi
+pass "Archive has not been staged on disk."
+
+TMP_DIR=$(mktemp -d)
+
+echo "1234#\$ecret" | gpg -d --pinentry-mode loopback --yes --passphrase-fd 0 "$LOCAL_DIR/test.tar.gz.gpg" > "$LOCAL_DIR/decrypted.tar.gz"
+tar -xf "$LOCAL_DIR/decrypted.tar.gz" -C $TMP_DIR
+
+if [ ! -f $TMP_DIR/backup/app_data/offen.db ]; then
+  fail "Could not find expected file in untared archive."
+fi
+rm "$LOCAL_DIR/decrypted.tar.gz"
+
+pass "Found relevant files in decrypted and untared local backup."
+
+local_sum=$(sha256sum "$LOCAL_DIR/test.tar.gz.gpg" | cut -d ' ' -f 1)
+remote_sum=$(docker run --rm \
+  -v minio_backup_data:/minio_data \
+  alpine \
+  ash -c 'sha256sum /minio_data/backup/test.tar.gz.gpg' | cut -d ' ' -f 1)
+
+if [ "$local_sum" != "$remote_sum" ]; then
+  fail "Remote backup does not match local backup."
+fi
+pass "Remote backup matches local backup."
@@ -32,7 +32,7 @@ docker compose exec backup backup
 docker run --rm \
   -v webdav_backup_data:/webdav_data \
   alpine \
-  ash -c '[ $(find /webdav_data/data/my/new/path/ -type f | wc -l) = "1" ]'
+  ash -c '[ $(find /webdav_data/data/my/new/path/ -type f -name "*.tar.gz" | wc -l) = "1" ]'
 
 pass "Remote backups have not been deleted."
 
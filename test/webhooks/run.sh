@@ -0,0 +1,44 @@
+#!/bin/sh
+
+set -e
+
+cd "$(dirname "$0")"
+. ../util.sh
+current_test=$(basename $(pwd))
+
+export LOCAL_DIR=$(mktemp -d)
+
+docker compose up -d --quiet-pull
+sleep 5
+
+docker compose exec -T backup backup
+
+logs=$(docker compose logs hooks)
+for event in archive-pre copy-post; do
+  if ! echo "$logs" | grep -q "$event"; then
+    fail "Webhook has not been called for $event: $logs"
+  fi
+done
+if echo "$logs" | grep -q "archive-post"; then
+  fail "Webhook has been called for unsubscribed event."
+fi
+pass "Webhooks have been called for subscribed events."
+
+if [ ! -f "$LOCAL_DIR/test.tar.gz" ]; then
+  fail "Could not find archive."
+fi
+pass "Found archive."
+rm "$LOCAL_DIR/test.tar.gz"
+
+exit_code=0
+output=$(docker compose exec -T -e "WEBHOOK_HEADERS=x-set-response-status-code: 503" backup backup 2>&1) || exit_code=$?
+if [ "$exit_code" = "0" ]; then
+  fail "Backup succeeded although pre webhook failed."
+fi
+if ! echo "$output" | grep -q "received unexpected status code 503"; then
+  fail "Failing webhook has not been reported: $output"
+fi
+if [ -f "$LOCAL_DIR/test.tar.gz" ]; then
+  fail "Archive has been created although pre webhook failed."
+fi
+pass "Failing pre webhook aborted the backup."